@@ -0,0 +1,160 @@
+package configutils
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+)
+
+const (
+	// Kubernetes rejects config maps and secrets whose total size exceeds 1MiB
+	MaxConfigDataSize = 1024 * 1024
+	// ConfigDataKeysKey lists the keys written by WriteConfigToData, one per line. Proto json names never contain
+	// a '.', so it cannot collide with a field key.
+	ConfigDataKeysKey = "config.keys"
+)
+
+var (
+	ErrorConfigTooLarge = func(size int) error {
+		return errors.Errorf("serialized config is %d bytes, which exceeds the %d byte limit", size, MaxConfigDataSize)
+	}
+	ErrorSplittingConfig = func(err error) error {
+		return errors.Wrapf(err, "could not split config into keys")
+	}
+	ErrorJoiningConfig = func(err error) error {
+		return errors.Wrapf(err, "could not join config keys")
+	}
+	ErrorMissingConfigKeys = errors.Errorf("config data has no %v key listing its config keys", ConfigDataKeysKey)
+	ErrorMissingConfigKey  = func(key string) error {
+		return errors.Errorf("config key %v is listed in %v but missing from the data", key, ConfigDataKeysKey)
+	}
+)
+
+// a dataCodec converts between a proto config and the string data stored in a config map or secret
+type dataCodec interface {
+	encode(ctx context.Context, config proto.Message) (map[string]string, error)
+	decode(ctx context.Context, data map[string]string, config proto.Message) error
+}
+
+// stores the entire config under a single key
+type singleKeyCodec struct {
+	configKey string
+	// keeps the config out of the logs, for secrets
+	redact bool
+}
+
+func (c *singleKeyCodec) encode(ctx context.Context, config proto.Message) (map[string]string, error) {
+	configString, err := writeConfigToString(ctx, config, c.redact)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{c.configKey: configString}, nil
+}
+
+func (c *singleKeyCodec) decode(ctx context.Context, data map[string]string, config proto.Message) error {
+	return readConfig(ctx, data[c.configKey], config, c.redact)
+}
+
+// stores each top-level field of the config under its own key
+type multiKeyCodec struct {
+	// keeps the config out of the logs, for secrets
+	redact bool
+}
+
+func (c *multiKeyCodec) encode(ctx context.Context, config proto.Message) (map[string]string, error) {
+	return writeConfigToData(ctx, config, c.redact)
+}
+
+func (c *multiKeyCodec) decode(ctx context.Context, data map[string]string, config proto.Message) error {
+	return readConfigFromData(ctx, data, config, c.redact)
+}
+
+// WriteConfigToData serializes the config with WriteConfigToString and splits the result into one yaml
+// value per top-level field, keyed by the field's json name. The written field keys are recorded under
+// ConfigDataKeysKey so that other keys in the same object are ignored on read.
+// Splitting does not raise the size limit: the config map or secret as a whole must still fit in
+// MaxConfigDataSize, and a larger config is rejected.
+func WriteConfigToData(ctx context.Context, config proto.Message) (map[string]string, error) {
+	return writeConfigToData(ctx, config, false)
+}
+
+func writeConfigToData(ctx context.Context, config proto.Message, redact bool) (map[string]string, error) {
+	configString, err := writeConfigToString(ctx, config, redact)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(configString), &fields); err != nil {
+		return nil, ErrorSplittingConfig(err)
+	}
+	data := make(map[string]string, len(fields))
+	size := 0
+	for key, value := range fields {
+		yml, err := yaml.JSONToYAML(value)
+		if err != nil {
+			return nil, ErrorSplittingConfig(err)
+		}
+		data[key] = string(yml)
+		size += len(key) + len(yml)
+	}
+	keys := strings.Join(sortedKeys(data), "\n")
+	data[ConfigDataKeysKey] = keys
+	size += len(ConfigDataKeysKey) + len(keys)
+	if size > MaxConfigDataSize {
+		wrapped := ErrorConfigTooLarge(size)
+		contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(),
+			zap.Int("size", size),
+			zap.Strings("keys", sortedKeys(data)))
+		return nil, wrapped
+	}
+	return data, nil
+}
+
+// ReadConfigFromData joins the keys listed under ConfigDataKeysKey back together and reads them with ReadConfig.
+// Any other keys in the data are ignored.
+func ReadConfigFromData(ctx context.Context, data map[string]string, config proto.Message) error {
+	return readConfigFromData(ctx, data, config, false)
+}
+
+func readConfigFromData(ctx context.Context, data map[string]string, config proto.Message, redact bool) error {
+	keyList, ok := data[ConfigDataKeysKey]
+	if !ok {
+		return ErrorJoiningConfig(ErrorMissingConfigKeys)
+	}
+	fields := map[string]json.RawMessage{}
+	for _, key := range strings.Split(keyList, "\n") {
+		if key == "" {
+			continue
+		}
+		value, ok := data[key]
+		if !ok {
+			return ErrorJoiningConfig(ErrorMissingConfigKey(key))
+		}
+		jsn, err := yaml.YAMLToJSON([]byte(value))
+		if err != nil {
+			return ErrorJoiningConfig(errors.Wrapf(err, "key %v", key))
+		}
+		fields[key] = jsn
+	}
+	joined, err := json.Marshal(fields)
+	if err != nil {
+		return ErrorJoiningConfig(err)
+	}
+	return readConfig(ctx, string(joined), config, redact)
+}
+
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
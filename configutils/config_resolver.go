@@ -0,0 +1,353 @@
+package configutils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/contextutils"
+	"github.com/solo-io/go-utils/protoutils"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+	kubeerr "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	DefaultsLayer  = "defaults"
+	FileLayer      = "file"
+	ConfigMapLayer = "configMap"
+	EnvLayer       = "env"
+
+	// separates the fields of nested messages in environment variable names, e.g. PREFIX_PARENT__CHILD
+	EnvNestingSeparator = "__"
+)
+
+var (
+	ErrorLoadingConfigLayer = func(err error, layer string) error {
+		return errors.Wrapf(err, "could not load config layer %v", layer)
+	}
+	ErrorReadingConfigFile = func(err error, path string) error {
+		return errors.Wrapf(err, "could not read config file %v", path)
+	}
+	ErrorParsingEnvVar = func(err error, name string) error {
+		return errors.Wrapf(err, "could not parse environment variable %v", name)
+	}
+)
+
+// A ConfigSource is one layer of a layered config
+type ConfigSource interface {
+	// Name identifies the layer in the Provenance returned by ConfigResolver.Resolve
+	Name() string
+	// Load reads the layer into the given (empty) config. A layer that does not exist is not an error,
+	// and is reported by returning false.
+	Load(ctx context.Context, config proto.Message) (bool, error)
+}
+
+// Provenance maps the json path of each field set in the resolved config, such as "parent.child",
+// to the name of the layer that set it last.
+// Repeated fields are appended across layers, so each element is also recorded under its index in the resolved
+// list, such as "parent.items[2]". The path of the list itself names the last layer that appended to it.
+type Provenance map[string]string
+
+// Fields returns the paths of all fields set by the given layer
+func (p Provenance) Fields(layer string) []string {
+	var fields []string
+	for field, l := range p {
+		if l == layer {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ConfigResolver merges config layers, in order, with proto merge semantics: scalar fields set in a later layer
+// override earlier layers, repeated fields are appended, and nested messages are merged recursively.
+// As a consequence a later layer cannot reset a field to its zero value.
+//
+// A typical resolver, which works the same inside and outside of a cluster, is:
+//
+//	NewConfigResolver(
+//		NewDefaultsSource(defaultConfig),
+//		NewFileSource(afero.NewOsFs(), "/etc/my-app/config.yaml"),
+//		NewConfigMapSource(configMapClient, namespace, name, configKey),
+//		NewEnvSource("MY_APP_"),
+//	)
+type ConfigResolver struct {
+	sources []ConfigSource
+}
+
+func NewConfigResolver(sources ...ConfigSource) *ConfigResolver {
+	return &ConfigResolver{sources: sources}
+}
+
+// Resolve merges every layer into config, and reports which layer set each field
+func (r *ConfigResolver) Resolve(ctx context.Context, config proto.Message) (Provenance, error) {
+	provenance := Provenance{}
+	// number of elements each repeated field has in the resolved config so far
+	listLengths := map[string]int{}
+	resolved := newEmpty(config)
+	for _, source := range r.sources {
+		layer := newEmpty(config)
+		found, err := source.Load(ctx, layer)
+		if err != nil {
+			return nil, ErrorLoadingConfigLayer(err, source.Name())
+		}
+		if !found {
+			contextutils.LoggerFrom(ctx).Debugw("Config layer not present, skipping",
+				zap.String("layer", source.Name()))
+			continue
+		}
+		fields, err := protoutils.MarshalMap(layer)
+		if err != nil {
+			return nil, ErrorLoadingConfigLayer(ErrorMarshallingConfig(err), source.Name())
+		}
+		for _, field := range flattenFieldPaths("", fields, listLengths) {
+			provenance[field] = source.Name()
+		}
+		proto.Merge(resolved, layer)
+	}
+	config.Reset()
+	proto.Merge(config, resolved)
+	return provenance, nil
+}
+
+func newEmpty(config proto.Message) proto.Message {
+	return reflect.New(reflect.TypeOf(config).Elem()).Interface().(proto.Message)
+}
+
+// flattenFieldPaths returns the path of every field set in fields. Elements of repeated fields are numbered after
+// the elements already in the resolved config, as recorded in listLengths, which is updated accordingly.
+func flattenFieldPaths(prefix string, fields map[string]interface{}, listLengths map[string]int) []string {
+	var paths []string
+	for key, value := range fields {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			if len(typed) > 0 {
+				paths = append(paths, flattenFieldPaths(path, typed, listLengths)...)
+				continue
+			}
+		case []interface{}:
+			offset := listLengths[path]
+			for i := range typed {
+				paths = append(paths, fmt.Sprintf("%s[%d]", path, offset+i))
+			}
+			listLengths[path] = offset + len(typed)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+type defaultsSource struct {
+	defaultConfig proto.Message
+}
+
+func NewDefaultsSource(defaultConfig proto.Message) ConfigSource {
+	return &defaultsSource{defaultConfig: defaultConfig}
+}
+
+func (s *defaultsSource) Name() string {
+	return DefaultsLayer
+}
+
+func (s *defaultsSource) Load(_ context.Context, config proto.Message) (bool, error) {
+	if s.defaultConfig == nil {
+		return false, nil
+	}
+	proto.Merge(config, s.defaultConfig)
+	return true, nil
+}
+
+type fileSource struct {
+	fs   afero.Fs
+	path string
+}
+
+// NewFileSource reads a local yaml file. The layer is skipped if the file does not exist.
+func NewFileSource(fs afero.Fs, path string) ConfigSource {
+	return &fileSource{fs: fs, path: path}
+}
+
+func (s *fileSource) Name() string {
+	return FileLayer
+}
+
+func (s *fileSource) Load(ctx context.Context, config proto.Message) (bool, error) {
+	contents, err := afero.ReadFile(s.fs, s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, ErrorReadingConfigFile(err, s.path)
+	}
+	if err := ReadConfig(ctx, string(contents), config); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type configMapSource struct {
+	kube               ConfigMapClient
+	configMapNamespace string
+	configMapName      string
+	configKey          string
+}
+
+// NewConfigMapSource reads the same config map as NewConfigClient. Unlike the config client, it never writes
+// a default config to the cluster; the layer is skipped if the config map or key does not exist.
+func NewConfigMapSource(kube ConfigMapClient, configMapNamespace, configMapName, configKey string) ConfigSource {
+	return &configMapSource{
+		kube:               kube,
+		configMapNamespace: configMapNamespace,
+		configMapName:      configMapName,
+		configKey:          configKey,
+	}
+}
+
+func (s *configMapSource) Name() string {
+	return ConfigMapLayer
+}
+
+func (s *configMapSource) Load(ctx context.Context, config proto.Message) (bool, error) {
+	configMap, err := s.kube.GetConfigMap(ctx, s.configMapNamespace, s.configMapName)
+	if err != nil {
+		if kubeerr.IsNotFound(err) {
+			return false, nil
+		}
+		return false, ErrorLoadingExistingConfig(err)
+	}
+	value, ok := configMap.Data[s.configKey]
+	if !ok {
+		return false, nil
+	}
+	if err := ReadConfig(ctx, value, config); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type envSource struct {
+	prefix  string
+	environ func() []string
+}
+
+// NewEnvSource reads fields from environment variables named after the field with the given prefix,
+// e.g. PREFIX_LOG_LEVEL sets logLevel. Fields of nested messages are separated by EnvNestingSeparator.
+// String and enum fields take the value as is, all other fields parse the value as yaml.
+func NewEnvSource(prefix string) ConfigSource {
+	return &envSource{prefix: prefix, environ: os.Environ}
+}
+
+func (s *envSource) Name() string {
+	return EnvLayer
+}
+
+func (s *envSource) Load(ctx context.Context, config proto.Message) (bool, error) {
+	fields := map[string]interface{}{}
+	for _, env := range s.environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], s.prefix) {
+			continue
+		}
+		name, value := parts[0], parts[1]
+		path := strings.Split(strings.TrimPrefix(name, s.prefix), EnvNestingSeparator)
+		if err := setEnvField(fields, reflect.TypeOf(config).Elem(), path, value); err != nil {
+			if err == errUnknownField {
+				contextutils.LoggerFrom(ctx).Debugw("Ignoring environment variable that does not match a config field",
+					zap.String("name", name))
+				continue
+			}
+			return false, ErrorParsingEnvVar(err, name)
+		}
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+	if err := protoutils.UnmarshalMap(fields, config); err != nil {
+		return false, ErrorUnmarshallingConfig(err)
+	}
+	return true, nil
+}
+
+var errUnknownField = errors.New("unknown field")
+
+// sets the value at path in fields, using the json names of the proto fields of structType
+func setEnvField(fields map[string]interface{}, structType reflect.Type, path []string, value string) error {
+	jsonName, fieldType, isString, err := findField(structType, path[0])
+	if err != nil {
+		return err
+	}
+	if len(path) > 1 {
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() != reflect.Struct {
+			return errUnknownField
+		}
+		nested, ok := fields[jsonName].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			fields[jsonName] = nested
+		}
+		return setEnvField(nested, fieldType, path[1:], value)
+	}
+	if isString {
+		fields[jsonName] = value
+		return nil
+	}
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return err
+	}
+	fields[jsonName] = parsed
+	return nil
+}
+
+// finds the field of a generated proto struct whose name matches an environment variable segment, ignoring
+// case and underscores. Returns the json name of the field, its go type, and whether its value is a string in json.
+func findField(structType reflect.Type, segment string) (string, reflect.Type, bool, error) {
+	want := normalizeFieldName(segment)
+	props := proto.GetProperties(structType)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if strings.HasPrefix(field.Name, "XXX_") || i >= len(props.Prop) {
+			continue
+		}
+		prop := props.Prop[i]
+		if prop.OrigName == "" || normalizeFieldName(prop.OrigName) != want {
+			continue
+		}
+		return jsonName(prop), field.Type, prop.Enum != "" || field.Type.Kind() == reflect.String, nil
+	}
+	for origName, oneof := range props.OneofTypes {
+		if normalizeFieldName(origName) != want {
+			continue
+		}
+		// oneof wrapper types are pointers to a struct with a single field holding the value
+		valueType := oneof.Type.Elem().Field(0).Type
+		return jsonName(oneof.Prop), valueType, oneof.Prop.Enum != "" || valueType.Kind() == reflect.String, nil
+	}
+	return "", nil, false, errUnknownField
+}
+
+func jsonName(prop *proto.Properties) string {
+	if prop.JSONName != "" {
+		return prop.JSONName
+	}
+	return prop.OrigName
+}
+
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
@@ -45,6 +45,7 @@ type configClient struct {
 	configMapName      string
 	configKey          string
 	defaultConfig      proto.Message
+	codec              dataCodec
 }
 
 func NewConfigClient(kube ConfigMapClient, configMapNamespace, configMapName, configKey string, defaultConfig proto.Message) ConfigClient {
@@ -54,15 +55,27 @@ func NewConfigClient(kube ConfigMapClient, configMapNamespace, configMapName, co
 		configMapName:      configMapName,
 		defaultConfig:      defaultConfig,
 		configKey:          configKey,
+		codec:              &singleKeyCodec{configKey: configKey},
+	}
+}
+
+// NewMultiKeyConfigClient stores each top-level field of the config under its own key in the config map,
+// rather than serializing the whole message under a single key
+func NewMultiKeyConfigClient(kube ConfigMapClient, configMapNamespace, configMapName string, defaultConfig proto.Message) ConfigClient {
+	return &configClient{
+		kube:               kube,
+		configMapNamespace: configMapNamespace,
+		configMapName:      configMapName,
+		defaultConfig:      defaultConfig,
+		codec:              &multiKeyCodec{},
 	}
 }
 
 func (c *configClient) getConfigMap(ctx context.Context, config proto.Message) (*corev1.ConfigMap, error) {
-	configString, err := WriteConfigToString(ctx, config)
+	data, err := c.codec.encode(ctx, config)
 	if err != nil {
 		return nil, err
 	}
-	data := map[string]string{c.configKey: configString}
 	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: c.configMapNamespace,
@@ -73,23 +86,37 @@ func (c *configClient) getConfigMap(ctx context.Context, config proto.Message) (
 }
 
 func ReadConfig(ctx context.Context, value string, config proto.Message) error {
+	return readConfig(ctx, value, config, false)
+}
+
+// readConfig leaves the value out of the log on failure when redact is set
+func readConfig(ctx context.Context, value string, config proto.Message, redact bool) error {
 	if err := protoutils.UnmarshalYaml([]byte(value), config); err != nil {
 		wrapped := ErrorUnmarshallingConfig(err)
-		contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(),
-			zap.Error(err),
-			zap.Any("value", value))
+		fields := []interface{}{zap.Error(err)}
+		if !redact {
+			fields = append(fields, zap.Any("value", value))
+		}
+		contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(), fields...)
 		return wrapped
 	}
 	return nil
 }
 
 func WriteConfigToString(ctx context.Context, config proto.Message) (string, error) {
+	return writeConfigToString(ctx, config, false)
+}
+
+// writeConfigToString leaves the config out of the log on failure when redact is set
+func writeConfigToString(ctx context.Context, config proto.Message, redact bool) (string, error) {
 	bytes, err := protoutils.MarshalBytes(config)
 	if err != nil {
 		wrapped := ErrorMarshallingConfig(err)
-		contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(),
-			zap.Error(err),
-			zap.Any("config", config))
+		fields := []interface{}{zap.Error(err)}
+		if !redact {
+			fields = append(fields, zap.Any("config", config))
+		}
+		contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(), fields...)
 		return "", wrapped
 	}
 	return string(bytes), nil
@@ -115,7 +142,7 @@ func (c *configClient) GetConfig(ctx context.Context, config proto.Message) erro
 		}
 		loaded = defaultConfigMap
 	}
-	return ReadConfig(ctx, loaded.Data[c.configKey], config)
+	return c.codec.decode(ctx, loaded.Data, config)
 }
 
 func (c *configClient) SetConfig(ctx context.Context, config proto.Message) error {
@@ -124,11 +151,10 @@ func (c *configClient) SetConfig(ctx context.Context, config proto.Message) erro
 		zap.String("configMapNamespace", c.configMapNamespace),
 		zap.String("configMapName", c.configMapName),
 		zap.String("configKey", c.configKey))
-	configString, err := WriteConfigToString(ctx, config)
+	data, err := c.codec.encode(ctx, config)
 	if err != nil {
 		return err
 	}
-	data := map[string]string{c.configKey: configString}
 	var configMap *corev1.ConfigMap
 	// The config map should always exist, but if it was deleted then this will log an error and return a nil,
 	// which we can handle gracefully
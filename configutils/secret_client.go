@@ -0,0 +1,68 @@
+package configutils
+
+import (
+	"context"
+
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	v1 "k8s.io/api/core/v1"
+	kubeerr "k8s.io/apimachinery/pkg/api/errors"
+	kubemeta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type SecretClient interface {
+	GetSecret(ctx context.Context, namespace string, name string) (*v1.Secret, error)
+	SetSecret(ctx context.Context, secret *v1.Secret) error
+}
+
+type KubeSecretClient struct {
+	client kubernetes.Interface
+}
+
+func NewSecretClient(client kubernetes.Interface) SecretClient {
+	return &KubeSecretClient{
+		client: client,
+	}
+}
+
+func (c *KubeSecretClient) GetSecret(ctx context.Context, namespace string, secretName string) (*v1.Secret, error) {
+	contextutils.LoggerFrom(ctx).Debugw("Getting secret from Kubernetes",
+		zap.String("namespace", namespace),
+		zap.String("name", secretName))
+	secret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, secretName, kubemeta.GetOptions{})
+	if err != nil {
+		contextutils.LoggerFrom(ctx).Errorw("Could not get secret",
+			zap.Error(err),
+			zap.String("name", secretName),
+			zap.String("namespace", namespace))
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Secret contents are never logged, only the name and namespace
+func (c *KubeSecretClient) SetSecret(ctx context.Context, secret *v1.Secret) error {
+	contextutils.LoggerFrom(ctx).Debugw("Setting secret in Kubernetes",
+		zap.String("namespace", secret.Namespace),
+		zap.String("name", secret.Name))
+	_, err := c.client.CoreV1().Secrets(secret.Namespace).Update(ctx, secret, kubemeta.UpdateOptions{})
+	if err != nil {
+		if !kubeerr.IsNotFound(err) {
+			contextutils.LoggerFrom(ctx).Errorw("Could not update secret",
+				zap.Error(err),
+				zap.String("name", secret.Name),
+				zap.String("namespace", secret.Namespace))
+			return err
+		}
+		_, err := c.client.CoreV1().Secrets(secret.Namespace).Create(ctx, secret, kubemeta.CreateOptions{})
+		if err != nil {
+			contextutils.LoggerFrom(ctx).Errorw("Secret not found, but error creating it",
+				zap.Error(err),
+				zap.String("name", secret.Name),
+				zap.String("namespace", secret.Namespace))
+			return err
+		}
+	}
+	return nil
+}
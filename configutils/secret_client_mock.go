@@ -0,0 +1,34 @@
+package configutils
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type MockSecretClient struct {
+	Data     map[string][]byte
+	GetError error
+	SetError error
+}
+
+func (c *MockSecretClient) GetSecret(ctx context.Context, namespace string, name string) (*v1.Secret, error) {
+	if c.GetError != nil {
+		return nil, c.GetError
+	}
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		Data: c.Data,
+	}, nil
+}
+
+func (c *MockSecretClient) SetSecret(ctx context.Context, secret *v1.Secret) error {
+	if c.SetError != nil {
+		return c.SetError
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package configutils
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kubeerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// secretConfigClient is the secret-backed equivalent of configClient, for configs that contain sensitive settings.
+// Unlike configClient, it never logs the contents of the config.
+type secretConfigClient struct {
+	kube            SecretClient
+	secretNamespace string
+	secretName      string
+	configKey       string
+	defaultConfig   proto.Message
+	codec           dataCodec
+}
+
+func NewSecretConfigClient(kube SecretClient, secretNamespace, secretName, configKey string, defaultConfig proto.Message) ConfigClient {
+	return &secretConfigClient{
+		kube:            kube,
+		secretNamespace: secretNamespace,
+		secretName:      secretName,
+		configKey:       configKey,
+		defaultConfig:   defaultConfig,
+		codec:           &singleKeyCodec{configKey: configKey, redact: true},
+	}
+}
+
+// NewMultiKeySecretConfigClient stores each top-level field of the config under its own key in the secret
+func NewMultiKeySecretConfigClient(kube SecretClient, secretNamespace, secretName string, defaultConfig proto.Message) ConfigClient {
+	return &secretConfigClient{
+		kube:            kube,
+		secretNamespace: secretNamespace,
+		secretName:      secretName,
+		defaultConfig:   defaultConfig,
+		codec:           &multiKeyCodec{redact: true},
+	}
+}
+
+func (c *secretConfigClient) getSecret(ctx context.Context, config proto.Message) (*corev1.Secret, error) {
+	data, err := c.codec.encode(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: c.secretNamespace,
+			Name:      c.secretName,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: toSecretData(data),
+	}, nil
+}
+
+func (c *secretConfigClient) GetConfig(ctx context.Context, config proto.Message) error {
+	contextutils.LoggerFrom(ctx).Debugw("Loading config from secret",
+		zap.String("secretName", c.secretName),
+		zap.String("secretNamespace", c.secretNamespace),
+		zap.String("configKey", c.configKey))
+	loaded, err := c.kube.GetSecret(ctx, c.secretNamespace, c.secretName)
+	if err != nil && !kubeerr.IsNotFound(err) {
+		return ErrorLoadingExistingConfig(err)
+	} else if err != nil {
+		defaultSecret, marshalErr := c.getSecret(ctx, c.defaultConfig)
+		if marshalErr != nil {
+			return marshalErr
+		}
+		setDefaultErr := c.kube.SetSecret(ctx, defaultSecret)
+		if setDefaultErr != nil {
+			return ErrorSettingDefaultConfig(setDefaultErr)
+		}
+		loaded = defaultSecret
+	}
+	return c.codec.decode(ctx, fromSecretData(loaded.Data), config)
+}
+
+func (c *secretConfigClient) SetConfig(ctx context.Context, config proto.Message) error {
+	contextutils.LoggerFrom(ctx).Infow("Storing config in secret",
+		zap.String("secretNamespace", c.secretNamespace),
+		zap.String("secretName", c.secretName),
+		zap.String("configKey", c.configKey))
+	data, err := c.codec.encode(ctx, config)
+	if err != nil {
+		return err
+	}
+	var secret *corev1.Secret
+	// The secret should always exist, but if it was deleted then this will log an error and return a nil,
+	// which we can handle gracefully
+	loaded, _ := c.kube.GetSecret(ctx, c.secretNamespace, c.secretName)
+	if loaded == nil {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: c.secretNamespace,
+				Name:      c.secretName,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: toSecretData(data),
+		}
+	} else {
+		secret = loaded
+		secret.Data = toSecretData(data)
+		// stringData takes precedence over data on write, so make sure a stale value can't shadow the new config
+		secret.StringData = nil
+	}
+	err = c.kube.SetSecret(ctx, secret)
+	if err != nil {
+		return ErrorUpdatingConfig(err)
+	}
+	return nil
+}
+
+func toSecretData(data map[string]string) map[string][]byte {
+	result := make(map[string][]byte, len(data))
+	for key, value := range data {
+		result[key] = []byte(value)
+	}
+	return result
+}
+
+func fromSecretData(data map[string][]byte) map[string]string {
+	result := make(map[string]string, len(data))
+	for key, value := range data {
+		result[key] = string(value)
+	}
+	return result
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"context"
+	"os"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/configutils"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Config resolver", func() {
+
+	var (
+		ctx       context.Context
+		kube      kubernetes.Interface
+		fs        afero.Fs
+		namespace = "test"
+	)
+
+	const (
+		name      = "test-config"
+		configKey = "config.yaml"
+		filePath  = "/etc/test/config.yaml"
+		envPrefix = "CONFIGUTILS_TEST_"
+	)
+
+	setEnv := func(key, value string) {
+		Expect(os.Setenv(key, value)).NotTo(HaveOccurred())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	newResolver := func() *configutils.ConfigResolver {
+		return configutils.NewConfigResolver(
+			configutils.NewDefaultsSource(&GetApplicationDetailsRequest{ApplicationName: "default-app", RegistryName: "default-registry"}),
+			configutils.NewFileSource(fs, filePath),
+			configutils.NewConfigMapSource(configutils.NewConfigMapClient(kube), namespace, name, configKey),
+			configutils.NewEnvSource(envPrefix),
+		)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		kube = fake.NewClientset()
+		fs = afero.NewMemMapFs()
+	})
+
+	It("uses the defaults when no other layer exists, without writing to the cluster", func() {
+		actual := GetApplicationDetailsRequest{}
+		provenance, err := newResolver().Resolve(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.ApplicationName).To(Equal("default-app"))
+		Expect(actual.RegistryName).To(Equal("default-registry"))
+		Expect(provenance).To(Equal(configutils.Provenance{
+			"applicationName": configutils.DefaultsLayer,
+			"registryName":    configutils.DefaultsLayer,
+		}))
+
+		cms, err := kube.CoreV1().ConfigMaps(namespace).List(ctx, metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cms.Items).To(BeEmpty())
+	})
+
+	It("merges the layers in order and reports which layer set each field", func() {
+		Expect(afero.WriteFile(fs, filePath, []byte("applicationName: file-app\nregistryName: file-registry\n"), 0644)).NotTo(HaveOccurred())
+		_, err := kube.CoreV1().ConfigMaps(namespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{configKey: "registryName: cm-registry\n"},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		setEnv(envPrefix+"APPLICATION_NAME", "env-app")
+
+		actual := GetApplicationDetailsRequest{}
+		provenance, err := newResolver().Resolve(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.ApplicationName).To(Equal("env-app"))
+		Expect(actual.RegistryName).To(Equal("cm-registry"))
+		Expect(provenance.Fields(configutils.EnvLayer)).To(Equal([]string{"applicationName"}))
+		Expect(provenance.Fields(configutils.ConfigMapLayer)).To(Equal([]string{"registryName"}))
+		Expect(provenance.Fields(configutils.FileLayer)).To(BeEmpty())
+	})
+
+	It("skips a config map without the config key", func() {
+		_, err := kube.CoreV1().ConfigMaps(namespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       map[string]string{"other.yaml": "registryName: other\n"},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		actual := GetApplicationDetailsRequest{}
+		provenance, err := newResolver().Resolve(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.RegistryName).To(Equal("default-registry"))
+		Expect(provenance.Fields(configutils.ConfigMapLayer)).To(BeEmpty())
+	})
+
+	It("ignores environment variables that don't match a field", func() {
+		setEnv(envPrefix+"UNKNOWN", "value")
+		setEnv(envPrefix+"REGISTRY_NAME", "env-registry")
+
+		actual := GetApplicationDetailsRequest{}
+		provenance, err := newResolver().Resolve(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.RegistryName).To(Equal("env-registry"))
+		Expect(provenance.Fields(configutils.EnvLayer)).To(Equal([]string{"registryName"}))
+	})
+
+	It("records the layer of each element of a repeated field", func() {
+		resolver := configutils.NewConfigResolver(
+			&staticSource{name: "first", config: &types.Api{Name: "first", Methods: []*types.Method{{Name: "a"}, {Name: "b"}}}},
+			&staticSource{name: "second", config: &types.Api{Methods: []*types.Method{{Name: "c"}}}},
+		)
+		actual := types.Api{}
+		provenance, err := resolver.Resolve(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.Methods).To(HaveLen(3))
+		Expect(provenance).To(Equal(configutils.Provenance{
+			"name":       "first",
+			"methods":    "second",
+			"methods[0]": "first",
+			"methods[1]": "first",
+			"methods[2]": "second",
+		}))
+	})
+
+	It("errors when a layer can't be read", func() {
+		Expect(afero.WriteFile(fs, filePath, []byte("applicationName: [not, a, string]\n"), 0644)).NotTo(HaveOccurred())
+		_, err := newResolver().Resolve(ctx, &GetApplicationDetailsRequest{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("could not load config layer " + configutils.FileLayer))
+	})
+
+	It("errors when the config map client errors", func() {
+		testErr := eris.Errorf("test")
+		resolver := configutils.NewConfigResolver(
+			configutils.NewConfigMapSource(&configutils.MockConfigMapClient{GetError: testErr}, namespace, name, configKey),
+		)
+		_, err := resolver.Resolve(ctx, &GetApplicationDetailsRequest{})
+		Expect(err.Error()).To(Equal(configutils.ErrorLoadingConfigLayer(configutils.ErrorLoadingExistingConfig(testErr), configutils.ConfigMapLayer).Error()))
+	})
+})
+
+type staticSource struct {
+	name   string
+	config proto.Message
+}
+
+func (s *staticSource) Name() string {
+	return s.name
+}
+
+func (s *staticSource) Load(_ context.Context, config proto.Message) (bool, error) {
+	proto.Merge(config, s.config)
+	return true, nil
+}
@@ -0,0 +1,205 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/go-utils/contextutils"
+	"github.com/solo-io/k8s-utils/configutils"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	kubeerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Config storage modes", func() {
+
+	var (
+		ctx       context.Context
+		kube      kubernetes.Interface
+		namespace = "test"
+	)
+
+	const (
+		name      = "test-config"
+		configKey = "config.yaml"
+	)
+
+	getDefaultConfig := func() *GetApplicationDetailsRequest {
+		return &GetApplicationDetailsRequest{
+			ApplicationName: "foo",
+			RegistryName:    "bar",
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		kube = fake.NewClientset()
+	})
+
+	Context("secret config client", func() {
+
+		var configClient configutils.ConfigClient
+
+		BeforeEach(func() {
+			configClient = configutils.NewSecretConfigClient(configutils.NewSecretClient(kube), namespace, name, configKey, getDefaultConfig())
+		})
+
+		It("writes the default config to a secret and reads it back", func() {
+			actual := GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			Expect(actual).To(BeEquivalentTo(*getDefaultConfig()))
+
+			secret, err := kube.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(HaveKey(configKey))
+			_, err = kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(kubeerr.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("updates an existing secret", func() {
+			expected := getDefaultConfig()
+			expected.ApplicationName = "updated"
+			Expect(configClient.SetConfig(ctx, expected)).NotTo(HaveOccurred())
+			actual := GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			Expect(actual).To(BeEquivalentTo(*expected))
+		})
+
+		Context("errors", func() {
+
+			var mockSecretClient configutils.MockSecretClient
+			testErr := eris.Errorf("test")
+
+			BeforeEach(func() {
+				mockSecretClient = configutils.MockSecretClient{}
+				configClient = configutils.NewSecretConfigClient(&mockSecretClient, namespace, name, configKey, getDefaultConfig())
+			})
+
+			It("errors on get when secret client errors", func() {
+				mockSecretClient.GetError = testErr
+				err := configClient.GetConfig(ctx, &GetApplicationDetailsRequest{})
+				Expect(err.Error()).To(BeEquivalentTo(configutils.ErrorLoadingExistingConfig(testErr).Error()))
+			})
+
+			It("errors on set when secret client errors", func() {
+				mockSecretClient.SetError = testErr
+				err := configClient.SetConfig(ctx, getDefaultConfig())
+				Expect(err.Error()).To(BeEquivalentTo(configutils.ErrorUpdatingConfig(testErr).Error()))
+			})
+
+			It("errors on get when default config can't be set", func() {
+				mockSecretClient.GetError = kubeerr.NewNotFound(schema.GroupResource{}, "name")
+				mockSecretClient.SetError = testErr
+				err := configClient.GetConfig(ctx, &GetApplicationDetailsRequest{})
+				Expect(err.Error()).To(BeEquivalentTo(configutils.ErrorSettingDefaultConfig(testErr).Error()))
+			})
+
+			It("reads data from the mock", func() {
+				mockSecretClient.Data = map[string][]byte{configKey: []byte("applicationName: mocked")}
+				actual := GetApplicationDetailsRequest{}
+				Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+				Expect(actual.ApplicationName).To(Equal("mocked"))
+			})
+
+			It("does not log the contents of a corrupted secret", func() {
+				core, logs := observer.New(zap.DebugLevel)
+				ctx = contextutils.WithExistingLogger(ctx, zap.New(core).Sugar())
+				mockSecretClient.Data = map[string][]byte{
+					configKey:                     []byte("applicationName: [hunter2"),
+					"applicationName":             []byte("[hunter2"),
+					configutils.ConfigDataKeysKey: []byte("applicationName"),
+				}
+
+				Expect(configClient.GetConfig(ctx, &GetApplicationDetailsRequest{})).To(HaveOccurred())
+				multiKeyClient := configutils.NewMultiKeySecretConfigClient(&mockSecretClient, namespace, name, getDefaultConfig())
+				Expect(multiKeyClient.GetConfig(ctx, &GetApplicationDetailsRequest{})).To(HaveOccurred())
+
+				Expect(logs.FilterMessageSnippet("hunter2").Len()).To(BeZero())
+				for _, entry := range logs.All() {
+					Expect(fmt.Sprint(entry.ContextMap())).NotTo(ContainSubstring("hunter2"))
+				}
+			})
+		})
+	})
+
+	Context("multi-key config client", func() {
+
+		It("stores one key per top-level field", func() {
+			configClient := configutils.NewMultiKeyConfigClient(configutils.NewConfigMapClient(kube), namespace, name, getDefaultConfig())
+			actual := GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			Expect(actual).To(BeEquivalentTo(*getDefaultConfig()))
+
+			cm, err := kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cm.Data).To(Equal(map[string]string{
+				"applicationName":             "foo\n",
+				"registryName":                "bar\n",
+				configutils.ConfigDataKeysKey: "applicationName\nregistryName",
+			}))
+
+			expected := getDefaultConfig()
+			expected.RegistryName = ""
+			Expect(configClient.SetConfig(ctx, expected)).NotTo(HaveOccurred())
+			actual = GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			Expect(actual).To(BeEquivalentTo(*expected))
+		})
+
+		It("works with the mock config map client", func() {
+			mockConfigMapClient := &configutils.MockConfigMapClient{
+				Data: map[string]string{
+					"applicationName":             "mocked",
+					configutils.ConfigDataKeysKey: "applicationName",
+				},
+			}
+			configClient := configutils.NewMultiKeyConfigClient(mockConfigMapClient, namespace, name, getDefaultConfig())
+			actual := GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			Expect(actual.ApplicationName).To(Equal("mocked"))
+			Expect(actual.RegistryName).To(BeEmpty())
+		})
+
+		It("can be used with a secret", func() {
+			configClient := configutils.NewMultiKeySecretConfigClient(configutils.NewSecretClient(kube), namespace, name, getDefaultConfig())
+			actual := GetApplicationDetailsRequest{}
+			Expect(configClient.GetConfig(ctx, &actual)).NotTo(HaveOccurred())
+			secret, err := kube.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(secret.Data).To(HaveKey("applicationName"))
+			Expect(secret.Data).To(HaveKey("registryName"))
+		})
+
+		It("ignores keys that were not written by the client", func() {
+			data, err := configutils.WriteConfigToData(ctx, getDefaultConfig())
+			Expect(err).NotTo(HaveOccurred())
+			data["unrelated"] = "added: by another tool"
+			actual := GetApplicationDetailsRequest{}
+			Expect(configutils.ReadConfigFromData(ctx, data, &actual)).NotTo(HaveOccurred())
+			Expect(actual).To(BeEquivalentTo(*getDefaultConfig()))
+		})
+
+		It("errors when the key list is missing", func() {
+			actual := GetApplicationDetailsRequest{}
+			err := configutils.ReadConfigFromData(ctx, map[string]string{"applicationName": "foo"}, &actual)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(configutils.ConfigDataKeysKey))
+		})
+
+		It("refuses to write a config larger than the object size limit", func() {
+			large := getDefaultConfig()
+			large.ApplicationName = strings.Repeat("a", configutils.MaxConfigDataSize)
+			_, err := configutils.WriteConfigToData(ctx, large)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("exceeds the"))
+		})
+	})
+})
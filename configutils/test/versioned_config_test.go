@@ -0,0 +1,175 @@
+package test
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/configutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("Versioned config client", func() {
+
+	var (
+		ctx       context.Context
+		kube      kubernetes.Interface
+		namespace = "test"
+		opts      configutils.VersionedConfigOptions
+	)
+
+	const (
+		name       = "test-config"
+		configKey  = "config.yaml"
+		versionKey = configKey + configutils.DefaultSchemaVersionKeySuffix
+	)
+
+	getDefaultConfig := func() *GetApplicationDetailsRequest {
+		return &GetApplicationDetailsRequest{
+			ApplicationName: "foo",
+			RegistryName:    "bar",
+		}
+	}
+
+	newClient := func() configutils.VersionedConfigClient {
+		client, err := configutils.NewVersionedConfigClient(configutils.NewConfigMapClient(kube), namespace, name, configKey, getDefaultConfig(), opts)
+		Expect(err).NotTo(HaveOccurred())
+		return client
+	}
+
+	storeRaw := func(data map[string]string) {
+		_, err := kube.CoreV1().ConfigMaps(namespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Data:       data,
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		kube = fake.NewClientset()
+		opts = configutils.VersionedConfigOptions{
+			CurrentVersion: 2,
+			Migrations: []configutils.Migration{
+				{
+					FromVersion: 0,
+					Description: "rename app to applicationName",
+					Migrate:     configutils.RenameField("app", "applicationName"),
+				},
+				{
+					FromVersion: 1,
+					Description: "drop the removed registryUrl field",
+					Migrate:     configutils.RemoveFields("registryUrl"),
+				},
+			},
+		}
+	})
+
+	It("stores the default config with the current version", func() {
+		actual := GetApplicationDetailsRequest{}
+		summary, err := newClient().GetConfigWithSummary(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual).To(BeEquivalentTo(*getDefaultConfig()))
+		Expect(summary.Migrated()).To(BeFalse())
+
+		cm, err := kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data[versionKey]).To(Equal("2"))
+	})
+
+	It("migrates an unversioned config and persists the result", func() {
+		storeRaw(map[string]string{configKey: "app: legacy\nregistryName: reg\nregistryUrl: http://example.com\n"})
+
+		actual := GetApplicationDetailsRequest{}
+		summary, err := newClient().GetConfigWithSummary(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.ApplicationName).To(Equal("legacy"))
+		Expect(actual.RegistryName).To(Equal("reg"))
+		Expect(summary.StoredVersion).To(Equal(0))
+		Expect(summary.Persisted).To(BeTrue())
+		Expect(summary.Applied).To(Equal([]configutils.AppliedMigration{
+			{FromVersion: 0, ToVersion: 1, Description: "rename app to applicationName"},
+			{FromVersion: 1, ToVersion: 2, Description: "drop the removed registryUrl field"},
+		}))
+
+		cm, err := kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data[versionKey]).To(Equal("2"))
+		Expect(cm.Data[configKey]).NotTo(ContainSubstring("registryUrl"))
+	})
+
+	It("only runs the migrations newer than the stored version", func() {
+		storeRaw(map[string]string{
+			configKey:  "applicationName: current\nregistryUrl: http://example.com\n",
+			versionKey: "1",
+		})
+		actual := GetApplicationDetailsRequest{}
+		summary, err := newClient().GetConfigWithSummary(ctx, &actual)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actual.ApplicationName).To(Equal("current"))
+		Expect(summary.Applied).To(HaveLen(1))
+		Expect(summary.Applied[0].FromVersion).To(Equal(1))
+	})
+
+	It("fails on a config newer than the client supports", func() {
+		storeRaw(map[string]string{configKey: "applicationName: future\n", versionKey: "3"})
+		err := newClient().GetConfig(ctx, &GetApplicationDetailsRequest{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal(configutils.ErrorUnsupportedSchemaVersion(3, 2).Error()))
+	})
+
+	It("fails when a migration fails, without persisting", func() {
+		migrationErr := eris.New("migration failed")
+		opts.Migrations[1].Migrate = func(ctx context.Context, config map[string]interface{}) error {
+			return migrationErr
+		}
+		storeRaw(map[string]string{configKey: "app: legacy\n"})
+		summary, err := newClient().GetConfigWithSummary(ctx, &GetApplicationDetailsRequest{})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(migrationErr.Error()))
+		Expect(summary.Applied).To(HaveLen(1))
+		Expect(summary.Persisted).To(BeFalse())
+
+		cm, err := kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data).NotTo(HaveKey(versionKey))
+	})
+
+	It("validates configs before persisting them", func() {
+		validationErr := eris.New("application name is required")
+		opts.Validators = []configutils.ConfigValidator{
+			func(ctx context.Context, config proto.Message) error {
+				if config.(*GetApplicationDetailsRequest).ApplicationName == "" {
+					return validationErr
+				}
+				return nil
+			},
+		}
+		client := newClient()
+		err := client.SetConfig(ctx, &GetApplicationDetailsRequest{RegistryName: "reg"})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal(configutils.ErrorInvalidConfig(validationErr).Error()))
+		_, err = kube.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+
+		Expect(client.SetConfig(ctx, getDefaultConfig())).NotTo(HaveOccurred())
+	})
+
+	It("rejects an incomplete migration chain", func() {
+		opts.Migrations = opts.Migrations[:1]
+		_, err := configutils.NewVersionedConfigClient(configutils.NewConfigMapClient(kube), namespace, name, configKey, getDefaultConfig(), opts)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no migration from version 1"))
+	})
+
+	It("rejects duplicate migrations", func() {
+		opts.Migrations = append(opts.Migrations, opts.Migrations[0])
+		_, err := configutils.NewVersionedConfigClient(configutils.NewConfigMapClient(kube), namespace, name, configKey, getDefaultConfig(), opts)
+		Expect(err).To(HaveOccurred())
+	})
+})
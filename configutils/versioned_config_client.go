@@ -0,0 +1,333 @@
+package configutils
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kubeerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// appended to the config key to get the key holding the schema version, unless VersionKey is set
+	DefaultSchemaVersionKeySuffix = ".schema-version"
+)
+
+var (
+	ErrorInvalidMigrations = func(err error) error {
+		return errors.Wrapf(err, "invalid config migrations")
+	}
+	ErrorReadingSchemaVersion = func(err error) error {
+		return errors.Wrapf(err, "could not read config schema version")
+	}
+	ErrorUnsupportedSchemaVersion = func(stored, current int) error {
+		return errors.Errorf("config schema version %d is newer than the latest supported version %d", stored, current)
+	}
+	ErrorMigratingConfig = func(err error, from, to int) error {
+		return errors.Wrapf(err, "could not migrate config from schema version %d to %d", from, to)
+	}
+	ErrorInvalidConfig = func(err error) error {
+		return errors.Wrapf(err, "config failed validation")
+	}
+)
+
+// A Migration upgrades a config from FromVersion to FromVersion+1. It operates on the decoded yaml of the stored
+// config rather than the proto, so that it can handle fields that no longer exist in the current schema.
+type Migration struct {
+	FromVersion int
+	Description string
+	Migrate     func(ctx context.Context, config map[string]interface{}) error
+}
+
+// A ConfigValidator rejects a config before it is persisted
+type ConfigValidator func(ctx context.Context, config proto.Message) error
+
+type VersionedConfigOptions struct {
+	// The schema version the current proto message corresponds to. Configs stored without a version are version 0.
+	CurrentVersion int
+	// The config map key holding the schema version. Defaults to the config key + DefaultSchemaVersionKeySuffix
+	VersionKey string
+	// There must be exactly one migration from every version below CurrentVersion
+	Migrations []Migration
+	Validators []ConfigValidator
+}
+
+type AppliedMigration struct {
+	FromVersion int
+	ToVersion   int
+	Description string
+}
+
+// MigrationSummary reports what happened to the stored config while it was loaded
+type MigrationSummary struct {
+	StoredVersion  int
+	CurrentVersion int
+	Applied        []AppliedMigration
+	// true if the migrated config was written back to the config map
+	Persisted bool
+}
+
+func (s *MigrationSummary) Migrated() bool {
+	return len(s.Applied) > 0
+}
+
+type VersionedConfigClient interface {
+	ConfigClient
+	// GetConfigWithSummary behaves like GetConfig, and also reports the migrations that ran
+	GetConfigWithSummary(ctx context.Context, config proto.Message) (*MigrationSummary, error)
+}
+
+type versionedConfigClient struct {
+	kube               ConfigMapClient
+	configMapNamespace string
+	configMapName      string
+	configKey          string
+	versionKey         string
+	currentVersion     int
+	defaultConfig      proto.Message
+	migrations         map[int]Migration
+	validators         []ConfigValidator
+}
+
+func NewVersionedConfigClient(kube ConfigMapClient, configMapNamespace, configMapName, configKey string, defaultConfig proto.Message, opts VersionedConfigOptions) (VersionedConfigClient, error) {
+	migrations, err := indexMigrations(opts.CurrentVersion, opts.Migrations)
+	if err != nil {
+		return nil, ErrorInvalidMigrations(err)
+	}
+	versionKey := opts.VersionKey
+	if versionKey == "" {
+		versionKey = configKey + DefaultSchemaVersionKeySuffix
+	}
+	return &versionedConfigClient{
+		kube:               kube,
+		configMapNamespace: configMapNamespace,
+		configMapName:      configMapName,
+		configKey:          configKey,
+		versionKey:         versionKey,
+		currentVersion:     opts.CurrentVersion,
+		defaultConfig:      defaultConfig,
+		migrations:         migrations,
+		validators:         opts.Validators,
+	}, nil
+}
+
+func indexMigrations(currentVersion int, migrations []Migration) (map[int]Migration, error) {
+	if currentVersion < 0 {
+		return nil, errors.Errorf("current version %d must not be negative", currentVersion)
+	}
+	result := make(map[int]Migration, len(migrations))
+	for _, migration := range migrations {
+		if migration.Migrate == nil {
+			return nil, errors.Errorf("migration from version %d has no migrate function", migration.FromVersion)
+		}
+		if migration.FromVersion < 0 || migration.FromVersion >= currentVersion {
+			return nil, errors.Errorf("migration from version %d is outside of the supported range [0, %d)",
+				migration.FromVersion, currentVersion)
+		}
+		if _, ok := result[migration.FromVersion]; ok {
+			return nil, errors.Errorf("found more than one migration from version %d", migration.FromVersion)
+		}
+		result[migration.FromVersion] = migration
+	}
+	for version := 0; version < currentVersion; version++ {
+		if _, ok := result[version]; !ok {
+			return nil, errors.Errorf("no migration from version %d", version)
+		}
+	}
+	return result, nil
+}
+
+func (c *versionedConfigClient) GetConfig(ctx context.Context, config proto.Message) error {
+	_, err := c.GetConfigWithSummary(ctx, config)
+	return err
+}
+
+func (c *versionedConfigClient) GetConfigWithSummary(ctx context.Context, config proto.Message) (*MigrationSummary, error) {
+	logger := contextutils.LoggerFrom(ctx)
+	logger.Debugw("Loading versioned config",
+		zap.String("configMapName", c.configMapName),
+		zap.String("configMapNamespace", c.configMapNamespace),
+		zap.String("configKey", c.configKey),
+		zap.Int("currentVersion", c.currentVersion))
+	summary := &MigrationSummary{CurrentVersion: c.currentVersion}
+
+	loaded, err := c.kube.GetConfigMap(ctx, c.configMapNamespace, c.configMapName)
+	if err != nil && !kubeerr.IsNotFound(err) {
+		return nil, ErrorLoadingExistingConfig(err)
+	} else if err != nil {
+		if err := c.SetConfig(ctx, c.defaultConfig); err != nil {
+			return nil, ErrorSettingDefaultConfig(err)
+		}
+		summary.StoredVersion = c.currentVersion
+		summary.Persisted = true
+		defaultString, err := WriteConfigToString(ctx, c.defaultConfig)
+		if err != nil {
+			return nil, err
+		}
+		return summary, ReadConfig(ctx, defaultString, config)
+	}
+
+	storedVersion, err := c.storedVersion(loaded.Data)
+	if err != nil {
+		return nil, err
+	}
+	summary.StoredVersion = storedVersion
+	if storedVersion > c.currentVersion {
+		return nil, ErrorUnsupportedSchemaVersion(storedVersion, c.currentVersion)
+	}
+	if storedVersion == c.currentVersion {
+		return summary, ReadConfig(ctx, loaded.Data[c.configKey], config)
+	}
+
+	migrated, applied, err := c.migrate(ctx, storedVersion, loaded.Data[c.configKey])
+	summary.Applied = applied
+	if err != nil {
+		return summary, err
+	}
+	if err := ReadConfig(ctx, migrated, config); err != nil {
+		return summary, ErrorMigratingConfig(err, storedVersion, c.currentVersion)
+	}
+	if err := c.SetConfig(ctx, config); err != nil {
+		return summary, err
+	}
+	summary.Persisted = true
+	logger.Infow("Migrated stored config",
+		zap.String("configMapName", c.configMapName),
+		zap.String("configMapNamespace", c.configMapNamespace),
+		zap.Int("fromVersion", storedVersion),
+		zap.Int("toVersion", c.currentVersion),
+		zap.Int("migrations", len(applied)))
+	return summary, nil
+}
+
+func (c *versionedConfigClient) storedVersion(data map[string]string) (int, error) {
+	value, ok := data[c.versionKey]
+	if !ok {
+		// configs written before versioning was introduced
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, ErrorReadingSchemaVersion(err)
+	}
+	return version, nil
+}
+
+// runs every migration from the stored version up to the current version, returning the migrated config as json
+func (c *versionedConfigClient) migrate(ctx context.Context, fromVersion int, value string) (string, []AppliedMigration, error) {
+	var applied []AppliedMigration
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(value), &raw); err != nil {
+		return "", nil, ErrorMigratingConfig(ErrorUnmarshallingConfig(err), fromVersion, c.currentVersion)
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	for version := fromVersion; version < c.currentVersion; version++ {
+		migration := c.migrations[version]
+		if err := migration.Migrate(ctx, raw); err != nil {
+			return "", applied, ErrorMigratingConfig(err, version, version+1)
+		}
+		applied = append(applied, AppliedMigration{
+			FromVersion: version,
+			ToVersion:   version + 1,
+			Description: migration.Description,
+		})
+		contextutils.LoggerFrom(ctx).Infow("Applied config migration",
+			zap.String("configMapName", c.configMapName),
+			zap.Int("fromVersion", version),
+			zap.Int("toVersion", version+1),
+			zap.String("description", migration.Description))
+	}
+	jsn, err := json.Marshal(raw)
+	if err != nil {
+		return "", applied, ErrorMigratingConfig(err, fromVersion, c.currentVersion)
+	}
+	return string(jsn), applied, nil
+}
+
+func (c *versionedConfigClient) validate(ctx context.Context, config proto.Message) error {
+	for _, validator := range c.validators {
+		if err := validator(ctx, config); err != nil {
+			wrapped := ErrorInvalidConfig(err)
+			contextutils.LoggerFrom(ctx).Errorw(wrapped.Error(),
+				zap.Error(err),
+				zap.Any("config", config))
+			return wrapped
+		}
+	}
+	return nil
+}
+
+func (c *versionedConfigClient) SetConfig(ctx context.Context, config proto.Message) error {
+	if err := c.validate(ctx, config); err != nil {
+		return err
+	}
+	contextutils.LoggerFrom(ctx).Infow("Storing versioned config",
+		zap.Any("config", config),
+		zap.String("configMapNamespace", c.configMapNamespace),
+		zap.String("configMapName", c.configMapName),
+		zap.String("configKey", c.configKey),
+		zap.Int("version", c.currentVersion))
+	configString, err := WriteConfigToString(ctx, config)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{
+		c.configKey:  configString,
+		c.versionKey: strconv.Itoa(c.currentVersion),
+	}
+	var configMap *corev1.ConfigMap
+	// see configClient.SetConfig
+	loaded, _ := c.kube.GetConfigMap(ctx, c.configMapNamespace, c.configMapName)
+	if loaded == nil {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: c.configMapNamespace,
+				Name:      c.configMapName,
+			},
+			Data: data,
+		}
+	} else {
+		configMap = loaded
+		configMap.Data = data
+	}
+	if err := c.kube.SetConfigMap(ctx, configMap); err != nil {
+		return ErrorUpdatingConfig(err)
+	}
+	return nil
+}
+
+// RenameField returns a migration function that moves a top-level field to a new name
+func RenameField(from, to string) func(ctx context.Context, config map[string]interface{}) error {
+	return func(ctx context.Context, config map[string]interface{}) error {
+		value, ok := config[from]
+		if !ok {
+			return nil
+		}
+		if _, exists := config[to]; exists {
+			return errors.Errorf("cannot rename field %v to %v, %v already exists", from, to, to)
+		}
+		delete(config, from)
+		config[to] = value
+		return nil
+	}
+}
+
+// RemoveFields returns a migration function that drops top-level fields which no longer exist in the schema
+func RemoveFields(fields ...string) func(ctx context.Context, config map[string]interface{}) error {
+	return func(ctx context.Context, config map[string]interface{}) error {
+		for _, field := range fields {
+			delete(config, field)
+		}
+		return nil
+	}
+}
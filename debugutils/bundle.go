@@ -0,0 +1,312 @@
+package debugutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	bundleCollectorStr = "bundleCollector"
+
+	// Layout of a bundle, relative to its location:
+	//
+	//	manifest.json
+	//	cluster/nodes.txt
+	//	cluster/resources/<Kind>_<version>.yaml
+	//	namespaces/<namespace>/pods.txt
+	//	namespaces/<namespace>/events.txt
+	//	namespaces/<namespace>/resources/<Kind>_<version>.yaml
+	//	namespaces/<namespace>/logs/<namespace>_<pod>_<container>.log
+	BundleManifestFile  = "manifest.json"
+	BundleClusterDir    = "cluster"
+	BundleNamespacesDir = "namespaces"
+	BundleResourcesDir  = "resources"
+	BundleLogsDir       = "logs"
+	BundleNodesFile     = "nodes.txt"
+	BundlePodsFile      = "pods.txt"
+	BundleEventsFile    = "events.txt"
+)
+
+// The kinds of file recorded in a BundleManifest
+const (
+	BundleFileResources = "resources"
+	BundleFileLogs      = "logs"
+	BundleFileNodes     = "nodes"
+	BundleFilePods      = "pods"
+	BundleFileEvents    = "events"
+)
+
+type BundleOptions struct {
+	Namespaces []string
+	// Additional resources to collect, for example the resources of a rendered helm chart. Namespaced resources are
+	// collected with their namespace, custom resource definitions are listed in every namespace, and all other
+	// resources are collected under the cluster directory. Pods are always collected.
+	Resources kuberesource.UnstructuredResources
+	SkipLogs  bool
+}
+
+// BundleManifest is the index of a bundle, saved to BundleManifestFile
+type BundleManifest struct {
+	CreatedAt  time.Time    `json:"createdAt"`
+	Namespaces []string     `json:"namespaces"`
+	Files      []BundleFile `json:"files"`
+	// Collection is best effort; anything that could not be collected is reported here instead of failing the bundle
+	Errors []string `json:"errors,omitempty"`
+}
+
+type BundleFile struct {
+	// relative to the bundle location
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+type BundleCollector interface {
+	Collect(ctx context.Context, client StorageClient, location string, opts BundleOptions) (*BundleManifest, error)
+}
+
+type bundleCollector struct {
+	kube              kubernetes.Interface
+	resourceCollector ResourceCollector
+	logCollector      LogCollector
+}
+
+func NewBundleCollector(kube kubernetes.Interface, resourceCollector ResourceCollector, logCollector LogCollector) *bundleCollector {
+	return &bundleCollector{
+		kube:              kube,
+		resourceCollector: resourceCollector,
+		logCollector:      logCollector,
+	}
+}
+
+func DefaultBundleCollector() (*bundleCollector, error) {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", bundleCollectorStr)
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", bundleCollectorStr)
+	}
+	resourceCollector, err := DefaultResourceCollector()
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", bundleCollectorStr)
+	}
+	logCollector, err := DefaultLogCollector()
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", bundleCollectorStr)
+	}
+	return NewBundleCollector(kube, resourceCollector, logCollector), nil
+}
+
+// BundleOnFail is the native replacement for KubeDumpOnFail. It saves a bundle of the given namespaces to location
+// on the local filesystem, and does not need kubectl or bash.
+func BundleOnFail(out io.Writer, location string, namespaces ...string) func() {
+	return func() {
+		collector, err := DefaultBundleCollector()
+		if err != nil {
+			fmt.Fprintf(out, "collecting debug bundle failed: %v\n", err)
+			return
+		}
+		manifest, err := collector.Collect(context.Background(), DefaultFileStorageClient(), location, BundleOptions{Namespaces: namespaces})
+		if err != nil {
+			fmt.Fprintf(out, "collecting debug bundle failed: %v\n", err)
+			return
+		}
+		fmt.Fprintf(out, "saved debug bundle with %d files to %s\n", len(manifest.Files), location)
+		for _, collectErr := range manifest.Errors {
+			fmt.Fprintf(out, "  %s\n", collectErr)
+		}
+	}
+}
+
+func (bc *bundleCollector) Collect(ctx context.Context, client StorageClient, location string, opts BundleOptions) (*BundleManifest, error) {
+	b := &bundle{
+		client:   client,
+		location: location,
+		manifest: &BundleManifest{
+			CreatedAt:  time.Now().UTC(),
+			Namespaces: opts.Namespaces,
+		},
+	}
+
+	clusterDir := filepath.Join(location, BundleClusterDir)
+	nodes, err := bc.describeNodes(ctx)
+	b.addError(b.save(clusterDir, BundleFileNodes, "", BundleNodesFile, nodes, err))
+	clusterResources := opts.Resources.Filter(func(resource *unstructured.Unstructured) bool {
+		return resource.GetNamespace() != "" || resource.GetKind() == "CustomResourceDefinition"
+	})
+	if len(clusterResources) > 0 {
+		b.addError(bc.saveResources(ctx, b, filepath.Join(clusterDir, BundleResourcesDir), "", clusterResources))
+	}
+
+	for _, namespace := range opts.Namespaces {
+		bc.collectNamespace(ctx, b, namespace, opts)
+	}
+
+	sort.SliceStable(b.manifest.Files, func(i, j int) bool {
+		return b.manifest.Files[i].Path < b.manifest.Files[j].Path
+	})
+	manifestJson, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Save(location, &StorageObject{
+		Resource: bytes.NewReader(manifestJson),
+		Name:     BundleManifestFile,
+	}); err != nil {
+		return nil, eris.Wrapf(err, "unable to save bundle manifest")
+	}
+	return b.manifest, nil
+}
+
+func (bc *bundleCollector) collectNamespace(ctx context.Context, b *bundle, namespace string, opts BundleOptions) {
+	namespaceDir := filepath.Join(b.location, BundleNamespacesDir, namespace)
+
+	pods, err := bc.kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		b.addError(eris.Wrapf(err, "unable to list pods in namespace %s", namespace))
+		return
+	}
+	b.addError(b.save(namespaceDir, BundleFilePods, namespace, BundlePodsFile, describePods(pods.Items), nil))
+	events, err := bc.describeEvents(ctx, namespace)
+	b.addError(b.save(namespaceDir, BundleFileEvents, namespace, BundleEventsFile, events, err))
+
+	podResources, err := ConvertPodsToUnstructured(pods)
+	if err != nil {
+		b.addError(err)
+		return
+	}
+	namespaceResources := opts.Resources.Filter(func(resource *unstructured.Unstructured) bool {
+		return resource.GetNamespace() != namespace && resource.GetKind() != "CustomResourceDefinition"
+	})
+	namespaceResources = append(namespaceResources, podResources...)
+	b.addError(bc.saveResources(ctx, b, filepath.Join(namespaceDir, BundleResourcesDir), namespace, namespaceResources))
+
+	if opts.SkipLogs || len(podResources) == 0 {
+		return
+	}
+	requests, err := bc.logCollector.GetLogRequests(ctx, podResources)
+	if err != nil {
+		b.addError(eris.Wrapf(err, "unable to build log requests in namespace %s", namespace))
+		return
+	}
+	logsDir := filepath.Join(namespaceDir, BundleLogsDir)
+	for _, request := range requests {
+		// logs are saved one at a time so that a container which hasn't started doesn't prevent saving the others
+		err := bc.logCollector.SaveLogs(ctx, b.recorder(BundleFileLogs, namespace), logsDir, []*LogsRequest{request})
+		if err != nil {
+			b.addError(eris.Wrapf(err, "unable to save logs for %s", request.ResourceId()))
+		}
+	}
+}
+
+func (bc *bundleCollector) saveResources(ctx context.Context, b *bundle, location, namespace string, resources kuberesource.UnstructuredResources) error {
+	versionedResources, err := bc.resourceCollector.RetrieveResources(ctx, resources, namespace, metav1.ListOptions{})
+	if err != nil {
+		return eris.Wrapf(err, "unable to retrieve resources for %s", location)
+	}
+	// the resource collector also finds the pods of owner resources, which may already have been collected
+	var all kuberesource.UnstructuredResources
+	for _, versionedResource := range versionedResources {
+		all = append(all, versionedResource.Resources...)
+	}
+	deduplicated := all.ByKey().List().GroupedByGVK()
+	if err := bc.resourceCollector.SaveResources(ctx, b.recorder(BundleFileResources, namespace), location, deduplicated); err != nil {
+		return eris.Wrapf(err, "unable to save resources to %s", location)
+	}
+	return nil
+}
+
+func (bc *bundleCollector) describeNodes(ctx context.Context) ([]byte, error) {
+	nodes, err := bc.kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to list nodes")
+	}
+	return describeNodes(nodes.Items), nil
+}
+
+func (bc *bundleCollector) describeEvents(ctx context.Context, namespace string) ([]byte, error) {
+	events, err := bc.kube.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to list events in namespace %s", namespace)
+	}
+	return describeEvents(events.Items), nil
+}
+
+// bundle tracks the files written while collecting a bundle
+type bundle struct {
+	client   StorageClient
+	location string
+
+	lock     sync.Mutex
+	manifest *BundleManifest
+}
+
+func (b *bundle) save(location, kind, namespace, name string, contents []byte, err error) error {
+	if err != nil {
+		return err
+	}
+	return b.recorder(kind, namespace).Save(location, &StorageObject{
+		Resource: bytes.NewReader(contents),
+		Name:     name,
+	})
+}
+
+func (b *bundle) recorder(kind, namespace string) StorageClient {
+	return &recordingStorageClient{bundle: b, kind: kind, namespace: namespace}
+}
+
+func (b *bundle) addError(err error) {
+	if err == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.manifest.Errors = append(b.manifest.Errors, err.Error())
+}
+
+func (b *bundle) addFile(location, name, kind, namespace string) {
+	path, err := filepath.Rel(b.location, filepath.Join(location, name))
+	if err != nil {
+		path = filepath.Join(location, name)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.manifest.Files = append(b.manifest.Files, BundleFile{
+		Path:      filepath.ToSlash(path),
+		Kind:      kind,
+		Namespace: namespace,
+	})
+}
+
+// recordingStorageClient adds every object it saves to the bundle manifest
+type recordingStorageClient struct {
+	bundle    *bundle
+	kind      string
+	namespace string
+}
+
+func (r *recordingStorageClient) Save(location string, resources ...*StorageObject) error {
+	if err := r.bundle.client.Save(location, resources...); err != nil {
+		return err
+	}
+	for _, resource := range resources {
+		r.bundle.addFile(location, resource.Name, r.kind, r.namespace)
+	}
+	return nil
+}
@@ -0,0 +1,514 @@
+package debugutils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/installutils/helmchart"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/spf13/afero"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DefaultIgnoredDiffFields are the fields which differ between any two runs, and are left out of field diffs. List
+// indexes may be given as [*] to match any element. Restarts of containers are compared separately, see
+// BundleDiff.Containers.
+var DefaultIgnoredDiffFields = []string{
+	"metadata.name",
+	"metadata.generateName",
+	"metadata.uid",
+	"metadata.resourceVersion",
+	"metadata.generation",
+	"metadata.creationTimestamp",
+	"metadata.managedFields",
+	"metadata.ownerReferences",
+	"metadata.selfLink",
+	"spec.nodeName",
+	"status.hostIP",
+	"status.hostIPs",
+	"status.podIP",
+	"status.podIPs",
+	"status.startTime",
+	"status.conditions[*].lastProbeTime",
+	"status.conditions[*].lastTransitionTime",
+	"status.containerStatuses[*].containerID",
+	"status.containerStatuses[*].state",
+	"status.containerStatuses[*].lastState",
+	"status.containerStatuses[*].restartCount",
+	"status.initContainerStatuses[*].containerID",
+	"status.initContainerStatuses[*].state",
+	"status.initContainerStatuses[*].lastState",
+	"status.initContainerStatuses[*].restartCount",
+}
+
+var listIndexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// LoadedBundle holds the resources and log summaries of a dump written by ResourceCollector.SaveResources and
+// LogCollector.SaveLogs, or by a BundleCollector
+type LoadedBundle struct {
+	// keyed by the resource key with the normalized name of the resource, see normalizedNames
+	Resources map[kuberesource.ResourceKey]*unstructured.Unstructured
+	// keyed by namespace/pod/container, with the normalized pod name
+	Containers map[string]*ContainerSummary
+}
+
+type ContainerSummary struct {
+	Restarts int32
+	// the number of log lines with level error or fatal
+	ErrorLines int
+}
+
+type BundleDiff struct {
+	Added   []kuberesource.ResourceKey
+	Removed []kuberesource.ResourceKey
+	Changed []ResourceDiff
+	// only the containers whose restarts or error lines changed
+	Containers []ContainerDiff
+}
+
+type ResourceDiff struct {
+	Key    kuberesource.ResourceKey
+	Fields []FieldDiff
+}
+
+type FieldDiff struct {
+	// e.g. spec.template.spec.containers[0].image or metadata.labels['app.kubernetes.io/name']
+	Path string
+	// nil if the field is not set
+	Before, After interface{}
+}
+
+type ContainerDiff struct {
+	// namespace/pod/container, with the normalized pod name
+	Container string
+	Before    ContainerSummary
+	After     ContainerSummary
+}
+
+// DiffBundleDirs loads the bundles saved to two locations and compares them
+func DiffBundleDirs(fs afero.Fs, before, after string) (*BundleDiff, error) {
+	beforeBundle, err := LoadBundle(fs, before)
+	if err != nil {
+		return nil, err
+	}
+	afterBundle, err := LoadBundle(fs, after)
+	if err != nil {
+		return nil, err
+	}
+	return DiffBundles(beforeBundle, afterBundle, DefaultIgnoredDiffFields...), nil
+}
+
+// LoadBundle reads every .yaml and .log file below location
+func LoadBundle(fs afero.Fs, location string) (*LoadedBundle, error) {
+	var resources kuberesource.UnstructuredResources
+	errorLines := map[string]int{}
+	err := afero.Walk(fs, location, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml":
+			loaded, err := loadResources(fs, path)
+			if err != nil {
+				return err
+			}
+			resources = append(resources, loaded...)
+		case ".log":
+			container, ok := containerFromLogFile(filepath.Base(path))
+			if !ok {
+				return nil
+			}
+			count, err := countErrorLines(fs, path)
+			if err != nil {
+				return err
+			}
+			errorLines[container] += count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to load bundle %s", location)
+	}
+
+	names := normalizedNames(resources)
+	bundle := &LoadedBundle{
+		Resources:  map[kuberesource.ResourceKey]*unstructured.Unstructured{},
+		Containers: map[string]*ContainerSummary{},
+	}
+	podNames := map[string]string{}
+	for _, resource := range resources {
+		key := kuberesource.Key(resource)
+		key.Name = names[resource]
+		bundle.Resources[key] = resource
+		if resource.GetKind() != "Pod" {
+			continue
+		}
+		podNames[resource.GetNamespace()+"/"+resource.GetName()] = key.Name
+		for container, restarts := range restartCounts(resource) {
+			bundle.container(resource.GetNamespace() + "/" + key.Name + "/" + container).Restarts = restarts
+		}
+	}
+	for container, count := range errorLines {
+		// log files are named after the pod, which is matched to its normalized name if the pod was saved too
+		namespace, rest, _ := strings.Cut(container, "/")
+		pod, name, _ := strings.Cut(rest, "/")
+		if normalized, ok := podNames[namespace+"/"+pod]; ok {
+			pod = normalized
+		}
+		bundle.container(namespace + "/" + pod + "/" + name).ErrorLines += count
+	}
+	return bundle, nil
+}
+
+func (b *LoadedBundle) container(key string) *ContainerSummary {
+	summary, ok := b.Containers[key]
+	if !ok {
+		summary = &ContainerSummary{}
+		b.Containers[key] = summary
+	}
+	return summary
+}
+
+func loadResources(fs afero.Fs, path string) (kuberesource.UnstructuredResources, error) {
+	contents, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return nil, err
+	}
+	manifests := helmchart.Manifests{{Name: path, Content: string(contents), Head: &releaseutil.SimpleHead{}}}
+	resources, err := manifests.ResourceList()
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to parse resources in %s", path)
+	}
+	return resources, nil
+}
+
+// log files are named <namespace>_<pod>_<container>.log by LogsRequest.ResourceId, which is unambiguous as
+// kubernetes names can't contain underscores. Logs of previous containers are counted with the current ones.
+func containerFromLogFile(name string) (string, bool) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".log"), "_previous")
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 {
+		return "", false
+	}
+	return strings.Join(parts, "/"), true
+}
+
+func countErrorLines(fs afero.Fs, path string) (int, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	count := 0
+	lines := bufio.NewReader(file)
+	for {
+		line, err := lines.ReadString('\n')
+		if line != "" && DetectLogLevel(line) >= LogLevelError {
+			count++
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func restartCounts(pod *unstructured.Unstructured) map[string]int32 {
+	result := map[string]int32{}
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", field)
+		for _, status := range statuses {
+			statusMap, ok := status.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(statusMap, "name")
+			restarts, _, _ := unstructured.NestedInt64(statusMap, "restartCount")
+			result[name] = int32(restarts)
+		}
+	}
+	return result
+}
+
+// normalizedNames strips the random parts of generated names, so that the same resources can be matched across
+// runs: pods get the name they were generated from, followed by their index among the pods generated from the same
+// name, e.g. gateway-0 for gateway-5b4c7d8f9-x2x7z, and pod template hashes are removed, e.g. gateway for the
+// replica set gateway-5b4c7d8f9. Resources whose normalized names collide, such as the old and new replica sets of a
+// deployment after a rollout, keep distinct names, see distinctNames.
+func normalizedNames(resources kuberesource.UnstructuredResources) map[*unstructured.Unstructured]string {
+	result := map[*unstructured.Unstructured]string{}
+	generated := map[string][]*unstructured.Unstructured{}
+	for _, resource := range resources {
+		name := resource.GetName()
+		if hash := resource.GetLabels()["pod-template-hash"]; hash != "" {
+			name = strings.Replace(name, "-"+hash, "", 1)
+		}
+		result[resource] = name
+		generateName := resource.GetGenerateName()
+		if generateName == "" || !strings.HasPrefix(resource.GetName(), generateName) {
+			continue
+		}
+		if hash := resource.GetLabels()["pod-template-hash"]; hash != "" {
+			generateName = strings.Replace(generateName, "-"+hash, "", 1)
+		}
+		group := fmt.Sprintf("%s/%s/%s", resource.GetKind(), resource.GetNamespace(), generateName)
+		generated[group] = append(generated[group], resource)
+	}
+	for _, group := range generated {
+		// pods are numbered in the order they were created
+		sort.SliceStable(group, func(i, j int) bool {
+			ti, tj := group[i].GetCreationTimestamp(), group[j].GetCreationTimestamp()
+			if !ti.Equal(&tj) {
+				return ti.Before(&tj)
+			}
+			return group[i].GetName() < group[j].GetName()
+		})
+		for i, resource := range group {
+			generateName := resource.GetGenerateName()
+			if hash := resource.GetLabels()["pod-template-hash"]; hash != "" {
+				generateName = strings.Replace(generateName, "-"+hash, "", 1)
+			}
+			result[resource] = fmt.Sprintf("%s%d", generateName, i)
+		}
+	}
+	distinctNames(resources, result)
+	return result
+}
+
+// distinctNames renames resources of the same kind and namespace whose normalized names collide. They are suffixed
+// with their deployment.kubernetes.io/revision annotation if it tells all of them apart, e.g. gateway-rev2, and
+// otherwise numbered in the order they were created, like generated pods, e.g. gateway-1.
+func distinctNames(resources kuberesource.UnstructuredResources, names map[*unstructured.Unstructured]string) {
+	taken := map[string]bool{}
+	collisions := map[string][]*unstructured.Unstructured{}
+	var groups []string
+	for _, resource := range resources {
+		group := fmt.Sprintf("%s/%s/%s", resource.GroupVersionKind(), resource.GetNamespace(), names[resource])
+		taken[group] = true
+		if len(collisions[group]) == 0 {
+			groups = append(groups, group)
+		}
+		collisions[group] = append(collisions[group], resource)
+	}
+	for _, group := range groups {
+		colliding := collisions[group]
+		if len(colliding) < 2 {
+			continue
+		}
+		sort.SliceStable(colliding, func(i, j int) bool {
+			ri, rj := revision(colliding[i]), revision(colliding[j])
+			if ri != rj {
+				return ri < rj
+			}
+			ti, tj := colliding[i].GetCreationTimestamp(), colliding[j].GetCreationTimestamp()
+			if !ti.Equal(&tj) {
+				return ti.Before(&tj)
+			}
+			return colliding[i].GetName() < colliding[j].GetName()
+		})
+		revisions := map[int64]bool{}
+		for _, resource := range colliding {
+			if rev := revision(resource); rev > 0 {
+				revisions[rev] = true
+			}
+		}
+		byRevision := len(revisions) == len(colliding)
+		for i, resource := range colliding {
+			prefix := strings.TrimSuffix(group, names[resource])
+			name := fmt.Sprintf("%s-%d", names[resource], i)
+			if byRevision {
+				name = fmt.Sprintf("%s-rev%d", names[resource], revision(resource))
+			}
+			// skip names used by other resources of the same kind
+			for n := len(colliding); taken[prefix+name]; n++ {
+				name = fmt.Sprintf("%s-%d", names[resource], n)
+			}
+			taken[prefix+name] = true
+			names[resource] = name
+		}
+	}
+}
+
+// the deployment.kubernetes.io/revision annotation of replica sets, or 0 if it is missing
+func revision(resource *unstructured.Unstructured) int64 {
+	rev, err := strconv.ParseInt(resource.GetAnnotations()["deployment.kubernetes.io/revision"], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return rev
+}
+
+// DiffBundles compares two bundles, leaving the given fields out of field diffs
+func DiffBundles(before, after *LoadedBundle, ignoredFields ...string) *BundleDiff {
+	ignored := map[string]bool{}
+	for _, field := range ignoredFields {
+		ignored[field] = true
+	}
+	diff := &BundleDiff{}
+	for key, resource := range after.Resources {
+		beforeResource, ok := before.Resources[key]
+		if !ok {
+			diff.Added = append(diff.Added, key)
+			continue
+		}
+		var fields []FieldDiff
+		diffFields("", beforeResource.Object, resource.Object, ignored, &fields)
+		if len(fields) > 0 {
+			diff.Changed = append(diff.Changed, ResourceDiff{Key: key, Fields: fields})
+		}
+	}
+	for key := range before.Resources {
+		if _, ok := after.Resources[key]; !ok {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+
+	containers := map[string]bool{}
+	for container := range before.Containers {
+		containers[container] = true
+	}
+	for container := range after.Containers {
+		containers[container] = true
+	}
+	for container := range containers {
+		containerDiff := ContainerDiff{Container: container}
+		if summary, ok := before.Containers[container]; ok {
+			containerDiff.Before = *summary
+		}
+		if summary, ok := after.Containers[container]; ok {
+			containerDiff.After = *summary
+		}
+		if containerDiff.Before != containerDiff.After {
+			diff.Containers = append(diff.Containers, containerDiff)
+		}
+	}
+
+	sortResourceKeys(diff.Added)
+	sortResourceKeys(diff.Removed)
+	sort.SliceStable(diff.Changed, func(i, j int) bool {
+		return resourceKeyString(diff.Changed[i].Key) < resourceKeyString(diff.Changed[j].Key)
+	})
+	sort.SliceStable(diff.Containers, func(i, j int) bool {
+		return diff.Containers[i].Container < diff.Containers[j].Container
+	})
+	return diff
+}
+
+func diffFields(path string, before, after interface{}, ignored map[string]bool, result *[]FieldDiff) {
+	if ignored[path] || ignored[listIndexPattern.ReplaceAllString(path, "[*]")] {
+		return
+	}
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		keys := map[string]bool{}
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		sortedKeys := make([]string, 0, len(keys))
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+		for _, key := range sortedKeys {
+			diffFields(fieldPath(path, key), beforeMap[key], afterMap[key], ignored, result)
+		}
+		return
+	}
+	beforeList, beforeIsList := before.([]interface{})
+	afterList, afterIsList := after.([]interface{})
+	if beforeIsList && afterIsList {
+		for i := 0; i < len(beforeList) || i < len(afterList); i++ {
+			var beforeItem, afterItem interface{}
+			if i < len(beforeList) {
+				beforeItem = beforeList[i]
+			}
+			if i < len(afterList) {
+				afterItem = afterList[i]
+			}
+			diffFields(fmt.Sprintf("%s[%d]", path, i), beforeItem, afterItem, ignored, result)
+		}
+		return
+	}
+	if !reflect.DeepEqual(before, after) {
+		*result = append(*result, FieldDiff{Path: path, Before: before, After: after})
+	}
+}
+
+// paths use the syntax of redaction rules, quoting keys which contain dots
+func fieldPath(parent, key string) string {
+	if strings.ContainsAny(key, ".[]'") {
+		return fmt.Sprintf("%s['%s']", parent, key)
+	}
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func sortResourceKeys(keys []kuberesource.ResourceKey) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return resourceKeyString(keys[i]) < resourceKeyString(keys[j])
+	})
+}
+
+func resourceKeyString(key kuberesource.ResourceKey) string {
+	if key.Namespace == "" {
+		return fmt.Sprintf("%s %s", key.Gvk.Kind, key.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", key.Gvk.Kind, key.Namespace, key.Name)
+}
+
+// String renders the diff as a report. Added resources are prefixed with +, removed resources with - and changed
+// resources with ~ followed by their changed fields, e.g. "spec.replicas: 1 -> 2". The containers whose restarts or
+// error lines changed are listed last.
+func (d *BundleDiff) String() string {
+	b := &bytes.Buffer{}
+	for _, key := range d.Added {
+		fmt.Fprintf(b, "+ %s\n", resourceKeyString(key))
+	}
+	for _, key := range d.Removed {
+		fmt.Fprintf(b, "- %s\n", resourceKeyString(key))
+	}
+	for _, changed := range d.Changed {
+		fmt.Fprintf(b, "~ %s\n", resourceKeyString(changed.Key))
+		for _, field := range changed.Fields {
+			fmt.Fprintf(b, "    %s: %s -> %s\n", field.Path, formatDiffValue(field.Before), formatDiffValue(field.After))
+		}
+	}
+	if len(d.Containers) > 0 {
+		b.WriteString("containers:\n")
+		for _, container := range d.Containers {
+			fmt.Fprintf(b, "  %s: restarts %d -> %d, error lines %d -> %d\n", container.Container,
+				container.Before.Restarts, container.After.Restarts, container.Before.ErrorLines, container.After.ErrorLines)
+		}
+	}
+	return b.String()
+}
+
+func formatDiffValue(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return "<unset>"
+	case string:
+		return fmt.Sprintf("%q", typed)
+	default:
+		return fmt.Sprintf("%v", typed)
+	}
+}
@@ -0,0 +1,205 @@
+package debugutils
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("bundle diff", func() {
+	var fs afero.Fs
+
+	fromYaml := func(manifest string) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(manifest), &resource.Object)).NotTo(HaveOccurred())
+		return resource
+	}
+
+	saveBundle := func(location string, logs map[string]string, manifests ...string) {
+		var resources kuberesource.UnstructuredResources
+		for _, manifest := range manifests {
+			resources = append(resources, fromYaml(manifest))
+		}
+		client := NewFileStorageClient(fs)
+		Expect((&resourceCollector{}).SaveResources(context.Background(), client, location+"/resources",
+			resources.GroupedByGVK())).NotTo(HaveOccurred())
+		for name, contents := range logs {
+			Expect(afero.WriteFile(fs, location+"/logs/"+name, []byte(contents), 0644)).NotTo(HaveOccurred())
+		}
+	}
+
+	deployment := func(image string) string {
+		return `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: gateway
+  namespace: gloo-system
+  uid: ` + image + `
+  labels:
+    app.kubernetes.io/name: gateway
+spec:
+  template:
+    spec:
+      containers:
+      - name: gateway
+        image: ` + image
+	}
+
+	pod := func(name string, restarts int) string {
+		return `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: gateway-5b4c7d8f9-` + name + `
+  generateName: gateway-5b4c7d8f9-
+  namespace: gloo-system
+  labels:
+    pod-template-hash: 5b4c7d8f9
+spec:
+  nodeName: node-` + name + `
+status:
+  podIP: 10.0.0.` + strconv.Itoa(restarts) + `
+  containerStatuses:
+  - name: gateway
+    containerID: containerd://` + name + `
+    restartCount: ` + strconv.Itoa(restarts)
+	}
+
+	replicaSet := func(hash string, revision int) string {
+		return `
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: gateway-` + hash + `
+  namespace: gloo-system
+  annotations:
+    deployment.kubernetes.io/revision: "` + strconv.Itoa(revision) + `"
+  labels:
+    pod-template-hash: ` + hash + `
+spec:
+  replicas: ` + strconv.Itoa(revision-1)
+	}
+
+	BeforeEach(func() {
+		fs = afero.NewMemMapFs()
+		saveBundle("/before", map[string]string{
+			"gloo-system_gateway-5b4c7d8f9-abcde_gateway.log": `{"level":"info","msg":"started"}` + "\n",
+		},
+			deployment("gateway:1.0"),
+			pod("abcde", 0),
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: removed
+  namespace: gloo-system
+`)
+		saveBundle("/after", map[string]string{
+			"gloo-system_gateway-5b4c7d8f9-fghij_gateway.log": `{"level":"info","msg":"started"}` + "\n" +
+				`{"level":"error","msg":"failed"}` + "\n" +
+				"E0101 00:00:00.000000       1 main.go:10] failed again",
+			"gloo-system_gateway-5b4c7d8f9-fghij_gateway_previous.log": `{"level":"fatal","msg":"crashed"}` + "\n",
+		},
+			deployment("gateway:1.1"),
+			pod("fghij", 3),
+			`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: added
+  namespace: gloo-system
+  labels:
+    app.kubernetes.io/name: gateway
+`)
+	})
+
+	It("reports added, removed and changed resources and containers", func() {
+		diff, err := DiffBundleDirs(fs, "/before", "/after")
+		Expect(err).NotTo(HaveOccurred())
+
+		configMap := schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+		Expect(diff.Added).To(Equal([]kuberesource.ResourceKey{{Gvk: configMap, Namespace: "gloo-system", Name: "added"}}))
+		Expect(diff.Removed).To(Equal([]kuberesource.ResourceKey{{Gvk: configMap, Namespace: "gloo-system", Name: "removed"}}))
+		Expect(diff.Changed).To(Equal([]ResourceDiff{
+			{
+				Key:    kuberesource.ResourceKey{Gvk: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, Namespace: "gloo-system", Name: "gateway"},
+				Fields: []FieldDiff{{Path: "spec.template.spec.containers[0].image", Before: "gateway:1.0", After: "gateway:1.1"}},
+			},
+		}))
+		Expect(diff.Containers).To(Equal([]ContainerDiff{{
+			Container: "gloo-system/gateway-0/gateway",
+			Before:    ContainerSummary{},
+			After:     ContainerSummary{Restarts: 3, ErrorLines: 3},
+		}}))
+
+		Expect(diff.String()).To(Equal(`+ ConfigMap gloo-system/added
+- ConfigMap gloo-system/removed
+~ Deployment gloo-system/gateway
+    spec.template.spec.containers[0].image: "gateway:1.0" -> "gateway:1.1"
+containers:
+  gloo-system/gateway-0/gateway: restarts 0 -> 3, error lines 0 -> 3
+`))
+	})
+
+	It("keeps the replica sets of a rollout apart", func() {
+		saveBundle("/rollout-before", nil, replicaSet("5b4c7d8f9", 1))
+		saveBundle("/rollout-after", nil, replicaSet("5b4c7d8f9", 1), replicaSet("6d8f9b5c7", 2))
+
+		before, err := LoadBundle(fs, "/rollout-before")
+		Expect(err).NotTo(HaveOccurred())
+		after, err := LoadBundle(fs, "/rollout-after")
+		Expect(err).NotTo(HaveOccurred())
+		replicaSetGvk := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+		Expect(after.Resources).To(HaveLen(2))
+		Expect(after.Resources[kuberesource.ResourceKey{Gvk: replicaSetGvk, Namespace: "gloo-system", Name: "gateway-rev1"}].GetName()).
+			To(Equal("gateway-5b4c7d8f9"))
+		Expect(after.Resources[kuberesource.ResourceKey{Gvk: replicaSetGvk, Namespace: "gloo-system", Name: "gateway-rev2"}].GetName()).
+			To(Equal("gateway-6d8f9b5c7"))
+
+		Expect(DiffBundles(before, after, DefaultIgnoredDiffFields...).String()).To(Equal(`+ ReplicaSet gloo-system/gateway-rev1
++ ReplicaSet gloo-system/gateway-rev2
+- ReplicaSet gloo-system/gateway
+`))
+	})
+
+	It("numbers colliding resources without distinct revisions", func() {
+		resources := kuberesource.UnstructuredResources{
+			fromYaml(replicaSet("6d8f9b5c7", 2)),
+			fromYaml(replicaSet("5b4c7d8f9", 2)),
+			fromYaml(`
+apiVersion: apps/v1
+kind: ReplicaSet
+metadata:
+  name: gateway-0
+  namespace: gloo-system
+`),
+		}
+		names := normalizedNames(resources)
+		Expect(names[resources[0]]).To(Equal("gateway-1"))
+		Expect(names[resources[1]]).To(Equal("gateway-2"))
+		Expect(names[resources[2]]).To(Equal("gateway-0"))
+	})
+
+	It("ignores list elements given with [*]", func() {
+		var fields []FieldDiff
+		diffFields("", map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": "a", "name": "x"}}},
+			map[string]interface{}{"items": []interface{}{map[string]interface{}{"id": "b", "name": "y"}}},
+			map[string]bool{"items[*].id": true}, &fields)
+		Expect(fields).To(Equal([]FieldDiff{{Path: "items[0].name", Before: "x", After: "y"}}))
+	})
+
+	It("quotes keys containing dots in field paths", func() {
+		var fields []FieldDiff
+		diffFields("", map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "a"}},
+			map[string]interface{}{"labels": map[string]interface{}{}}, nil, &fields)
+		Expect(fields).To(Equal([]FieldDiff{{Path: "labels['app.kubernetes.io/name']", Before: "a"}}))
+	})
+})
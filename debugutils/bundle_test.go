@@ -0,0 +1,147 @@
+package debugutils
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("bundle collector", func() {
+	var (
+		ctx           context.Context
+		fs            afero.Fs
+		storageClient *FileStorageClient
+		resourcesMock *MockResourceCollector
+		logCollector  *MockLogCollector
+		collector     *bundleCollector
+		pod           *corev1.Pod
+	)
+
+	const location = "/bundle"
+
+	readFile := func(path string) string {
+		contents, err := afero.ReadFile(fs, filepath.Join(location, path))
+		Expect(err).NotTo(HaveOccurred())
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		ctrl, ctx = gomock.WithContext(context.Background(), T)
+		fs = afero.NewMemMapFs()
+		storageClient = NewFileStorageClient(fs)
+		resourcesMock = NewMockResourceCollector(ctrl)
+		logCollector = NewMockLogCollector(ctrl)
+
+		pod = gatewayPod()
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:         "gateway",
+			RestartCount: 3,
+			State: corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"},
+			},
+		}}
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "node-1",
+				Labels: map[string]string{"node-role.kubernetes.io/control-plane": ""},
+			},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue, Reason: "KubeletReady"}},
+			},
+		}
+		event := &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "event-1", Namespace: pod.Namespace},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: pod.Name},
+			Type:           corev1.EventTypeWarning,
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+			Count:          5,
+		}
+		collector = NewBundleCollector(fake.NewClientset(pod, node, event), resourcesMock, logCollector)
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("writes the standard layout with a manifest", func() {
+		resourcesDir := filepath.Join(location, BundleNamespacesDir, pod.Namespace, BundleResourcesDir)
+		logsDir := filepath.Join(location, BundleNamespacesDir, pod.Namespace, BundleLogsDir)
+		resourcesMock.EXPECT().RetrieveResources(ctx, gomock.Any(), pod.Namespace, metav1.ListOptions{}).
+			DoAndReturn(func(_ context.Context, resources kuberesource.UnstructuredResources, _ string, _ metav1.ListOptions) ([]kuberesource.VersionedResources, error) {
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].GetName()).To(Equal(pod.Name))
+				// the pod is found twice, once directly and once through its owner
+				return append(resources.GroupedByGVK(), resources.GroupedByGVK()...), nil
+			})
+		resourcesMock.EXPECT().SaveResources(ctx, gomock.Any(), resourcesDir, gomock.Any()).
+			DoAndReturn(func(_ context.Context, client StorageClient, location string, resources []kuberesource.VersionedResources) error {
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Resources).To(HaveLen(1))
+				return (&resourceCollector{}).SaveResources(ctx, client, location, resources)
+			})
+		request := &LogsRequest{LogMeta: LogMeta{PodMeta: pod.ObjectMeta, ContainerName: "gateway"}}
+		logCollector.EXPECT().GetLogRequests(ctx, gomock.Any()).Return([]*LogsRequest{request}, nil)
+		logCollector.EXPECT().SaveLogs(ctx, gomock.Any(), logsDir, []*LogsRequest{request}).
+			DoAndReturn(func(_ context.Context, client StorageClient, location string, requests []*LogsRequest) error {
+				return client.Save(location, &StorageObject{Resource: strings.NewReader("log line"), Name: requests[0].ResourceId()})
+			})
+
+		manifest, err := collector.Collect(ctx, storageClient, location, BundleOptions{Namespaces: []string{pod.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Errors).To(BeEmpty())
+		Expect(manifest.Files).To(Equal([]BundleFile{
+			{Path: "cluster/nodes.txt", Kind: BundleFileNodes},
+			{Path: "namespaces/gloo-system/events.txt", Kind: BundleFileEvents, Namespace: "gloo-system"},
+			{Path: "namespaces/gloo-system/logs/gloo-system_" + pod.Name + "_gateway.log", Kind: BundleFileLogs, Namespace: "gloo-system"},
+			{Path: "namespaces/gloo-system/pods.txt", Kind: BundleFilePods, Namespace: "gloo-system"},
+			{Path: "namespaces/gloo-system/resources/Pod_v1.yaml", Kind: BundleFileResources, Namespace: "gloo-system"},
+		}))
+
+		var saved BundleManifest
+		Expect(json.Unmarshal([]byte(readFile(BundleManifestFile)), &saved)).NotTo(HaveOccurred())
+		Expect(saved.Files).To(Equal(manifest.Files))
+
+		Expect(readFile("cluster/nodes.txt")).To(And(ContainSubstring("node-1"), ContainSubstring("control-plane"), ContainSubstring("KubeletReady")))
+		Expect(readFile("namespaces/gloo-system/pods.txt")).To(And(ContainSubstring("CrashLoopBackOff"), ContainSubstring("Restart Count: 3")))
+		Expect(readFile("namespaces/gloo-system/events.txt")).To(And(ContainSubstring("BackOff"), ContainSubstring("pod/"+pod.Name)))
+		Expect(readFile("namespaces/gloo-system/logs/gloo-system_" + pod.Name + "_gateway.log")).To(Equal("log line"))
+	})
+
+	It("records errors and keeps collecting", func() {
+		fakeErr := eris.New("this is a fake error")
+		resourcesMock.EXPECT().RetrieveResources(ctx, gomock.Any(), pod.Namespace, gomock.Any()).Return(nil, fakeErr)
+		request := &LogsRequest{LogMeta: LogMeta{PodMeta: pod.ObjectMeta, ContainerName: "gateway"}}
+		logCollector.EXPECT().GetLogRequests(ctx, gomock.Any()).Return([]*LogsRequest{request}, nil)
+		logCollector.EXPECT().SaveLogs(ctx, gomock.Any(), gomock.Any(), gomock.Any()).Return(fakeErr)
+
+		manifest, err := collector.Collect(ctx, storageClient, location, BundleOptions{Namespaces: []string{pod.Namespace}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Errors).To(HaveLen(2))
+		Expect(manifest.Errors[0]).To(ContainSubstring(fakeErr.Error()))
+		Expect(manifest.Files).To(HaveLen(3))
+	})
+
+	It("skips logs when asked to", func() {
+		resourcesMock.EXPECT().RetrieveResources(ctx, gomock.Any(), pod.Namespace, gomock.Any()).Return(nil, nil)
+		resourcesMock.EXPECT().SaveResources(ctx, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+		manifest, err := collector.Collect(ctx, storageClient, location, BundleOptions{
+			Namespaces: []string{pod.Namespace},
+			SkipLogs:   true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Errors).To(BeEmpty())
+	})
+})
@@ -0,0 +1,186 @@
+package debugutils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const nodeRoleLabelPrefix = "node-role.kubernetes.io/"
+
+// describeNodes summarizes the status of each node, similar to kubectl describe node
+func describeNodes(nodes []corev1.Node) []byte {
+	b := &bytes.Buffer{}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
+	})
+	for _, node := range nodes {
+		fmt.Fprintf(b, "Name:           %s\n", node.Name)
+		fmt.Fprintf(b, "Roles:          %s\n", nodeRoles(node))
+		fmt.Fprintf(b, "Kubelet:        %s\n", node.Status.NodeInfo.KubeletVersion)
+		fmt.Fprintf(b, "Unschedulable:  %t\n", node.Spec.Unschedulable)
+		fmt.Fprintf(b, "Capacity:       cpu=%s, memory=%s, pods=%s\n",
+			node.Status.Capacity.Cpu(), node.Status.Capacity.Memory(), node.Status.Capacity.Pods())
+		fmt.Fprintf(b, "Allocatable:    cpu=%s, memory=%s, pods=%s\n",
+			node.Status.Allocatable.Cpu(), node.Status.Allocatable.Memory(), node.Status.Allocatable.Pods())
+		if len(node.Spec.Taints) > 0 {
+			b.WriteString("Taints:\n")
+			for _, taint := range node.Spec.Taints {
+				fmt.Fprintf(b, "  %s\n", taint.ToString())
+			}
+		}
+		b.WriteString("Conditions:\n")
+		w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  TYPE\tSTATUS\tLAST TRANSITION\tREASON\tMESSAGE")
+		for _, condition := range node.Status.Conditions {
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", condition.Type, condition.Status,
+				formatTime(condition.LastTransitionTime), condition.Reason, condition.Message)
+		}
+		w.Flush()
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+func nodeRoles(node corev1.Node) string {
+	var roles []string
+	for label := range node.Labels {
+		if strings.HasPrefix(label, nodeRoleLabelPrefix) {
+			roles = append(roles, strings.TrimPrefix(label, nodeRoleLabelPrefix))
+		}
+	}
+	if len(roles) == 0 {
+		return "<none>"
+	}
+	sort.Strings(roles)
+	return strings.Join(roles, ",")
+}
+
+// describePods summarizes the status of each pod and its containers, similar to kubectl describe pod
+func describePods(pods []corev1.Pod) []byte {
+	b := &bytes.Buffer{}
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
+	for _, pod := range pods {
+		fmt.Fprintf(b, "Name:        %s\n", pod.Name)
+		fmt.Fprintf(b, "Namespace:   %s\n", pod.Namespace)
+		fmt.Fprintf(b, "Node:        %s\n", pod.Spec.NodeName)
+		fmt.Fprintf(b, "Status:      %s\n", pod.Status.Phase)
+		if pod.Status.Reason != "" {
+			fmt.Fprintf(b, "Reason:      %s\n", pod.Status.Reason)
+		}
+		if pod.Status.Message != "" {
+			fmt.Fprintf(b, "Message:     %s\n", pod.Status.Message)
+		}
+		if pod.Status.StartTime != nil {
+			fmt.Fprintf(b, "Start Time:  %s\n", formatTime(*pod.Status.StartTime))
+		}
+		fmt.Fprintf(b, "IP:          %s\n", pod.Status.PodIP)
+		if pod.DeletionTimestamp != nil {
+			fmt.Fprintf(b, "Terminating: since %s\n", formatTime(*pod.DeletionTimestamp))
+		}
+		if len(pod.Status.Conditions) > 0 {
+			b.WriteString("Conditions:\n")
+			w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "  TYPE\tSTATUS\tREASON\tMESSAGE")
+			for _, condition := range pod.Status.Conditions {
+				fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+			}
+			w.Flush()
+		}
+		describeContainers(b, "Init Containers", pod.Spec.InitContainers, pod.Status.InitContainerStatuses)
+		describeContainers(b, "Containers", pod.Spec.Containers, pod.Status.ContainerStatuses)
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+func describeContainers(b *bytes.Buffer, title string, containers []corev1.Container, statuses []corev1.ContainerStatus) {
+	if len(containers) == 0 {
+		return
+	}
+	statusByName := make(map[string]corev1.ContainerStatus, len(statuses))
+	for _, status := range statuses {
+		statusByName[status.Name] = status
+	}
+	fmt.Fprintf(b, "%s:\n", title)
+	for _, container := range containers {
+		fmt.Fprintf(b, "  %s:\n", container.Name)
+		fmt.Fprintf(b, "    Image:         %s\n", container.Image)
+		status, ok := statusByName[container.Name]
+		if !ok {
+			b.WriteString("    State:         <unknown>\n")
+			continue
+		}
+		fmt.Fprintf(b, "    State:         %s\n", describeContainerState(status.State))
+		if status.LastTerminationState.Terminated != nil {
+			fmt.Fprintf(b, "    Last State:    %s\n", describeContainerState(status.LastTerminationState))
+		}
+		fmt.Fprintf(b, "    Ready:         %t\n", status.Ready)
+		fmt.Fprintf(b, "    Restart Count: %d\n", status.RestartCount)
+	}
+}
+
+func describeContainerState(state corev1.ContainerState) string {
+	switch {
+	case state.Running != nil:
+		return fmt.Sprintf("Running since %s", formatTime(state.Running.StartedAt))
+	case state.Waiting != nil:
+		return strings.TrimSpace(fmt.Sprintf("Waiting %s %s", state.Waiting.Reason, state.Waiting.Message))
+	case state.Terminated != nil:
+		return strings.TrimSpace(fmt.Sprintf("Terminated %s (exit code %d) at %s %s", state.Terminated.Reason,
+			state.Terminated.ExitCode, formatTime(state.Terminated.FinishedAt), state.Terminated.Message))
+	default:
+		return "<unknown>"
+	}
+}
+
+// describeEvents lists events oldest first, similar to kubectl get events
+func describeEvents(events []corev1.Event) []byte {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	b := &bytes.Buffer{}
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LAST SEEN\tTYPE\tREASON\tOBJECT\tCOUNT\tMESSAGE")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%d\t%s\n",
+			eventTime(event).UTC().Format(time.RFC3339),
+			event.Type,
+			event.Reason,
+			strings.ToLower(event.InvolvedObject.Kind),
+			event.InvolvedObject.Name,
+			event.Count,
+			strings.TrimSpace(event.Message))
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+// events report the time they were last seen in different fields depending on the api that created them
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	case !event.FirstTimestamp.IsZero():
+		return event.FirstTimestamp.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+func formatTime(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,342 @@
+package debugutils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	kubeerrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	eventCollectorStr = "eventCollector"
+
+	EventsTimelineTextFile = "events.txt"
+	EventsTimelineJsonFile = "events.json"
+)
+
+// The sources of the entries of a Timeline
+const (
+	TimelineSourceEvent     = "event"
+	TimelineSourcePodStatus = "status"
+)
+
+type EventCollector interface {
+	GetTimeline(ctx context.Context, resources kuberesource.UnstructuredResources) (*Timeline, error)
+	SaveTimeline(ctx context.Context, client StorageClient, location string, timeline *Timeline) error
+}
+
+// Timeline is the chronological history of a set of resources and their pods, built from their events and the
+// transitions recorded in the status of the pods
+type Timeline struct {
+	Entries []TimelineEntry `json:"entries"`
+}
+
+type TimelineEntry struct {
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	// Normal or Warning
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Message   string `json:"message,omitempty"`
+	// the number of times an event occurred
+	Count int32 `json:"count,omitempty"`
+	// the component which reported an event
+	Reporter string `json:"reporter,omitempty"`
+}
+
+type eventCollector struct {
+	kube      kubernetes.Interface
+	podFinder PodFinder
+}
+
+func NewEventCollector(kube kubernetes.Interface, podFinder PodFinder) *eventCollector {
+	return &eventCollector{
+		kube:      kube,
+		podFinder: podFinder,
+	}
+}
+
+func DefaultEventCollector() (*eventCollector, error) {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", eventCollectorStr)
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", eventCollectorStr)
+	}
+	return NewEventCollector(kube, NewLabelPodFinder(kube)), nil
+}
+
+// GetTimeline gathers the events of the given resources and of their pods, and merges them with the status
+// transitions of the pods
+func (ec *eventCollector) GetTimeline(ctx context.Context, resources kuberesource.UnstructuredResources) (*Timeline, error) {
+	podLists, err := ec.podFinder.GetPods(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+	var pods []corev1.Pod
+	for _, podList := range podLists {
+		pods = append(pods, podList.Items...)
+	}
+
+	involved := newInvolvedObjects()
+	namespaces := map[string]bool{}
+	for _, resource := range resources {
+		involved.add(resource.GetKind(), resource.GetNamespace(), resource.GetName(), resource.GetUID())
+		// events of cluster scoped resources are created in the default namespace, or any other
+		namespaces[resource.GetNamespace()] = true
+	}
+	for _, pod := range pods {
+		involved.add("Pod", pod.Namespace, pod.Name, pod.UID)
+		namespaces[pod.Namespace] = true
+	}
+	if namespaces[metav1.NamespaceAll] {
+		namespaces = map[string]bool{metav1.NamespaceAll: true}
+	}
+
+	timeline := &Timeline{}
+	for namespace := range namespaces {
+		entries, err := ec.eventEntries(ctx, namespace, involved)
+		if err != nil {
+			return nil, err
+		}
+		timeline.Entries = append(timeline.Entries, entries...)
+	}
+	for _, pod := range pods {
+		timeline.Entries = append(timeline.Entries, podStatusEntries(pod)...)
+	}
+	timeline.sort()
+	return timeline, nil
+}
+
+// the core and events.k8s.io apis serve the same events, so events are deduplicated by uid, preferring the
+// events.k8s.io version which also has the reporting controller and series
+func (ec *eventCollector) eventEntries(ctx context.Context, namespace string, involved *involvedObjects) ([]TimelineEntry, error) {
+	seen := map[types.UID]bool{}
+	var result []TimelineEntry
+
+	events, err := ec.kube.EventsV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	// clusters older than 1.19 don't serve events.k8s.io/v1
+	if err != nil && !kubeerrs.IsNotFound(err) {
+		return nil, eris.Wrapf(err, "unable to list events in namespace %s", namespace)
+	}
+	if err == nil {
+		for _, event := range events.Items {
+			seen[event.UID] = true
+			if involved.contains(event.Regarding) {
+				result = append(result, eventsV1Entry(event))
+			}
+		}
+	}
+
+	coreEvents, err := ec.kube.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to list events in namespace %s", namespace)
+	}
+	for _, event := range coreEvents.Items {
+		if !seen[event.UID] && involved.contains(event.InvolvedObject) {
+			result = append(result, coreEventEntry(event))
+		}
+	}
+	return result, nil
+}
+
+// SaveTimeline saves the timeline as a table to EventsTimelineTextFile and as json to EventsTimelineJsonFile
+func (ec *eventCollector) SaveTimeline(ctx context.Context, client StorageClient, location string, timeline *Timeline) error {
+	timelineJson, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return client.Save(location,
+		&StorageObject{
+			Resource: bytes.NewReader(timeline.Table()),
+			Name:     EventsTimelineTextFile,
+		},
+		&StorageObject{
+			Resource: bytes.NewReader(timelineJson),
+			Name:     EventsTimelineJsonFile,
+		},
+	)
+}
+
+// Table renders the timeline oldest first, similar to kubectl get events
+func (t *Timeline) Table() []byte {
+	b := &bytes.Buffer{}
+	w := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tTYPE\tREASON\tOBJECT\tMESSAGE")
+	for _, entry := range t.Entries {
+		message := entry.Message
+		if entry.Count > 1 {
+			message = fmt.Sprintf("%s (x%d)", message, entry.Count)
+		}
+		object := strings.ToLower(entry.Kind) + "/" + entry.Name
+		if entry.Namespace != "" {
+			object = strings.ToLower(entry.Kind) + "/" + entry.Namespace + "/" + entry.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.UTC().Format(time.RFC3339),
+			entry.Source,
+			entry.Type,
+			entry.Reason,
+			object,
+			message)
+	}
+	w.Flush()
+	return b.Bytes()
+}
+
+func (t *Timeline) sort() {
+	sort.SliceStable(t.Entries, func(i, j int) bool {
+		return t.Entries[i].Time.Before(t.Entries[j].Time)
+	})
+}
+
+// involvedObjects matches events to resources by uid, or by kind, namespace and name for resources from manifests,
+// which have no uid
+type involvedObjects struct {
+	uids  map[types.UID]bool
+	names map[string]bool
+}
+
+func newInvolvedObjects() *involvedObjects {
+	return &involvedObjects{
+		uids:  map[types.UID]bool{},
+		names: map[string]bool{},
+	}
+}
+
+func (o *involvedObjects) add(kind, namespace, name string, uid types.UID) {
+	if uid != "" {
+		o.uids[uid] = true
+	}
+	o.names[kind+"/"+namespace+"/"+name] = true
+}
+
+func (o *involvedObjects) contains(ref corev1.ObjectReference) bool {
+	if ref.UID != "" && o.uids[ref.UID] {
+		return true
+	}
+	return o.names[ref.Kind+"/"+ref.Namespace+"/"+ref.Name]
+}
+
+func coreEventEntry(event corev1.Event) TimelineEntry {
+	reporter := event.ReportingController
+	if reporter == "" {
+		reporter = event.Source.Component
+	}
+	return TimelineEntry{
+		Time:      eventTime(event),
+		Source:    TimelineSourceEvent,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Kind:      event.InvolvedObject.Kind,
+		Namespace: event.InvolvedObject.Namespace,
+		Name:      event.InvolvedObject.Name,
+		Message:   strings.TrimSpace(event.Message),
+		Count:     event.Count,
+		Reporter:  reporter,
+	}
+}
+
+func eventsV1Entry(event eventsv1.Event) TimelineEntry {
+	entry := TimelineEntry{
+		Source:    TimelineSourceEvent,
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Kind:      event.Regarding.Kind,
+		Namespace: event.Regarding.Namespace,
+		Name:      event.Regarding.Name,
+		Message:   strings.TrimSpace(event.Note),
+		Count:     event.DeprecatedCount,
+		Reporter:  event.ReportingController,
+	}
+	if entry.Reporter == "" {
+		entry.Reporter = event.DeprecatedSource.Component
+	}
+	switch {
+	case event.Series != nil:
+		entry.Time = event.Series.LastObservedTime.Time
+		entry.Count = event.Series.Count
+	case !event.DeprecatedLastTimestamp.IsZero():
+		entry.Time = event.DeprecatedLastTimestamp.Time
+	case !event.EventTime.IsZero():
+		entry.Time = event.EventTime.Time
+	default:
+		entry.Time = event.CreationTimestamp.Time
+	}
+	return entry
+}
+
+// podStatusEntries turns the timestamps recorded in the status of a pod into timeline entries, which are often the
+// only trace of a restart once its events have expired
+func podStatusEntries(pod corev1.Pod) []TimelineEntry {
+	newEntry := func(t time.Time, eventType, reason, message string) TimelineEntry {
+		return TimelineEntry{
+			Time:      t,
+			Source:    TimelineSourcePodStatus,
+			Type:      eventType,
+			Reason:    reason,
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Message:   message,
+		}
+	}
+
+	var result []TimelineEntry
+	if !pod.CreationTimestamp.IsZero() {
+		result = append(result, newEntry(pod.CreationTimestamp.Time, corev1.EventTypeNormal, "Created", ""))
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.LastTransitionTime.IsZero() {
+			continue
+		}
+		eventType := corev1.EventTypeNormal
+		if condition.Status == corev1.ConditionFalse {
+			eventType = corev1.EventTypeWarning
+		}
+		reason := fmt.Sprintf("%s=%s", condition.Type, condition.Status)
+		message := strings.TrimSpace(condition.Reason + " " + condition.Message)
+		result = append(result, newEntry(condition.LastTransitionTime.Time, eventType, reason, message))
+	}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		for _, state := range []corev1.ContainerState{status.LastTerminationState, status.State} {
+			if state.Running != nil && !state.Running.StartedAt.IsZero() {
+				result = append(result, newEntry(state.Running.StartedAt.Time, corev1.EventTypeNormal,
+					"ContainerStarted", "container "+status.Name))
+			}
+			if state.Terminated != nil && !state.Terminated.FinishedAt.IsZero() {
+				eventType := corev1.EventTypeNormal
+				if state.Terminated.ExitCode != 0 {
+					eventType = corev1.EventTypeWarning
+				}
+				message := strings.TrimSpace(fmt.Sprintf("container %s: %s (exit code %d) %s", status.Name,
+					state.Terminated.Reason, state.Terminated.ExitCode, state.Terminated.Message))
+				result = append(result, newEntry(state.Terminated.FinishedAt.Time, eventType, "ContainerTerminated", message))
+			}
+		}
+	}
+	if pod.DeletionTimestamp != nil {
+		result = append(result, newEntry(pod.DeletionTimestamp.Time, corev1.EventTypeNormal, "Terminating", ""))
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package debugutils
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/spf13/afero"
+	corev1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("event collector", func() {
+	var (
+		ctx       context.Context
+		podFinder *MockPodFinder
+		collector *eventCollector
+		pod       *corev1.Pod
+		start     time.Time
+	)
+
+	at := func(seconds int) metav1.Time {
+		return metav1.NewTime(start.Add(time.Duration(seconds) * time.Second))
+	}
+
+	BeforeEach(func() {
+		ctrl, ctx = gomock.WithContext(context.Background(), T)
+		start = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		pod = gatewayPod()
+		pod.UID = "gateway-uid"
+		pod.CreationTimestamp = at(0)
+		pod.Status.Conditions = []corev1.PodCondition{
+			{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: at(1)},
+			{Type: corev1.PodReady, Status: corev1.ConditionFalse, LastTransitionTime: at(40), Reason: "ContainersNotReady"},
+		}
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name: "gateway",
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{
+				StartedAt: at(50),
+			}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode:   1,
+				Reason:     "Error",
+				FinishedAt: at(30),
+			}},
+		}}
+
+		deploymentRef := corev1.ObjectReference{Kind: "Deployment", Namespace: pod.Namespace, Name: "gateway"}
+		podRef := corev1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: pod.UID}
+		kube := fake.NewClientset(
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "scaled", Namespace: pod.Namespace, UID: "scaled-uid"},
+				InvolvedObject: deploymentRef,
+				Reason:         "ScalingReplicaSet",
+				Message:        "Scaled up replica set gateway-5b4c7d8f9 to 1",
+				Type:           corev1.EventTypeNormal,
+				LastTimestamp:  at(-1),
+			},
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "unrelated", Namespace: pod.Namespace, UID: "unrelated-uid"},
+				InvolvedObject: corev1.ObjectReference{Kind: "Pod", Namespace: pod.Namespace, Name: "other"},
+				Reason:         "Pulled",
+				LastTimestamp:  at(2),
+			},
+			// served by both apis
+			&corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: "backoff", Namespace: pod.Namespace, UID: "backoff-uid"},
+				InvolvedObject: podRef,
+				Reason:         "BackOff",
+				Type:           corev1.EventTypeWarning,
+				LastTimestamp:  at(35),
+			},
+			&eventsv1.Event{
+				ObjectMeta:          metav1.ObjectMeta{Name: "backoff", Namespace: pod.Namespace, UID: "backoff-uid"},
+				Regarding:           podRef,
+				Reason:              "BackOff",
+				Note:                "Back-off restarting failed container",
+				Type:                corev1.EventTypeWarning,
+				ReportingController: "kubelet",
+				Series:              &eventsv1.EventSeries{Count: 3, LastObservedTime: metav1.NewMicroTime(at(35).Time)},
+			},
+		)
+		podFinder = NewMockPodFinder(ctrl)
+		collector = NewEventCollector(kube, podFinder)
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	getTimeline := func() *Timeline {
+		deployment := &unstructured.Unstructured{}
+		deployment.SetKind("Deployment")
+		deployment.SetAPIVersion("apps/v1")
+		deployment.SetNamespace(pod.Namespace)
+		deployment.SetName("gateway")
+		resources := kuberesource.UnstructuredResources{deployment}
+		podFinder.EXPECT().GetPods(ctx, resources).Return([]*corev1.PodList{{Items: []corev1.Pod{*pod}}}, nil)
+		timeline, err := collector.GetTimeline(ctx, resources)
+		Expect(err).NotTo(HaveOccurred())
+		return timeline
+	}
+
+	It("merges events and pod status transitions in chronological order", func() {
+		var reasons []string
+		for _, entry := range getTimeline().Entries {
+			reasons = append(reasons, entry.Source+" "+entry.Reason)
+		}
+		Expect(reasons).To(Equal([]string{
+			"event ScalingReplicaSet",
+			"status Created",
+			"status PodScheduled=True",
+			"status ContainerTerminated",
+			"event BackOff",
+			"status Ready=False",
+			"status ContainerStarted",
+		}))
+	})
+
+	It("prefers the events.k8s.io version of events", func() {
+		timeline := getTimeline()
+		Expect(timeline.Entries).To(ContainElement(TimelineEntry{
+			Time:      at(35).Time,
+			Source:    TimelineSourceEvent,
+			Type:      corev1.EventTypeWarning,
+			Reason:    "BackOff",
+			Kind:      "Pod",
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			Message:   "Back-off restarting failed container",
+			Count:     3,
+			Reporter:  "kubelet",
+		}))
+	})
+
+	It("saves the timeline as text and json", func() {
+		timeline := getTimeline()
+		fs := afero.NewMemMapFs()
+		Expect(collector.SaveTimeline(ctx, NewFileStorageClient(fs), "/bundle", timeline)).NotTo(HaveOccurred())
+
+		text, err := afero.ReadFile(fs, "/bundle/"+EventsTimelineTextFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(text)).To(ContainSubstring("Back-off restarting failed container (x3)"))
+		Expect(string(text)).To(ContainSubstring("container gateway: Error (exit code 1)"))
+
+		data, err := afero.ReadFile(fs, "/bundle/"+EventsTimelineJsonFile)
+		Expect(err).NotTo(HaveOccurred())
+		var saved Timeline
+		Expect(json.Unmarshal(data, &saved)).NotTo(HaveOccurred())
+		Expect(saved.Entries).To(HaveLen(len(timeline.Entries)))
+	})
+})
@@ -11,6 +11,7 @@ import (
 
 type NamespacedDumpCommandGenerator func(namespace string) []string
 
+// Deprecated: use BundleOnFail, which does not need kubectl or bash
 func KubeDumpOnFail(out io.Writer, namespaces []string, additionalCommands NamespacedDumpCommandGenerator) func() {
 	return func() {
 		PrintDockerState()
@@ -24,6 +25,8 @@ func KubeDumpOnFail(out io.Writer, namespaces []string, additionalCommands Names
 }
 
 // dump all data from the kube cluster
+//
+// Deprecated: use BundleCollector, which collects the same information natively instead of running bash commands
 func KubeDump(namespaces []string, additionalCommands NamespacedDumpCommandGenerator) (string, error) {
 	b := &bytes.Buffer{}
 	b.WriteString("** Begin Kubernetes Dump ** \n")
@@ -41,6 +44,7 @@ func KubeDump(namespaces []string, additionalCommands NamespacedDumpCommandGener
 	return b.String(), nil
 }
 
+// Deprecated: shells out to docker; use BundleCollector to collect the state of the cluster
 func PrintDockerState() {
 	dockerCmd := exec.Command("docker", "ps")
 
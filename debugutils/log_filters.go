@@ -0,0 +1,198 @@
+package debugutils
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogLevelUnknown LogLevel = iota
+	LogLevelDebug
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelFatal
+)
+
+var (
+	jsonLevelRegex   = regexp.MustCompile(`(?i)"(?:level|lvl|severity)"\s*:\s*"(\w+)"`)
+	logfmtLevelRegex = regexp.MustCompile(`(?i)\b(?:level|lvl|severity)="?(\w+)`)
+	klogLevelRegex   = regexp.MustCompile(`^([IWEF])\d{4} `)
+	klogLevels       = map[string]LogLevel{"I": LogLevelInfo, "W": LogLevelWarn, "E": LogLevelError, "F": LogLevelFatal}
+)
+
+// the number of leading fields of a line searched for a bare level, e.g. "2020-01-01T00:00:00Z INFO message"
+const levelSearchFields = 4
+
+// DetectLogLevel recognizes the level of json, logfmt, klog and plain text log lines
+func DetectLogLevel(line string) LogLevel {
+	if match := jsonLevelRegex.FindStringSubmatch(line); match != nil {
+		return parseLogLevel(match[1])
+	}
+	if match := logfmtLevelRegex.FindStringSubmatch(line); match != nil {
+		return parseLogLevel(match[1])
+	}
+	if match := klogLevelRegex.FindStringSubmatch(line); match != nil {
+		return klogLevels[match[1]]
+	}
+	fields := strings.Fields(line)
+	if len(fields) > levelSearchFields {
+		fields = fields[:levelSearchFields]
+	}
+	for _, field := range fields {
+		if level := parseLogLevel(strings.Trim(field, "[]():")); level != LogLevelUnknown {
+			return level
+		}
+	}
+	return LogLevelUnknown
+}
+
+func parseLogLevel(level string) LogLevel {
+	switch strings.ToLower(level) {
+	case "trace", "debug", "dbg":
+		return LogLevelDebug
+	case "info", "notice":
+		return LogLevelInfo
+	case "warn", "warning":
+		return LogLevelWarn
+	case "error", "err":
+		return LogLevelError
+	case "fatal", "panic", "dpanic", "critical", "crit":
+		return LogLevelFatal
+	default:
+		return LogLevelUnknown
+	}
+}
+
+// LogLineFilter selects the lines of streamed logs to keep. The zero value keeps every line.
+type LogLineFilter struct {
+	// if set, only lines matching at least one of these are kept
+	Include []*regexp.Regexp
+	// lines matching any of these are dropped
+	Exclude []*regexp.Regexp
+	// lines with a detected level below this are dropped. Lines without a recognizable level are kept, so that
+	// multi-line messages such as stack traces are not lost.
+	MinLevel LogLevel
+}
+
+func (f LogLineFilter) keep(line string) bool {
+	if len(f.Include) > 0 && !matchesAny(f.Include, line) {
+		return false
+	}
+	if matchesAny(f.Exclude, line) {
+		return false
+	}
+	if f.MinLevel != LogLevelUnknown {
+		if level := DetectLogLevel(line); level != LogLevelUnknown && level < f.MinLevel {
+			return false
+		}
+	}
+	return true
+}
+
+func (f LogLineFilter) isEmpty() bool {
+	return len(f.Include) == 0 && len(f.Exclude) == 0 && f.MinLevel == LogLevelUnknown
+}
+
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// logLineProcessor applies the time window, filter and redaction of a request to each streamed line
+type logLineProcessor struct {
+	until           time.Time
+	stripTimestamps bool
+	filter          LogLineFilter
+	redactor        LogRedactor
+}
+
+func (p *logLineProcessor) isNoop() bool {
+	return p.until.IsZero() && !p.stripTimestamps && p.filter.isEmpty() && p.redactor == nil
+}
+
+// returns the processed line, whether to keep it, and whether the end of the time window has been reached
+func (p *logLineProcessor) process(line string) (string, bool, bool) {
+	text := strings.TrimSuffix(line, "\n")
+	if !p.until.IsZero() || p.stripTimestamps {
+		// lines are prefixed with an RFC3339 timestamp when timestamps are requested
+		timestamp, rest, found := strings.Cut(text, " ")
+		if found {
+			if ts, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+				if !p.until.IsZero() && ts.After(p.until) {
+					return "", false, true
+				}
+				if p.stripTimestamps {
+					text = rest
+				}
+			}
+		}
+	}
+	if !p.filter.keep(text) {
+		return "", false, false
+	}
+	if p.redactor != nil {
+		text = p.redactor.Redact(text)
+	}
+	if strings.HasSuffix(line, "\n") {
+		text += "\n"
+	}
+	return text, true, false
+}
+
+// processedLogReader applies a logLineProcessor to a log stream as it is read
+type processedLogReader struct {
+	source    io.ReadCloser
+	lines     *bufio.Reader
+	processor *logLineProcessor
+	pending   []byte
+	err       error
+}
+
+func newProcessedLogReader(source io.ReadCloser, processor *logLineProcessor) io.ReadCloser {
+	if processor.isNoop() {
+		return source
+	}
+	return &processedLogReader{
+		source:    source,
+		lines:     bufio.NewReader(source),
+		processor: processor,
+	}
+}
+
+func (r *processedLogReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		line, err := r.lines.ReadString('\n')
+		r.err = err
+		if line == "" {
+			continue
+		}
+		processed, keep, done := r.processor.process(line)
+		if done {
+			r.err = io.EOF
+			continue
+		}
+		if keep {
+			r.pending = []byte(processed)
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *processedLogReader) Close() error {
+	return r.source.Close()
+}
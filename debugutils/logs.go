@@ -70,8 +70,43 @@ func (lc *logCollector) SaveLogs(ctx context.Context, storageClient StorageClien
 }
 
 type LogRequestBuilder struct {
-	clientset corev1client.CoreV1Interface
-	podFinder PodFinder
+	clientset  corev1client.CoreV1Interface
+	podFinder  PodFinder
+	selection  LogSelection
+	lineFilter LogLineFilter
+	redactor   LogRedactor
+}
+
+// LogSelection chooses which logs to request for each pod, in addition to the logs of its containers
+type LogSelection struct {
+	// init containers are included by default
+	SkipInitContainers  bool
+	EphemeralContainers bool
+	// also request the logs of the previous instance of every container that has restarted, e.g. to debug a crash loop
+	PreviousIfRestarted bool
+	// restricts the logs of each pod to a time range, overriding LogsSince
+	Window LogWindow
+}
+
+// A LogWindow returns the time range of logs to request for a pod. A zero time leaves that end of the range open.
+type LogWindow func(pod corev1.Pod) (since, until time.Time)
+
+// FixedLogWindow requests the same time range for every pod
+func FixedLogWindow(since, until time.Time) LogWindow {
+	return func(pod corev1.Pod) (time.Time, time.Time) {
+		return since, until
+	}
+}
+
+// PodStartLogWindow requests the logs written in the given duration after each pod started
+func PodStartLogWindow(duration time.Duration) LogWindow {
+	return func(pod corev1.Pod) (time.Time, time.Time) {
+		start := pod.CreationTimestamp.Time
+		if pod.Status.StartTime != nil {
+			start = pod.Status.StartTime.Time
+		}
+		return start, start.Add(duration)
+	}
 }
 
 type LogRequestOptions func(options *corev1.PodLogOptions)
@@ -95,6 +130,28 @@ func NewLogRequestBuilder(clientset corev1client.CoreV1Interface, podFinder PodF
 	return &LogRequestBuilder{clientset: clientset, podFinder: podFinder}
 }
 
+// WithSelection returns a copy of the builder which requests the given logs
+func (lrb *LogRequestBuilder) WithSelection(selection LogSelection) *LogRequestBuilder {
+	result := *lrb
+	result.selection = selection
+	return &result
+}
+
+// WithLineFilter returns a copy of the builder which filters the lines of streamed logs
+func (lrb *LogRequestBuilder) WithLineFilter(filter LogLineFilter) *LogRequestBuilder {
+	result := *lrb
+	result.lineFilter = filter
+	return &result
+}
+
+// WithRedactor returns a copy of the builder which redacts secrets from streamed logs. A nil redactor disables redaction.
+func (lrb *LogRequestBuilder) WithRedactor(redactor LogRedactor) *LogRequestBuilder {
+	result := *lrb
+	result.redactor = redactor
+	return &result
+}
+
+// DefaultLogRequestBuilder redacts secrets from logs with DefaultRedactor
 func DefaultLogRequestBuilder() (*LogRequestBuilder, error) {
 	cfg, err := kubeutils.GetConfig("", "")
 	if err != nil {
@@ -111,6 +168,7 @@ func DefaultLogRequestBuilder() (*LogRequestBuilder, error) {
 	return &LogRequestBuilder{
 		clientset: clientset,
 		podFinder: podFinder,
+		redactor:  DefaultRedactor(),
 	}, nil
 }
 
@@ -142,15 +200,75 @@ func (lrb *LogRequestBuilder) buildLogsRequest(pod corev1.Pod, optsFunc ...LogRe
 			f(opts)
 		}
 	}
+	var until time.Time
+	if lrb.selection.Window != nil {
+		var since time.Time
+		since, until = lrb.selection.Window(pod)
+		if !since.IsZero() {
+			opts.SinceTime = &metav1.Time{Time: since}
+			opts.SinceSeconds = nil
+		}
+	}
+	// the api can't end logs at a given time, so request timestamps to find the end of the window while streaming
+	stripTimestamps := false
+	if !until.IsZero() && !opts.Timestamps {
+		opts.Timestamps = true
+		stripTimestamps = true
+	}
+	restartCounts := containerRestartCounts(pod)
+	for _, container := range lrb.selectedContainers(pod) {
+		result = append(result, lrb.newLogsRequest(pod, container, *opts, until, stripTimestamps))
+		if lrb.selection.PreviousIfRestarted && !opts.Previous && restartCounts[container] > 0 {
+			previousOpts := *opts
+			previousOpts.Previous = true
+			result = append(result, lrb.newLogsRequest(pod, container, previousOpts, until, stripTimestamps))
+		}
+	}
+	return result
+}
+
+func (lrb *LogRequestBuilder) newLogsRequest(pod corev1.Pod, container string, opts corev1.PodLogOptions, until time.Time, stripTimestamps bool) *LogsRequest {
+	opts.Container = container
+	return &LogsRequest{
+		LogMeta: LogMeta{
+			PodMeta:       pod.ObjectMeta,
+			ContainerName: container,
+			Previous:      opts.Previous,
+		},
+		Request:         lrb.clientset.Pods(pod.Namespace).GetLogs(pod.Name, &opts),
+		until:           until,
+		stripTimestamps: stripTimestamps,
+	}
+}
+
+func (lrb *LogRequestBuilder) selectedContainers(pod corev1.Pod) []string {
+	var result []string
 	for _, v := range pod.Spec.Containers {
-		opts.Container = v.Name
-		request := lrb.clientset.Pods(pod.Namespace).GetLogs(pod.Name, opts)
-		result = append(result, NewLogsRequest(pod.ObjectMeta, v.Name, request))
+		result = append(result, v.Name)
 	}
-	for _, v := range pod.Spec.InitContainers {
-		opts.Container = v.Name
-		request := lrb.clientset.Pods(pod.Namespace).GetLogs(pod.Name, opts)
-		result = append(result, NewLogsRequest(pod.ObjectMeta, v.Name, request))
+	if !lrb.selection.SkipInitContainers {
+		for _, v := range pod.Spec.InitContainers {
+			result = append(result, v.Name)
+		}
+	}
+	if lrb.selection.EphemeralContainers {
+		for _, v := range pod.Spec.EphemeralContainers {
+			result = append(result, v.Name)
+		}
+	}
+	return result
+}
+
+func containerRestartCounts(pod corev1.Pod) map[string]int32 {
+	result := map[string]int32{}
+	for _, statuses := range [][]corev1.ContainerStatus{
+		pod.Status.ContainerStatuses,
+		pod.Status.InitContainerStatuses,
+		pod.Status.EphemeralContainerStatuses,
+	} {
+		for _, status := range statuses {
+			result[status.Name] = status.RestartCount
+		}
 	}
 	return result
 }
@@ -167,13 +285,16 @@ func (lc LogRequestBuilder) StreamLogs(ctx context.Context, requests []*LogsRequ
 			if err != nil {
 				return err
 			}
+			reader = newProcessedLogReader(reader, &logLineProcessor{
+				until:           restRequest.until,
+				stripTimestamps: restRequest.stripTimestamps,
+				filter:          lc.lineFilter,
+				redactor:        lc.redactor,
+			})
 			lock.Lock()
 			defer lock.Unlock()
 			result = append(result, &LogsResponse{
-				LogMeta: LogMeta{
-					PodMeta:       restRequest.PodMeta,
-					ContainerName: restRequest.ContainerName,
-				},
+				LogMeta:  restRequest.LogMeta,
 				Response: reader,
 			})
 			return nil
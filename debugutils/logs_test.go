@@ -3,7 +3,11 @@ package debugutils
 import (
 	"context"
 	"errors"
+	"io"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
@@ -79,6 +83,48 @@ var _ = Describe("logs unit tests", func() {
 			Expect(requests[1].ContainerName).To(Equal(initContainerName))
 		})
 
+		It("can skip init containers and include ephemeral containers", func() {
+			pod := gatewayPod()
+			pod.Spec.InitContainers = []corev1.Container{{Name: "init-container"}}
+			pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debugger"}}}
+			requests := requestBuilder.WithSelection(LogSelection{
+				SkipInitContainers:  true,
+				EphemeralContainers: true,
+			}).buildLogsRequest(*pod)
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[0].ContainerName).To(Equal("gateway"))
+			Expect(requests[1].ContainerName).To(Equal("debugger"))
+		})
+
+		It("requests the previous logs of containers that have restarted", func() {
+			pod := gatewayPod()
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "gateway", RestartCount: 2}}
+			requests := requestBuilder.WithSelection(LogSelection{PreviousIfRestarted: true}).buildLogsRequest(*pod)
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[0].Previous).To(BeFalse())
+			Expect(requests[1].Previous).To(BeTrue())
+			Expect(requests[1].ResourceId()).To(Equal("gloo-system_" + pod.Name + "_gateway_previous.log"))
+
+			pod.Status.ContainerStatuses[0].RestartCount = 0
+			requests = requestBuilder.WithSelection(LogSelection{PreviousIfRestarted: true}).buildLogsRequest(*pod)
+			Expect(requests).To(HaveLen(1))
+		})
+
+		It("applies a time window to each pod", func() {
+			fake := &testing.Fake{}
+			since := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+			builder := NewLogRequestBuilder(&fakecorev1.FakeCoreV1{Fake: fake}, podFinder).
+				WithSelection(LogSelection{Window: FixedLogWindow(since, since.Add(time.Minute))})
+			requests := builder.buildLogsRequest(*gatewayPod(), LogsSince(since.Add(-time.Hour)))
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].until).To(Equal(since.Add(time.Minute)))
+			Expect(requests[0].stripTimestamps).To(BeTrue())
+			Expect(fake.Actions()).To(HaveLen(1))
+			opts := fake.Actions()[0].(testing.GenericActionImpl).Value.(*corev1.PodLogOptions)
+			Expect(opts.SinceTime.Time).To(Equal(since))
+			Expect(opts.Timestamps).To(BeTrue())
+		})
+
 	})
 
 	Context("Log collector", func() {
@@ -129,6 +175,23 @@ var _ = Describe("logs unit tests", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("filters and redacts streamed logs", func() {
+			lc = NewLogCollector(requestBuilder.
+				WithLineFilter(LogLineFilter{Exclude: []*regexp.Regexp{regexp.MustCompile("healthz")}}).
+				WithRedactor(DefaultLogRedactor()))
+			request := NewMockResponseWrapper(ctrl)
+			request.EXPECT().Stream(gomock.Any()).Return(io.NopCloser(strings.NewReader(
+				"GET /healthz 200\nlogin with password=hunter2\n")), nil)
+			var saved string
+			sc.EXPECT().Save("location", gomock.Any()).DoAndReturn(func(_ string, objects ...*StorageObject) error {
+				data, err := io.ReadAll(objects[0].Resource)
+				saved = string(data)
+				return err
+			})
+			Expect(lc.SaveLogs(ctx, sc, "location", []*LogsRequest{{Request: request}})).NotTo(HaveOccurred())
+			Expect(saved).To(Equal("login with password=" + RedactedValue + "\n"))
+		})
+
 	})
 
 })
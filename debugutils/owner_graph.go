@@ -0,0 +1,300 @@
+package debugutils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/go-utils/contextutils"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	ownerGraphPodFinderStr = "ownerGraphPodFinder"
+
+	// guards against ownership cycles, which the api server does not prevent
+	maxOwnerDepth = 16
+)
+
+// OwnerGraphPodFinder finds the pods of any resource by following the ownerReferences of every pod in the
+// resource's namespace up to the resource, e.g. Deployment -> ReplicaSet -> Pod, CronJob -> Job -> Pod or
+// custom resource -> StatefulSet -> Pod. Unlike LabelPodFinder, it doesn't need to know how each kind selects its pods.
+type OwnerGraphPodFinder struct {
+	kube          kubernetes.Interface
+	dynamicClient dynamic.Interface
+	restMapper    meta.RESTMapper
+}
+
+func NewOwnerGraphPodFinder(kube kubernetes.Interface, dynamicClient dynamic.Interface, restMapper meta.RESTMapper) *OwnerGraphPodFinder {
+	return &OwnerGraphPodFinder{
+		kube:          kube,
+		dynamicClient: dynamicClient,
+		restMapper:    restMapper,
+	}
+}
+
+func DefaultOwnerGraphPodFinder() (*OwnerGraphPodFinder, error) {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", ownerGraphPodFinderStr)
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", ownerGraphPodFinderStr)
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", ownerGraphPodFinderStr)
+	}
+	httpClient := http.Client{}
+	restMapper, err := apiutil.NewDynamicRESTMapper(cfg, &httpClient)
+	if err != nil {
+		return nil, eris.Wrapf(err, "unable to initialize %s", ownerGraphPodFinderStr)
+	}
+	return NewOwnerGraphPodFinder(kube, dynamicClient, restMapper), nil
+}
+
+// GetPods returns one list of pods per resource, in the same order as the resources
+func (f *OwnerGraphPodFinder) GetPods(ctx context.Context, resources kuberesource.UnstructuredResources) ([]*corev1.PodList, error) {
+	graph, err := f.OwnerGraph(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*corev1.PodList, 0, len(graph.Roots))
+	for _, root := range graph.Roots {
+		list := &corev1.PodList{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "List",
+				APIVersion: "v1",
+			},
+		}
+		list.Items = append(list.Items, graph.pods[root]...)
+		result = append(result, list)
+	}
+	return result, nil
+}
+
+// OwnerGraph returns the ownership tree below each resource, down to its pods
+func (f *OwnerGraphPodFinder) OwnerGraph(ctx context.Context, resources kuberesource.UnstructuredResources) (*OwnerGraph, error) {
+	pods, err := f.listPods(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+	walker := &ownerWalker{
+		finder: f,
+		owners: map[types.UID]*unstructured.Unstructured{},
+		nodes:  map[*OwnerNode]map[types.UID]*OwnerNode{},
+	}
+	graph := &OwnerGraph{pods: map[*OwnerNode][]corev1.Pod{}}
+	roots := make(map[ownerKey]*OwnerNode, len(resources))
+	for _, resource := range resources {
+		root := newOwnerNode(resource)
+		graph.Roots = append(graph.Roots, root)
+		roots[keyOf(resource)] = root
+	}
+
+	for _, pod := range pods {
+		unstructuredPod, err := kuberesource.ConvertToUnstructured(&pod)
+		if err != nil {
+			return nil, err
+		}
+		unstructuredPod.SetKind("Pod")
+		unstructuredPod.SetAPIVersion("v1")
+
+		// walk all the way up from the pod, adding the path below every root on the way to the tree
+		chain := []*unstructured.Unstructured{unstructuredPod}
+		for current := unstructuredPod; current != nil && len(chain) <= maxOwnerDepth; {
+			if root, ok := roots[keyOf(current)]; ok {
+				walker.attach(root, chain[:len(chain)-1])
+				graph.pods[root] = append(graph.pods[root], pod)
+			}
+			current = walker.controller(ctx, current)
+			if current != nil {
+				chain = append(chain, current)
+			}
+		}
+	}
+	return graph, nil
+}
+
+func (f *OwnerGraphPodFinder) listPods(ctx context.Context, resources kuberesource.UnstructuredResources) ([]corev1.Pod, error) {
+	namespaces := map[string]bool{}
+	for _, resource := range resources {
+		// cluster scoped resources can own pods in any namespace
+		namespaces[resource.GetNamespace()] = true
+	}
+	if namespaces[metav1.NamespaceAll] {
+		namespaces = map[string]bool{metav1.NamespaceAll: true}
+	}
+	var result []corev1.Pod
+	for namespace := range namespaces {
+		list, err := f.kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, eris.Wrapf(err, "unable to list pods in namespace %s", namespace)
+		}
+		result = append(result, list.Items...)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// ownerWalker caches the owners fetched while building a graph, as many pods share the same owners
+type ownerWalker struct {
+	finder *OwnerGraphPodFinder
+	owners map[types.UID]*unstructured.Unstructured
+	// the nodes of the tree below each root
+	nodes map[*OwnerNode]map[types.UID]*OwnerNode
+}
+
+// returns the controlling owner of a resource, or its first owner if none is marked as the controller
+func (w *ownerWalker) controller(ctx context.Context, resource *unstructured.Unstructured) *unstructured.Unstructured {
+	refs := resource.GetOwnerReferences()
+	if len(refs) == 0 {
+		return nil
+	}
+	ref := refs[0]
+	for _, candidate := range refs {
+		if candidate.Controller != nil && *candidate.Controller {
+			ref = candidate
+			break
+		}
+	}
+	if owner, ok := w.owners[ref.UID]; ok {
+		return owner
+	}
+	owner, err := w.get(ctx, ref, resource.GetNamespace())
+	if err != nil {
+		contextutils.LoggerFrom(ctx).Debugw("unable to get owner, stopping at this resource",
+			zap.String("kind", ref.Kind),
+			zap.String("name", ref.Name),
+			zap.Error(err))
+		owner = nil
+	}
+	w.owners[ref.UID] = owner
+	return owner
+}
+
+func (w *ownerWalker) get(ctx context.Context, ref metav1.OwnerReference, namespace string) (*unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := w.finder.restMapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		// owners of namespaced resources may be cluster scoped, but not the other way around
+		return w.finder.dynamicClient.Resource(mapping.Resource).Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	return w.finder.dynamicClient.Resource(mapping.Resource).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+}
+
+// adds the chain of resources from a pod up to the direct child of root to the tree
+func (w *ownerWalker) attach(root *OwnerNode, chain []*unstructured.Unstructured) {
+	nodes, ok := w.nodes[root]
+	if !ok {
+		nodes = map[types.UID]*OwnerNode{}
+		w.nodes[root] = nodes
+	}
+	parent := root
+	for i := len(chain) - 1; i >= 0; i-- {
+		node, ok := nodes[chain[i].GetUID()]
+		if !ok {
+			node = newOwnerNode(chain[i])
+			nodes[chain[i].GetUID()] = node
+			parent.Children = append(parent.Children, node)
+		}
+		parent = node
+	}
+}
+
+// resources are identified by group, kind, namespace and name, as the resources given to a pod finder are often
+// rendered manifests which have no uid and may use an older api version
+type ownerKey struct {
+	group, kind, namespace, name string
+}
+
+func keyOf(resource *unstructured.Unstructured) ownerKey {
+	gvk := resource.GroupVersionKind()
+	return ownerKey{group: gvk.Group, kind: gvk.Kind, namespace: resource.GetNamespace(), name: resource.GetName()}
+}
+
+// OwnerGraph is the ownership tree below each of the resources given to OwnerGraphPodFinder.OwnerGraph
+type OwnerGraph struct {
+	Roots []*OwnerNode
+
+	// the pods below each root
+	pods map[*OwnerNode][]corev1.Pod
+}
+
+type OwnerNode struct {
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	UID        types.UID
+	Children   []*OwnerNode
+}
+
+func newOwnerNode(resource *unstructured.Unstructured) *OwnerNode {
+	return &OwnerNode{
+		APIVersion: resource.GetAPIVersion(),
+		Kind:       resource.GetKind(),
+		Namespace:  resource.GetNamespace(),
+		Name:       resource.GetName(),
+		UID:        resource.GetUID(),
+	}
+}
+
+func (n *OwnerNode) String() string {
+	if n.Namespace == "" {
+		return fmt.Sprintf("%s %s", n.Kind, n.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", n.Kind, n.Namespace, n.Name)
+}
+
+// String renders the graph as a tree, e.g.
+//
+//	Deployment gloo-system/gateway
+//	└── ReplicaSet gloo-system/gateway-5b4c7d8f9
+//	    └── Pod gloo-system/gateway-5b4c7d8f9-x2x7z
+func (g *OwnerGraph) String() string {
+	b := &strings.Builder{}
+	for _, root := range g.Roots {
+		b.WriteString(root.String())
+		b.WriteString("\n")
+		writeOwnerChildren(b, root, "")
+	}
+	return b.String()
+}
+
+func writeOwnerChildren(b *strings.Builder, node *OwnerNode, indent string) {
+	for i, child := range node.Children {
+		branch, nextIndent := "├── ", indent+"│   "
+		if i == len(node.Children)-1 {
+			branch, nextIndent = "└── ", indent+"    "
+		}
+		b.WriteString(indent + branch + child.String() + "\n")
+		writeOwnerChildren(b, child, nextIndent)
+	}
+}
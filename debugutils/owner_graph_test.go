@@ -0,0 +1,159 @@
+package debugutils
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("owner graph pod finder", func() {
+	var (
+		ctx    context.Context
+		finder *OwnerGraphPodFinder
+	)
+
+	var (
+		deploymentGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+		replicaSetGVK = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "ReplicaSet"}
+		cronJobGVK    = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}
+		jobGVK        = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+		widgetGVK     = schema.GroupVersionKind{Group: "example.solo.io", Version: "v1", Kind: "Widget"}
+		statefulGVK   = schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}
+	)
+
+	ownerRef := func(owner *unstructured.Unstructured) metav1.OwnerReference {
+		controller := true
+		return metav1.OwnerReference{
+			APIVersion: owner.GetAPIVersion(),
+			Kind:       owner.GetKind(),
+			Name:       owner.GetName(),
+			UID:        owner.GetUID(),
+			Controller: &controller,
+		}
+	}
+
+	resource := func(gvk schema.GroupVersionKind, name string, owner *unstructured.Unstructured) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace("gloo-system")
+		obj.SetName(name)
+		obj.SetUID(types.UID(name + "-uid"))
+		if owner != nil {
+			obj.SetOwnerReferences([]metav1.OwnerReference{ownerRef(owner)})
+		}
+		return obj
+	}
+
+	pod := func(name string, owner *unstructured.Unstructured) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "gloo-system",
+				Name:      name,
+				UID:       types.UID(name + "-uid"),
+			},
+		}
+		if owner != nil {
+			p.OwnerReferences = []metav1.OwnerReference{ownerRef(owner)}
+		}
+		return p
+	}
+
+	// rendered manifests have no uid
+	manifest := func(gvk schema.GroupVersionKind, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetNamespace("gloo-system")
+		obj.SetName(name)
+		return obj
+	}
+
+	var (
+		deployment = resource(deploymentGVK, "gateway", nil)
+		replicaSet = resource(replicaSetGVK, "gateway-5b4c7d8f9", deployment)
+		cronJob    = resource(cronJobGVK, "cleanup", nil)
+		job        = resource(jobGVK, "cleanup-28000000", cronJob)
+		widget     = resource(widgetGVK, "my-widget", nil)
+		stateful   = resource(statefulGVK, "my-widget-db", widget)
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		kube := fake.NewClientset(
+			pod("gateway-5b4c7d8f9-a", replicaSet),
+			pod("gateway-5b4c7d8f9-b", replicaSet),
+			pod("cleanup-28000000-x", job),
+			pod("my-widget-db-0", stateful),
+			pod("standalone", nil),
+		)
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{
+				{Group: "example.solo.io", Version: "v1", Resource: "widgets"}: "WidgetList",
+			},
+			deployment, replicaSet, cronJob, job, widget, stateful)
+		restMapper := meta.NewDefaultRESTMapper(nil)
+		for _, gvk := range []schema.GroupVersionKind{deploymentGVK, replicaSetGVK, cronJobGVK, jobGVK, widgetGVK, statefulGVK} {
+			restMapper.Add(gvk, meta.RESTScopeNamespace)
+		}
+		finder = NewOwnerGraphPodFinder(kube, dynamicClient, restMapper)
+	})
+
+	podNames := func(list *corev1.PodList) []string {
+		var names []string
+		for _, p := range list.Items {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+
+	It("finds the pods of every resource through their owners", func() {
+		resources := kuberesource.UnstructuredResources{
+			manifest(deploymentGVK, "gateway"),
+			manifest(cronJobGVK, "cleanup"),
+			manifest(widgetGVK, "my-widget"),
+			manifest(replicaSetGVK, "gateway-5b4c7d8f9"),
+			manifest(corev1.SchemeGroupVersion.WithKind("Pod"), "standalone"),
+		}
+		lists, err := finder.GetPods(ctx, resources)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lists).To(HaveLen(5))
+		Expect(podNames(lists[0])).To(Equal([]string{"gateway-5b4c7d8f9-a", "gateway-5b4c7d8f9-b"}))
+		Expect(podNames(lists[1])).To(Equal([]string{"cleanup-28000000-x"}))
+		Expect(podNames(lists[2])).To(Equal([]string{"my-widget-db-0"}))
+		Expect(podNames(lists[3])).To(Equal([]string{"gateway-5b4c7d8f9-a", "gateway-5b4c7d8f9-b"}))
+		Expect(podNames(lists[4])).To(Equal([]string{"standalone"}))
+	})
+
+	It("stops at owners which cannot be found", func() {
+		lists, err := finder.GetPods(ctx, kuberesource.UnstructuredResources{manifest(deploymentGVK, "missing")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lists).To(HaveLen(1))
+		Expect(lists[0].Items).To(BeEmpty())
+	})
+
+	It("renders the ownership tree", func() {
+		graph, err := finder.OwnerGraph(ctx, kuberesource.UnstructuredResources{
+			manifest(deploymentGVK, "gateway"),
+			manifest(widgetGVK, "my-widget"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(graph.String()).To(Equal(`Deployment gloo-system/gateway
+└── ReplicaSet gloo-system/gateway-5b4c7d8f9
+    ├── Pod gloo-system/gateway-5b4c7d8f9-a
+    └── Pod gloo-system/gateway-5b4c7d8f9-b
+Widget gloo-system/my-widget
+└── StatefulSet gloo-system/my-widget-db
+    └── Pod gloo-system/my-widget-db-0
+`))
+	})
+})
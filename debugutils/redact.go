@@ -0,0 +1,68 @@
+package debugutils
+
+import (
+	"regexp"
+	"strings"
+)
+
+const RedactedValue = "[REDACTED]"
+
+// The first capture group of each pattern is the secret to redact
+var DefaultRedactionPatterns = []*regexp.Regexp{
+	// authorization headers, e.g. "Authorization: Bearer <token>" or "authorization":"Basic <credentials>"
+	regexp.MustCompile(`(?i)\bauthorization"?\s*[:=]\s*"?(?:basic|bearer|token)?\s*([^\s",]+)`),
+	regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	// key value pairs in plain text, logfmt, json and yaml, e.g. password=<secret> or "client_secret": "<secret>"
+	regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key)"?\s*[:=]\s*"?([^\s",&]+)`),
+	// credentials in urls, e.g. https://user:<password>@host
+	regexp.MustCompile(`://[^/\s:@]+:([^/\s@]+)@`),
+	// aws access key ids
+	regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`),
+	// json web tokens
+	regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+)`),
+}
+
+type LogRedactor interface {
+	Redact(line string) string
+}
+
+// RegexRedactor replaces the first capture group of every match of its patterns with RedactedValue
+type RegexRedactor struct {
+	Patterns []*regexp.Regexp
+}
+
+func NewRegexRedactor(patterns ...*regexp.Regexp) *RegexRedactor {
+	return &RegexRedactor{Patterns: patterns}
+}
+
+// DefaultLogRedactor redacts bearer tokens, passwords, api keys and other common secrets
+func DefaultLogRedactor() *RegexRedactor {
+	return NewRegexRedactor(DefaultRedactionPatterns...)
+}
+
+func (r *RegexRedactor) Redact(line string) string {
+	for _, pattern := range r.Patterns {
+		line = redactGroup(pattern, line)
+	}
+	return line
+}
+
+func redactGroup(pattern *regexp.Regexp, line string) string {
+	matches := pattern.FindAllStringSubmatchIndex(line, -1)
+	if len(matches) == 0 {
+		return line
+	}
+	b := &strings.Builder{}
+	last := 0
+	for _, match := range matches {
+		// match[2:4] is the first capture group, which is -1 if it did not participate in the match
+		if len(match) < 4 || match[2] < 0 {
+			continue
+		}
+		b.WriteString(line[last:match[2]])
+		b.WriteString(RedactedValue)
+		last = match[3]
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package debugutils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type RedactionAction int
+
+const (
+	// replace values with RedactedValue
+	RedactionReplace RedactionAction = iota
+	// replace values with a truncated sha256 of the value, so that values can still be compared across resources and
+	// bundles. Short values such as passwords can be recovered from their hash by brute force, use RedactionReplace
+	// for them when bundles are shared publicly.
+	RedactionHash
+	// redact only the secrets found in values by the text patterns of the Redactor, e.g. for config files in config maps
+	RedactionPatterns
+)
+
+var (
+	// matches the names of keys and env vars which usually hold secrets, e.g. password, DB_PASSWORD, client-secret
+	// or apiToken, but not secretName
+	DefaultSensitiveKeyPattern = regexp.MustCompile(
+		`^(?:.*[-_.])?(?i:password|passwd|pwd|secret|token|api[-_]?key|access[-_]?key|private[-_]?key|credentials?)$` +
+			`|^[a-z][a-zA-Z0-9]*(?:Password|Secret|Token|ApiKey|AccessKey|PrivateKey|Credentials?)$`)
+
+	secretGVK    = schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	configMapGVK = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+	// the last applied configuration holds a copy of the whole resource, including any secret it contains
+	lastAppliedConfigPath = `metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']`
+
+	// DefaultRedactionRules hash the values of secrets, replace values with sensitive key names and redact secrets
+	// found in the data of config maps
+	DefaultRedactionRules = []RedactionRule{
+		{GVK: secretGVK, Path: "data.*", Action: RedactionHash},
+		{GVK: secretGVK, Path: "stringData.*", Action: RedactionHash},
+		{GVK: secretGVK, Path: lastAppliedConfigPath, Action: RedactionReplace},
+		{KeyPattern: DefaultSensitiveKeyPattern, Action: RedactionReplace},
+		{GVK: configMapGVK, Path: "data.*", Action: RedactionPatterns},
+		{Path: lastAppliedConfigPath, Action: RedactionPatterns},
+	}
+)
+
+var InvalidRedactionPathError = func(path string, err error) error {
+	return eris.Wrapf(err, "invalid redaction path %s", path)
+}
+
+// RedactionRule selects the values of resources to redact
+type RedactionRule struct {
+	// the resources the rule applies to. An empty group, version or kind matches any, so the zero value matches all
+	// resources. Core resources can't be told apart from resources of any group, e.g. {Version: "v1", Kind: "Secret"}
+	// also matches Secrets of other groups.
+	GVK schema.GroupVersionKind
+	// a JSONPath to the values to redact, e.g. "data.*", "spec.containers[*].env[0].value" or
+	// "metadata.annotations['example.com/token']". A wildcard matches every key of a map and every item of a list.
+	// Every string in the selected values is redacted, unless KeyPattern is set. An empty path selects the whole resource.
+	Path string
+	// if set, only the values of the keys matching this below Path are redacted, as well as the value of name/value
+	// pairs whose name matches, e.g. the env vars of containers
+	KeyPattern *regexp.Regexp
+	Action     RedactionAction
+}
+
+func (r RedactionRule) matches(gvk schema.GroupVersionKind) bool {
+	return (r.GVK.Group == "" || r.GVK.Group == gvk.Group) &&
+		(r.GVK.Version == "" || r.GVK.Version == gvk.Version) &&
+		(r.GVK.Kind == "" || r.GVK.Kind == gvk.Kind)
+}
+
+type ResourceRedactor interface {
+	RedactResource(resource *unstructured.Unstructured) (*unstructured.Unstructured, error)
+}
+
+// Redactor is the redaction pipeline of the debug collectors. It redacts the values selected by its rules from
+// collected resources, and the secrets found by its text redactor from logs.
+type Redactor struct {
+	Rules []RedactionRule
+	// redacts log lines and the values of RedactionPatterns rules. Optional.
+	Text LogRedactor
+}
+
+var _ LogRedactor = &Redactor{}
+var _ ResourceRedactor = &Redactor{}
+
+func NewRedactor(text LogRedactor, rules ...RedactionRule) *Redactor {
+	return &Redactor{Rules: rules, Text: text}
+}
+
+// DefaultRedactor applies DefaultRedactionRules to resources and DefaultRedactionPatterns to logs
+func DefaultRedactor() *Redactor {
+	return NewRedactor(DefaultLogRedactor(), DefaultRedactionRules...)
+}
+
+func (r *Redactor) Redact(line string) string {
+	if r.Text == nil {
+		return line
+	}
+	return r.Text.Redact(line)
+}
+
+// RedactResource returns a redacted copy of the resource
+func (r *Redactor) RedactResource(resource *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	result := resource.DeepCopy()
+	for _, rule := range r.Rules {
+		if !rule.matches(result.GroupVersionKind()) {
+			continue
+		}
+		path, err := parseRedactionPath(rule.Path)
+		if err != nil {
+			return nil, InvalidRedactionPathError(rule.Path, err)
+		}
+		result.Object = r.applyPath(result.Object, path, rule).(map[string]interface{})
+	}
+	return result, nil
+}
+
+// applies the rule to the values found by following the path from value, modifying maps and lists in place
+func (r *Redactor) applyPath(value interface{}, path []pathSegment, rule RedactionRule) interface{} {
+	if len(path) == 0 {
+		if rule.KeyPattern != nil {
+			r.applyKeys(value, rule)
+			return value
+		}
+		return r.applyAll(value, rule.Action)
+	}
+	segment, rest := path[0], path[1:]
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			if segment.wildcard || (segment.index < 0 && segment.key == key) {
+				typed[key] = r.applyPath(child, rest, rule)
+			}
+		}
+	case []interface{}:
+		for i, child := range typed {
+			if segment.wildcard || segment.index == i {
+				typed[i] = r.applyPath(child, rest, rule)
+			}
+		}
+	}
+	return value
+}
+
+// redacts the values of the keys matching the rule anywhere below value
+func (r *Redactor) applyKeys(value interface{}, rule RedactionRule) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		// name/value pairs, e.g. {name: DB_PASSWORD, value: hunter2}
+		if name, ok := typed["name"].(string); ok && rule.KeyPattern.MatchString(name) {
+			if _, ok := typed["value"].(string); ok {
+				typed["value"] = r.applyAll(typed["value"], rule.Action)
+			}
+		}
+		for key, child := range typed {
+			if _, ok := child.(string); ok && rule.KeyPattern.MatchString(key) {
+				typed[key] = r.applyAll(child, rule.Action)
+				continue
+			}
+			r.applyKeys(child, rule)
+		}
+	case []interface{}:
+		for _, child := range typed {
+			r.applyKeys(child, rule)
+		}
+	}
+}
+
+// redacts every string in value
+func (r *Redactor) applyAll(value interface{}, action RedactionAction) interface{} {
+	switch typed := value.(type) {
+	case string:
+		return r.redactString(typed, action)
+	case map[string]interface{}:
+		for key, child := range typed {
+			typed[key] = r.applyAll(child, action)
+		}
+	case []interface{}:
+		for i, child := range typed {
+			typed[i] = r.applyAll(child, action)
+		}
+	}
+	return value
+}
+
+func (r *Redactor) redactString(value string, action RedactionAction) string {
+	// values redacted by an earlier rule are left as they are, e.g. the hashed values of secrets
+	if strings.HasPrefix(value, RedactedValue[:len(RedactedValue)-1]) {
+		return value
+	}
+	switch action {
+	case RedactionHash:
+		sum := sha256.Sum256([]byte(value))
+		return fmt.Sprintf("[REDACTED sha256:%x]", sum[:8])
+	case RedactionPatterns:
+		// config files are redacted line by line, like logs
+		lines := strings.Split(value, "\n")
+		for i, line := range lines {
+			lines[i] = r.Redact(line)
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return RedactedValue
+	}
+}
+
+// pathSegment is a step of a redaction path: a map key, a list index, or a wildcard
+type pathSegment struct {
+	key      string
+	index    int
+	wildcard bool
+}
+
+// parses the subset of JSONPath used by redaction rules, with an optional leading "$" or "."
+func parseRedactionPath(path string) ([]pathSegment, error) {
+	var result []pathSegment
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, eris.New("unterminated [")
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				result = append(result, pathSegment{index: -1, wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				result = append(result, pathSegment{key: inner[1 : len(inner)-1], index: -1})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, eris.Errorf("invalid index [%s]", inner)
+				}
+				result = append(result, pathSegment{index: index})
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "*" {
+				result = append(result, pathSegment{index: -1, wildcard: true})
+			} else {
+				result = append(result, pathSegment{key: key, index: -1})
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,176 @@
+package debugutils
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/ghodss/yaml"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"github.com/spf13/afero"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("resource redaction", func() {
+
+	fromYaml := func(manifest string) *unstructured.Unstructured {
+		resource := &unstructured.Unstructured{}
+		Expect(yaml.Unmarshal([]byte(manifest), &resource.Object)).NotTo(HaveOccurred())
+		return resource
+	}
+
+	redact := func(redactor *Redactor, manifest string) *unstructured.Unstructured {
+		redacted, err := redactor.RedactResource(fromYaml(manifest))
+		Expect(err).NotTo(HaveOccurred())
+		return redacted
+	}
+
+	It("hashes the values of secrets", func() {
+		secret := `
+apiVersion: v1
+kind: Secret
+metadata:
+  name: tls
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{"data":{"tls.key":"c2VjcmV0"}}'
+data:
+  tls.key: c2VjcmV0
+  other.key: c2VjcmV0
+stringData:
+  password: hunter2
+`
+		redacted := redact(DefaultRedactor(), secret)
+		data := redacted.Object["data"].(map[string]interface{})
+		Expect(data["tls.key"]).To(HavePrefix("[REDACTED sha256:"))
+		// equal values have equal hashes
+		Expect(data["other.key"]).To(Equal(data["tls.key"]))
+		Expect(redacted.Object["stringData"].(map[string]interface{})["password"]).To(HavePrefix("[REDACTED sha256:"))
+		Expect(redacted.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]).To(Equal(RedactedValue))
+
+		// the original is not modified
+		Expect(fromYaml(secret).Object["data"].(map[string]interface{})["tls.key"]).To(Equal("c2VjcmV0"))
+	})
+
+	It("redacts sensitive keys and env vars of any resource", func() {
+		redacted := redact(DefaultRedactor(), `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: gateway
+spec:
+  template:
+    spec:
+      automountServiceAccountToken: true
+      containers:
+      - name: gateway
+        env:
+        - name: DB_PASSWORD
+          value: hunter2
+        - name: LOG_LEVEL
+          value: debug
+        - name: API_TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: api
+              key: token
+        args:
+        - --clientSecret=hunter2
+      volumes:
+      - name: certs
+        secret:
+          secretName: tls
+`)
+		podSpec := redacted.Object["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+		container := podSpec["containers"].([]interface{})[0].(map[string]interface{})
+		env := container["env"].([]interface{})
+		Expect(env[0].(map[string]interface{})["value"]).To(Equal(RedactedValue))
+		Expect(env[1].(map[string]interface{})["value"]).To(Equal("debug"))
+		Expect(env[2].(map[string]interface{})["valueFrom"]).To(HaveKeyWithValue("secretKeyRef",
+			map[string]interface{}{"name": "api", "key": "token"}))
+		Expect(podSpec["automountServiceAccountToken"]).To(BeTrue())
+		Expect(podSpec["volumes"].([]interface{})[0].(map[string]interface{})["secret"]).To(HaveKeyWithValue("secretName", "tls"))
+	})
+
+	It("redacts secrets inside config maps", func() {
+		redacted := redact(DefaultRedactor(), `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+data:
+  config.yaml: |
+    endpoint: https://admin:hunter2@db:5432
+    replicas: 3
+  token: abc123
+`)
+		data := redacted.Object["data"].(map[string]interface{})
+		Expect(data["config.yaml"]).To(Equal("endpoint: https://admin:[REDACTED]@db:5432\nreplicas: 3\n"))
+		Expect(data["token"]).To(Equal(RedactedValue))
+	})
+
+	It("applies rules by gvk and path", func() {
+		redactor := NewRedactor(nil,
+			RedactionRule{
+				GVK:  schema.GroupVersionKind{Group: "gateway.solo.io", Kind: "Gateway"},
+				Path: "$.spec.listeners[*].options['example.com/key']",
+			},
+			RedactionRule{
+				GVK:        schema.GroupVersionKind{Kind: "Gateway"},
+				Path:       "spec.listeners[1]",
+				KeyPattern: regexp.MustCompile("^user$"),
+				Action:     RedactionHash,
+			},
+		)
+		redacted := redact(redactor, `
+apiVersion: gateway.solo.io/v1
+kind: Gateway
+metadata:
+  name: gateway
+spec:
+  listeners:
+  - options:
+      example.com/key: one
+      user: admin
+  - options:
+      example.com/key: two
+      user: admin
+`)
+		listeners := redacted.Object["spec"].(map[string]interface{})["listeners"].([]interface{})
+		first := listeners[0].(map[string]interface{})["options"].(map[string]interface{})
+		second := listeners[1].(map[string]interface{})["options"].(map[string]interface{})
+		Expect(first).To(Equal(map[string]interface{}{"example.com/key": RedactedValue, "user": "admin"}))
+		Expect(second["example.com/key"]).To(Equal(RedactedValue))
+		Expect(second["user"]).To(HavePrefix("[REDACTED sha256:"))
+	})
+
+	It("rejects invalid paths", func() {
+		redactor := NewRedactor(nil, RedactionRule{Path: "spec.listeners[one]"})
+		_, err := redactor.RedactResource(fromYaml("kind: Gateway"))
+		Expect(err).To(MatchError(ContainSubstring("invalid redaction path spec.listeners[one]")))
+	})
+
+	It("redacts resources saved by the resource collector", func() {
+		secret := fromYaml(`
+apiVersion: v1
+kind: Secret
+metadata:
+  name: tls
+  namespace: gloo-system
+data:
+  tls.key: c2VjcmV0
+`)
+		fs := afero.NewMemMapFs()
+		collector := (&resourceCollector{}).WithRedactor(DefaultRedactor())
+		err := collector.SaveResources(context.Background(), NewFileStorageClient(fs), "/bundle", []kuberesource.VersionedResources{{
+			GVK:       secret.GroupVersionKind(),
+			Resources: kuberesource.UnstructuredResources{secret},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		saved, err := afero.ReadFile(fs, "/bundle/Secret_v1.yaml")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(saved)).To(ContainSubstring("tls.key: '[REDACTED sha256:"))
+		Expect(string(saved)).NotTo(ContainSubstring("c2VjcmV0"))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
@@ -12,11 +13,18 @@ import (
 type LogMeta struct {
 	PodMeta       metav1.ObjectMeta
 	ContainerName string
+	// the logs of the previous instance of the container, which has restarted
+	Previous bool
 }
 
 type LogsRequest struct {
 	LogMeta
 	Request rest.ResponseWrapper
+
+	// the end of the time window of the request; the api only supports setting the start
+	until time.Time
+	// the request asked for timestamps to apply the time window, which the caller did not ask for
+	stripTimestamps bool
 }
 
 type LogsResponse struct {
@@ -29,6 +37,9 @@ func (lr LogMeta) ResourcePath(dir string) string {
 }
 
 func (lr LogMeta) ResourceId() string {
+	if lr.Previous {
+		return fmt.Sprintf("%s_%s_%s_previous.log", lr.PodMeta.Namespace, lr.PodMeta.Name, lr.ContainerName)
+	}
 	return fmt.Sprintf("%s_%s_%s.log", lr.PodMeta.Namespace, lr.PodMeta.Name, lr.ContainerName)
 }
 
@@ -35,8 +35,10 @@ type resourceCollector struct {
 	dynamicClient dynamic.Interface
 	restMapper    meta.RESTMapper
 	podFinder     PodFinder
+	redactor      ResourceRedactor
 }
 
+// DefaultResourceCollector redacts secrets from saved resources with DefaultRedactor
 func DefaultResourceCollector() (*resourceCollector, error) {
 	cfg, err := kubeutils.GetConfig("", "")
 	if err != nil {
@@ -60,9 +62,17 @@ func DefaultResourceCollector() (*resourceCollector, error) {
 		dynamicClient: dynamicClient,
 		restMapper:    restMapper,
 		podFinder:     podFinder,
+		redactor:      DefaultRedactor(),
 	}, nil
 }
 
+// WithRedactor returns a copy of the collector which redacts saved resources. A nil redactor disables redaction.
+func (rc *resourceCollector) WithRedactor(redactor ResourceRedactor) *resourceCollector {
+	result := *rc
+	result.redactor = redactor
+	return &result
+}
+
 func (rc *resourceCollector) RetrieveResourcesFromManifest(ctx context.Context, manifests helmchart.Manifests, opts metav1.ListOptions) ([]kuberesource.VersionedResources, error) {
 	resources, err := manifests.ResourceList()
 	if err != nil {
@@ -186,7 +196,11 @@ func (rc *resourceCollector) gvrFromUnstructured(resource unstructured.Unstructu
 func (rc *resourceCollector) SaveResources(ctx context.Context, storageClient StorageClient, location string, versionedResources []kuberesource.VersionedResources) error {
 	var storageObjects []*StorageObject
 	for _, versionedResource := range versionedResources {
-		tmpManifests, err := helmchart.ManifestsFromResources(versionedResource.Resources)
+		resources, err := rc.redact(versionedResource.Resources)
+		if err != nil {
+			return err
+		}
+		tmpManifests, err := helmchart.ManifestsFromResources(resources)
 		if err != nil {
 			return err
 		}
@@ -199,3 +213,18 @@ func (rc *resourceCollector) SaveResources(ctx context.Context, storageClient St
 	}
 	return storageClient.Save(location, storageObjects...)
 }
+
+func (rc *resourceCollector) redact(resources kuberesource.UnstructuredResources) (kuberesource.UnstructuredResources, error) {
+	if rc.redactor == nil {
+		return resources, nil
+	}
+	result := make(kuberesource.UnstructuredResources, 0, len(resources))
+	for _, resource := range resources {
+		redacted, err := rc.redactor.RedactResource(resource)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, redacted)
+	}
+	return result, nil
+}
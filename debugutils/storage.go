@@ -1,9 +1,15 @@
 package debugutils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/spf13/afero"
 )
@@ -11,6 +17,8 @@ import (
 type StorageObject struct {
 	Resource io.Reader
 	Name     string
+	// Optional, detected from the name and contents when empty. Recorded by storage clients which keep metadata.
+	ContentType string
 }
 
 type StorageClient interface {
@@ -18,6 +26,7 @@ type StorageClient interface {
 }
 
 type FileStorageClient struct {
+	objectIndex
 	fs afero.Fs
 }
 
@@ -32,15 +41,119 @@ func DefaultFileStorageClient() *FileStorageClient {
 func (fsc *FileStorageClient) Save(location string, resources ...*StorageObject) error {
 	for _, resource := range resources {
 		fileName := filepath.Join(location, resource.Name)
+		if err := fsc.fs.MkdirAll(filepath.Dir(fileName), 0777); err != nil {
+			return err
+		}
 		file, err := fsc.fs.OpenFile(fileName, os.O_CREATE|os.O_RDWR, 0777)
 		if err != nil {
 			return err
 		}
-		_, err = io.Copy(file, resource.Resource)
+		digest := newObjectDigest()
+		_, err = io.Copy(io.MultiWriter(file, digest), resource.Resource)
 		if err != nil {
 			return err
 		}
 		file.Close()
+		fsc.add(digest.object(fileName, resource))
 	}
 	return nil
 }
+
+// StoredObject describes an object saved by a storage client
+type StoredObject struct {
+	// the path of the object within the storage backend
+	Path        string
+	ContentType string
+	Size        int64
+	SHA256      string
+}
+
+// the number of bytes considered by http.DetectContentType
+const sniffLen = 512
+
+var contentTypesByExtension = map[string]string{
+	".yaml": "application/yaml",
+	".yml":  "application/yaml",
+	".json": "application/json",
+	".log":  "text/plain; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+}
+
+// bufferObject reads a storage object into memory, so that its metadata is known before it is written
+func bufferObject(path string, resource *StorageObject) ([]byte, StoredObject, error) {
+	data, err := io.ReadAll(resource.Resource)
+	if err != nil {
+		return nil, StoredObject{}, err
+	}
+	digest := newObjectDigest()
+	digest.Write(data)
+	return data, digest.object(path, resource), nil
+}
+
+// objectDigest computes the metadata of an object as it is written
+type objectDigest struct {
+	hash hash.Hash
+	size int64
+	// the first bytes of the object, for content type detection
+	head []byte
+}
+
+func newObjectDigest() *objectDigest {
+	return &objectDigest{hash: sha256.New()}
+}
+
+func (d *objectDigest) Write(p []byte) (int, error) {
+	d.hash.Write(p)
+	d.size += int64(len(p))
+	if missing := sniffLen - len(d.head); missing > 0 {
+		if missing > len(p) {
+			missing = len(p)
+		}
+		d.head = append(d.head, p[:missing]...)
+	}
+	return len(p), nil
+}
+
+func (d *objectDigest) object(path string, resource *StorageObject) StoredObject {
+	return StoredObject{
+		Path:        path,
+		ContentType: contentType(resource, d.head),
+		Size:        d.size,
+		SHA256:      hex.EncodeToString(d.hash.Sum(nil)),
+	}
+}
+
+func contentType(resource *StorageObject, data []byte) string {
+	if resource.ContentType != "" {
+		return resource.ContentType
+	}
+	if known, ok := contentTypesByExtension[strings.ToLower(filepath.Ext(resource.Name))]; ok {
+		return known
+	}
+	return http.DetectContentType(data)
+}
+
+// objectPath joins a location and object name into a relative, slash separated path, as used by archives and
+// object stores
+func objectPath(location, name string) string {
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Join(location, name)), "/")
+}
+
+// objectIndex records the metadata of every object saved by a storage client
+type objectIndex struct {
+	lock    sync.Mutex
+	objects []StoredObject
+}
+
+func (i *objectIndex) add(object StoredObject) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.objects = append(i.objects, object)
+}
+
+// Objects returns the metadata of every object saved so far, in the order they were saved
+func (i *objectIndex) Objects() []StoredObject {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return append([]StoredObject(nil), i.objects...)
+}
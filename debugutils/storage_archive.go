@@ -0,0 +1,155 @@
+package debugutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// PAX record holding the checksum of each file in a tar archive
+	TarSHA256Record = "SOLO.sha256"
+	// PAX record holding the content type of each file in a tar archive
+	TarContentTypeRecord = "SOLO.contentType"
+)
+
+var (
+	ArchiveClosedError = eris.New("archive has already been closed")
+)
+
+// TarGzStorageClient streams every saved object into a single .tar.gz archive, so that a bundle can be uploaded as
+// one artifact. Objects are buffered in memory one at a time, as tar needs to know their size up front.
+// Close must be called to finish the archive; it does not close the underlying writer.
+type TarGzStorageClient struct {
+	objectIndex
+	lock   sync.Mutex
+	gzip   *gzip.Writer
+	tar    *tar.Writer
+	closed bool
+}
+
+func NewTarGzStorageClient(w io.Writer) *TarGzStorageClient {
+	gz := gzip.NewWriter(w)
+	return &TarGzStorageClient{
+		gzip: gz,
+		tar:  tar.NewWriter(gz),
+	}
+}
+
+func (c *TarGzStorageClient) Save(location string, resources ...*StorageObject) error {
+	for _, resource := range resources {
+		path := objectPath(location, resource.Name)
+		data, object, err := bufferObject(path, resource)
+		if err != nil {
+			return eris.Wrapf(err, "unable to read %s", path)
+		}
+		if err := c.write(data, object); err != nil {
+			return eris.Wrapf(err, "unable to add %s to archive", path)
+		}
+		c.add(object)
+	}
+	return nil
+}
+
+func (c *TarGzStorageClient) write(data []byte, object StoredObject) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return ArchiveClosedError
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     object.Path,
+		Mode:     0644,
+		Size:     object.Size,
+		ModTime:  time.Now(),
+		Format:   tar.FormatPAX,
+		PAXRecords: map[string]string{
+			TarSHA256Record:      object.SHA256,
+			TarContentTypeRecord: object.ContentType,
+		},
+	}
+	if err := c.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := c.tar.Write(data)
+	return err
+}
+
+func (c *TarGzStorageClient) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if err := c.tar.Close(); err != nil {
+		return err
+	}
+	return c.gzip.Close()
+}
+
+// ZipStorageClient streams every saved object into a single .zip archive. The checksum and content type of each
+// file are stored in its comment. Close must be called to finish the archive; it does not close the underlying writer.
+type ZipStorageClient struct {
+	objectIndex
+	lock   sync.Mutex
+	zip    *zip.Writer
+	closed bool
+}
+
+func NewZipStorageClient(w io.Writer) *ZipStorageClient {
+	return &ZipStorageClient{zip: zip.NewWriter(w)}
+}
+
+func (c *ZipStorageClient) Save(location string, resources ...*StorageObject) error {
+	for _, resource := range resources {
+		path := objectPath(location, resource.Name)
+		data, object, err := bufferObject(path, resource)
+		if err != nil {
+			return eris.Wrapf(err, "unable to read %s", path)
+		}
+		if err := c.write(data, object); err != nil {
+			return eris.Wrapf(err, "unable to add %s to archive", path)
+		}
+		c.add(object)
+	}
+	return nil
+}
+
+func (c *ZipStorageClient) write(data []byte, object StoredObject) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return ArchiveClosedError
+	}
+	header := &zip.FileHeader{
+		Name:     object.Path,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+		Comment:  "sha256=" + object.SHA256 + " contentType=" + object.ContentType,
+	}
+	header.SetMode(0644)
+	w, err := c.zip.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	return err
+}
+
+func (c *ZipStorageClient) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.zip.Close()
+}
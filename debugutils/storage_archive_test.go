@@ -0,0 +1,88 @@
+package debugutils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("archive storage clients", func() {
+
+	const (
+		location = "/bundle/namespaces/default"
+		contents = "apiVersion: v1\nkind: Pod\n"
+	)
+
+	var expectedChecksum string
+
+	BeforeEach(func() {
+		expectedChecksum = sha256Hex([]byte(contents))
+	})
+
+	newObjects := func() []*StorageObject {
+		return []*StorageObject{
+			{Resource: strings.NewReader(contents), Name: "Pod_v1.yaml"},
+			{Resource: strings.NewReader("log line\n"), Name: "default_pod_container.log"},
+		}
+	}
+
+	It("writes a tar.gz archive with metadata", func() {
+		buf := &bytes.Buffer{}
+		client := NewTarGzStorageClient(buf)
+		Expect(client.Save(location, newObjects()...)).NotTo(HaveOccurred())
+		Expect(client.Close()).NotTo(HaveOccurred())
+
+		Expect(client.Objects()).To(Equal([]StoredObject{
+			{Path: "bundle/namespaces/default/Pod_v1.yaml", ContentType: "application/yaml", Size: int64(len(contents)), SHA256: expectedChecksum},
+			{Path: "bundle/namespaces/default/default_pod_container.log", ContentType: "text/plain; charset=utf-8", Size: 9, SHA256: sha256Hex([]byte("log line\n"))},
+		}))
+
+		gz, err := gzip.NewReader(buf)
+		Expect(err).NotTo(HaveOccurred())
+		tr := tar.NewReader(gz)
+		header, err := tr.Next()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(header.Name).To(Equal("bundle/namespaces/default/Pod_v1.yaml"))
+		Expect(header.PAXRecords).To(HaveKeyWithValue(TarSHA256Record, expectedChecksum))
+		Expect(header.PAXRecords).To(HaveKeyWithValue(TarContentTypeRecord, "application/yaml"))
+		data, err := io.ReadAll(tr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(contents))
+		_, err = tr.Next()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tr.Next()
+		Expect(err).To(Equal(io.EOF))
+	})
+
+	It("writes a zip archive with metadata", func() {
+		buf := &bytes.Buffer{}
+		client := NewZipStorageClient(buf)
+		Expect(client.Save(location, newObjects()...)).NotTo(HaveOccurred())
+		Expect(client.Close()).NotTo(HaveOccurred())
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(zr.File).To(HaveLen(2))
+		Expect(zr.File[0].Name).To(Equal("bundle/namespaces/default/Pod_v1.yaml"))
+		Expect(zr.File[0].Comment).To(ContainSubstring("sha256=" + expectedChecksum))
+		file, err := zr.File[0].Open()
+		Expect(err).NotTo(HaveOccurred())
+		data, err := io.ReadAll(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(contents))
+	})
+
+	It("refuses to save after the archive is closed", func() {
+		client := NewTarGzStorageClient(&bytes.Buffer{})
+		Expect(client.Close()).NotTo(HaveOccurred())
+		err := client.Save(location, newObjects()...)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(ArchiveClosedError.Error()))
+	})
+})
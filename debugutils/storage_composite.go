@@ -0,0 +1,62 @@
+package debugutils
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/rotisserie/eris"
+	"golang.org/x/sync/errgroup"
+)
+
+// CompositeStorageClient saves every object to all of its targets, for example to a local directory and an object
+// store at the same time. Each object is buffered in memory so that every target can read it.
+type CompositeStorageClient struct {
+	objectIndex
+	targets []StorageClient
+}
+
+func NewCompositeStorageClient(targets ...StorageClient) *CompositeStorageClient {
+	return &CompositeStorageClient{targets: targets}
+}
+
+// Save writes to every target even if some of them fail, and returns the first error
+func (c *CompositeStorageClient) Save(location string, resources ...*StorageObject) error {
+	for _, resource := range resources {
+		path := objectPath(location, resource.Name)
+		data, object, err := bufferObject(path, resource)
+		if err != nil {
+			return eris.Wrapf(err, "unable to read %s", path)
+		}
+		eg := errgroup.Group{}
+		for _, target := range c.targets {
+			target := target
+			eg.Go(func() error {
+				return target.Save(location, &StorageObject{
+					Resource:    bytes.NewReader(data),
+					Name:        resource.Name,
+					ContentType: object.ContentType,
+				})
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+		c.add(object)
+	}
+	return nil
+}
+
+// Close closes every target that needs closing, such as archives
+func (c *CompositeStorageClient) Close() error {
+	var firstErr error
+	for _, target := range c.targets {
+		closer, ok := target.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
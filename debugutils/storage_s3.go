@@ -0,0 +1,208 @@
+package debugutils
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rotisserie/eris"
+)
+
+const (
+	s3Service          = "s3"
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3AmzDateFormat    = "20060102T150405Z"
+	s3DateFormat       = "20060102"
+
+	// user metadata header holding the checksum of each uploaded object
+	S3SHA256MetadataHeader = "X-Amz-Meta-Sha256"
+)
+
+type S3Options struct {
+	// The url of an S3 compatible api, such as https://s3.us-east-1.amazonaws.com or http://minio.minio:9000.
+	// Objects are addressed path-style, as <endpoint>/<bucket>/<key>.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Optional, for temporary credentials
+	SessionToken string
+	// Optional, prepended to the path of every object
+	Prefix string
+	// Optional, defaults to http.DefaultClient
+	HttpClient *http.Client
+}
+
+// S3StorageClient uploads every saved object to an S3 compatible object store, signing requests with AWS signature
+// version 4. The checksum of each object is stored as user metadata.
+type S3StorageClient struct {
+	objectIndex
+	opts S3Options
+	now  func() time.Time
+}
+
+func NewS3StorageClient(opts S3Options) (*S3StorageClient, error) {
+	if opts.Endpoint == "" || opts.Bucket == "" {
+		return nil, eris.New("an endpoint and bucket are required for the s3 storage client")
+	}
+	if _, err := url.Parse(opts.Endpoint); err != nil {
+		return nil, eris.Wrapf(err, "invalid s3 endpoint %s", opts.Endpoint)
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.HttpClient == nil {
+		opts.HttpClient = http.DefaultClient
+	}
+	return &S3StorageClient{opts: opts, now: time.Now}, nil
+}
+
+func (c *S3StorageClient) Save(location string, resources ...*StorageObject) error {
+	for _, resource := range resources {
+		path := objectPath(c.opts.Prefix, objectPath(location, resource.Name))
+		data, object, err := bufferObject(path, resource)
+		if err != nil {
+			return eris.Wrapf(err, "unable to read %s", path)
+		}
+		if err := c.put(context.Background(), data, object); err != nil {
+			return eris.Wrapf(err, "unable to upload %s", path)
+		}
+		c.add(object)
+	}
+	return nil
+}
+
+func (c *S3StorageClient) put(ctx context.Context, data []byte, object StoredObject) error {
+	objectUrl, err := url.Parse(c.opts.Endpoint)
+	if err != nil {
+		return err
+	}
+	objectUrl.Path = strings.TrimSuffix(objectUrl.Path, "/") + "/" + c.opts.Bucket + "/" + object.Path
+	// send the path exactly as it is signed
+	objectUrl.RawPath = canonicalS3Path(objectUrl.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectUrl.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = object.Size
+	req.Header.Set("Content-Type", object.ContentType)
+	req.Header.Set(S3SHA256MetadataHeader, object.SHA256)
+	if c.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.opts.SessionToken)
+	}
+	signS3Request(req, object.SHA256, c.opts.Region, c.opts.AccessKeyID, c.opts.SecretAccessKey, c.now())
+
+	resp, err := c.opts.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return eris.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// signS3Request adds the headers of an AWS signature version 4, signing the host and every header already set on
+// the request.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signS3Request(req *http.Request, payloadHash, region, accessKeyID, secretAccessKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3AmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalS3Path(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{now.Format(s3DateFormat), region, s3Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{s3SigningAlgorithm, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, accessKeyID, scope, signedHeaders, signature))
+}
+
+// S3 expects each segment of the path to be uri encoded once
+func canonicalS3Path(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for key, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// encodes everything except the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+	b := &strings.Builder{}
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -67,10 +67,42 @@ var _ = Describe("storage client tests", func() {
 			}
 		})
 
+		It("creates missing directories", func() {
+			location := filepath.Join(tmpd, "namespaces", "default", "logs")
+			Expect(client.Save(location, storageObjects[0])).NotTo(HaveOccurred())
+			fileByt, err := afero.ReadFile(fs, filepath.Join(location, storageObjects[0].Name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileByt).To(Equal([]byte(storageObjects[0].Name)))
+		})
+
 		It("can store no files", func() {
 			Expect(client.Save(tmpd)).NotTo(HaveOccurred())
 		})
 
 	})
 
+	Context("composite client", func() {
+
+		It("saves every object to all targets", func() {
+			first, second := NewFileStorageClient(afero.NewMemMapFs()), NewFileStorageClient(afero.NewMemMapFs())
+			client := NewCompositeStorageClient(first, second)
+			Expect(client.Save("/dump", storageObjects...)).NotTo(HaveOccurred())
+			for _, target := range []*FileStorageClient{first, second} {
+				Expect(target.Objects()).To(HaveLen(len(storageObjects)))
+				for _, v := range storageObjects {
+					fileByt, err := afero.ReadFile(target.fs, filepath.Join("/dump", v.Name))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(fileByt).To(Equal([]byte(v.Name)))
+				}
+			}
+			Expect(client.Objects()).To(HaveLen(len(storageObjects)))
+			Expect(client.Objects()[0]).To(Equal(StoredObject{
+				Path:        "dump/first",
+				ContentType: "text/plain; charset=utf-8",
+				Size:        5,
+				SHA256:      sha256Hex([]byte("first")),
+			}))
+		})
+	})
+
 })
@@ -0,0 +1,322 @@
+package debugutils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/solo-io/go-utils/contextutils"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	DefaultTailPollInterval      = 2 * time.Second
+	DefaultTailReconnectDelay    = 500 * time.Millisecond
+	DefaultTailMaxReconnectDelay = 10 * time.Second
+	DefaultTailMergeWindow       = time.Second
+)
+
+type TailOptions struct {
+	// how often the pod finder is polled for new pods, defaults to DefaultTailPollInterval
+	PollInterval time.Duration
+	// the delay before reopening a stream which ended, doubling on every consecutive attempt up to MaxReconnectDelay
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	// logs written before this are skipped. Defaults to the time tailing started, so that history is not replayed
+	Since time.Time
+	// keep the timestamp of every line in the output
+	Timestamps bool
+	// how long lines are held back so that lines from other containers with an earlier timestamp can be written
+	// first, defaults to DefaultTailMergeWindow
+	MergeWindow time.Duration
+}
+
+// LogTailer follows the logs of every container of the pods matched by a PodFinder, and multiplexes them into a
+// single output with each line prefixed by [namespace/pod/container], like stern.
+// The container selection, line filter and redactor of the LogRequestBuilder are applied.
+type LogTailer struct {
+	requestBuilder *LogRequestBuilder
+	opts           TailOptions
+}
+
+func NewLogTailer(requestBuilder *LogRequestBuilder, opts TailOptions) *LogTailer {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultTailPollInterval
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = DefaultTailReconnectDelay
+	}
+	if opts.MergeWindow <= 0 {
+		opts.MergeWindow = DefaultTailMergeWindow
+	}
+	if opts.MaxReconnectDelay < opts.ReconnectDelay {
+		opts.MaxReconnectDelay = DefaultTailMaxReconnectDelay
+		if opts.MaxReconnectDelay < opts.ReconnectDelay {
+			opts.MaxReconnectDelay = opts.ReconnectDelay
+		}
+	}
+	return &LogTailer{requestBuilder: requestBuilder, opts: opts}
+}
+
+// Tail follows logs until the context is cancelled, picking up pods as they appear. Lines are written to out whole,
+// ordered by their timestamp across all containers. Each line is held back for MergeWindow to give slower streams
+// a chance to catch up; a line which arrives later than that is written as soon as possible, and may be out of order.
+// Pods which have completed are not followed again. It is usually run in the background of a test:
+//
+//	ctx, cancel := context.WithCancel(ctx)
+//	defer cancel()
+//	go tailer.Tail(ctx, GinkgoWriter, resources)
+func (t *LogTailer) Tail(ctx context.Context, out io.Writer, resources kuberesource.UnstructuredResources) error {
+	since := t.opts.Since
+	if since.IsZero() {
+		since = time.Now()
+	}
+	tail := &tail{
+		tailer:   t,
+		out:      out,
+		since:    since,
+		active:   map[string]bool{},
+		finished: map[string]bool{},
+	}
+	defer func() {
+		tail.wg.Wait()
+		tail.flush(time.Time{})
+	}()
+
+	ticker := time.NewTicker(t.opts.PollInterval)
+	defer ticker.Stop()
+	flushTicker := time.NewTicker(max(t.opts.MergeWindow/4, time.Millisecond))
+	defer flushTicker.Stop()
+	tail.discover(ctx, resources)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			tail.discover(ctx, resources)
+		case now := <-flushTicker.C:
+			tail.flush(now.Add(-t.opts.MergeWindow))
+		}
+	}
+}
+
+// tail is the state of a single call to Tail
+type tail struct {
+	tailer *LogTailer
+	out    io.Writer
+	since  time.Time
+
+	outLock sync.Mutex
+	pending lineMerger
+
+	activeLock sync.Mutex
+	active     map[string]bool
+	// containers of pods which have completed or been replaced, keyed by pod uid, which must not be followed again
+	finished map[string]bool
+	wg       sync.WaitGroup
+}
+
+// starts following every container which isn't being followed already
+func (t *tail) discover(ctx context.Context, resources kuberesource.UnstructuredResources) {
+	podLists, err := t.tailer.requestBuilder.podFinder.GetPods(ctx, resources)
+	if err != nil {
+		if ctx.Err() == nil {
+			contextutils.LoggerFrom(ctx).Warnw("unable to find pods to tail", zap.Error(err))
+		}
+		return
+	}
+	for _, podList := range podLists {
+		for _, pod := range podList.Items {
+			for _, container := range t.tailer.requestBuilder.selectedContainers(pod) {
+				t.follow(ctx, pod, container)
+			}
+		}
+	}
+}
+
+func (t *tail) follow(ctx context.Context, pod corev1.Pod, container string) {
+	key := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, container)
+	uidKey := fmt.Sprintf("%s/%s", pod.UID, container)
+	t.activeLock.Lock()
+	defer t.activeLock.Unlock()
+	if t.active[key] || t.finished[uidKey] || ctx.Err() != nil {
+		return
+	}
+	t.active[key] = true
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.stream(ctx, pod, container, "["+key+"] ")
+		t.activeLock.Lock()
+		defer t.activeLock.Unlock()
+		// the pod may come back with the same name but a new uid, e.g. in a stateful set
+		delete(t.active, key)
+		if ctx.Err() == nil {
+			t.finished[uidKey] = true
+		}
+	}()
+}
+
+// streams the logs of a container until the context is cancelled or the container is gone, reconnecting as needed
+func (t *tail) stream(ctx context.Context, pod corev1.Pod, container, prefix string) {
+	logger := contextutils.LoggerFrom(ctx)
+	processor := &logLineProcessor{
+		filter:   t.tailer.requestBuilder.lineFilter,
+		redactor: t.tailer.requestBuilder.redactor,
+	}
+	pods := t.tailer.requestBuilder.clientset.Pods(pod.Namespace)
+	lastSeen := t.since
+	delay := t.tailer.opts.ReconnectDelay
+	for {
+		opts := &corev1.PodLogOptions{
+			Container:  container,
+			Follow:     true,
+			Timestamps: true,
+			// the api only supports second precision, lines up to lastSeen are skipped below
+			SinceTime: &metav1.Time{Time: lastSeen},
+		}
+		reader, err := pods.GetLogs(pod.Name, opts).Stream(ctx)
+		if err == nil {
+			received := false
+			lastSeen, received = t.copyLines(reader, prefix, lastSeen, processor)
+			reader.Close()
+			if received {
+				delay = t.tailer.opts.ReconnectDelay
+			}
+		} else if ctx.Err() == nil {
+			logger.Debugw("unable to stream logs, retrying", zap.String("container", prefix), zap.Error(err))
+		}
+
+		if !t.sleep(ctx, delay) || !t.podExists(ctx, pod) {
+			return
+		}
+		delay *= 2
+		if delay > t.tailer.opts.MaxReconnectDelay {
+			delay = t.tailer.opts.MaxReconnectDelay
+		}
+	}
+}
+
+// writes every line newer than lastSeen, returning the timestamp of the last line and whether any line was written
+func (t *tail) copyLines(reader io.Reader, prefix string, lastSeen time.Time, processor *logLineProcessor) (time.Time, bool) {
+	wrote := false
+	lines := bufio.NewReader(reader)
+	for {
+		line, err := lines.ReadString('\n')
+		if line != "" {
+			text := strings.TrimSuffix(line, "\n")
+			received := time.Now()
+			sortBy := received
+			timestamp, rest, found := strings.Cut(text, " ")
+			if ts, parseErr := time.Parse(time.RFC3339Nano, timestamp); found && parseErr == nil {
+				if !ts.After(lastSeen) {
+					continue
+				}
+				lastSeen = ts
+				sortBy = ts
+				if !t.tailer.opts.Timestamps {
+					text = rest
+				}
+			}
+			if processed, keep, _ := processor.process(text); keep {
+				wrote = true
+				t.write(pendingLine{timestamp: sortBy, received: received, text: prefix + processed + "\n"})
+			}
+		}
+		if err != nil {
+			return lastSeen, wrote
+		}
+	}
+}
+
+func (t *tail) write(line pendingLine) {
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	t.pending.push(line)
+}
+
+// writes the pending lines which were received before the cutoff, or all of them if the cutoff is zero
+func (t *tail) flush(cutoff time.Time) {
+	t.outLock.Lock()
+	defer t.outLock.Unlock()
+	for _, line := range t.pending.pop(cutoff) {
+		io.WriteString(t.out, line.text)
+	}
+}
+
+type pendingLine struct {
+	// the time the line was logged, or received if it has no timestamp
+	timestamp time.Time
+	received  time.Time
+	text      string
+}
+
+// lineMerger holds back lines from several streams so that they can be written in timestamp order
+type lineMerger struct {
+	lines []pendingLine
+}
+
+func (m *lineMerger) push(line pendingLine) {
+	m.lines = append(m.lines, line)
+}
+
+// pop removes and returns, ordered by timestamp, every line received before the cutoff together with every line
+// logged before such a line. A zero cutoff returns all lines.
+func (m *lineMerger) pop(cutoff time.Time) []pendingLine {
+	var until time.Time
+	for _, line := range m.lines {
+		if (cutoff.IsZero() || !line.received.After(cutoff)) && line.timestamp.After(until) {
+			until = line.timestamp
+		}
+	}
+	if until.IsZero() {
+		return nil
+	}
+	var ready, remaining []pendingLine
+	for _, line := range m.lines {
+		if line.timestamp.After(until) {
+			remaining = append(remaining, line)
+		} else {
+			ready = append(ready, line)
+		}
+	}
+	m.lines = remaining
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].timestamp.Before(ready[j].timestamp)
+	})
+	return ready
+}
+
+// returns false if the context was cancelled while sleeping
+func (t *tail) sleep(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// containers are followed until their pod is deleted or replaced, or has completed
+func (t *tail) podExists(ctx context.Context, pod corev1.Pod) bool {
+	current, err := t.tailer.requestBuilder.clientset.Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	if err != nil {
+		// keep retrying on transient errors
+		return !kubeerrs.IsNotFound(err) && ctx.Err() == nil
+	}
+	if current.UID != pod.UID {
+		return false
+	}
+	return current.Status.Phase != corev1.PodSucceeded && current.Status.Phase != corev1.PodFailed
+}
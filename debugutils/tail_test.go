@@ -0,0 +1,164 @@
+package debugutils
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/installutils/kuberesource"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// synchronizes writes from the tailer with reads from the test
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+var _ = Describe("log tailer", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		kube      kubernetes.Interface
+		podFinder *MockPodFinder
+		tailer    *LogTailer
+		out       *syncBuffer
+		done      chan struct{}
+
+		podsLock sync.Mutex
+		pods     []corev1.Pod
+	)
+
+	setPods := func(newPods ...corev1.Pod) {
+		podsLock.Lock()
+		defer podsLock.Unlock()
+		pods = newPods
+	}
+
+	BeforeEach(func() {
+		ctrl, ctx = gomock.WithContext(context.Background(), T)
+		ctx, cancel = context.WithCancel(ctx)
+		gateway, gloo := gatewayPod(), GlooPod()
+		kube = fake.NewClientset(gateway, gloo)
+		podFinder = NewMockPodFinder(ctrl)
+		podFinder.EXPECT().GetPods(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+			func(context.Context, kuberesource.UnstructuredResources) ([]*corev1.PodList, error) {
+				podsLock.Lock()
+				defer podsLock.Unlock()
+				return []*corev1.PodList{{Items: pods}}, nil
+			})
+		setPods(*gateway)
+		tailer = NewLogTailer(NewLogRequestBuilder(kube.CoreV1(), podFinder), TailOptions{
+			PollInterval:   10 * time.Millisecond,
+			ReconnectDelay: 10 * time.Millisecond,
+			MergeWindow:    10 * time.Millisecond,
+		})
+		out = &syncBuffer{}
+		done = make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			Expect(tailer.Tail(ctx, out, nil)).NotTo(HaveOccurred())
+		}()
+	})
+
+	AfterEach(func() {
+		cancel()
+		Eventually(done).Should(BeClosed())
+		ctrl.Finish()
+	})
+
+	It("prefixes the lines of every container", func() {
+		Eventually(out.String).Should(ContainSubstring("[gloo-system/" + gatewayPod().Name + "/gateway] fake logs\n"))
+	})
+
+	It("picks up new pods", func() {
+		Eventually(out.String).Should(ContainSubstring("/gateway] fake logs"))
+		Expect(out.String()).NotTo(ContainSubstring("[gloo-system/" + GlooPod().Name))
+		setPods(*gatewayPod(), *GlooPod())
+		Eventually(out.String).Should(ContainSubstring("[gloo-system/" + GlooPod().Name + "/gloo] fake logs"))
+	})
+
+	It("stops following pods which have been deleted", func() {
+		Eventually(out.String).Should(ContainSubstring("/gateway] fake logs"))
+		setPods()
+		Expect(kube.CoreV1().Pods("gloo-system").Delete(ctx, gatewayPod().Name, metav1.DeleteOptions{})).NotTo(HaveOccurred())
+		// wait for the last reconnect to notice the pod is gone
+		time.Sleep(50 * time.Millisecond)
+		lines := strings.Count(out.String(), "\n")
+		Consistently(func() int {
+			return strings.Count(out.String(), "\n")
+		}, 100*time.Millisecond).Should(Equal(lines))
+	})
+
+	It("does not follow pods which have completed again", func() {
+		completed := gatewayPod()
+		completed.Status.Phase = corev1.PodSucceeded
+		_, err := kube.CoreV1().Pods("gloo-system").UpdateStatus(ctx, completed, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		setPods(*completed)
+		Eventually(out.String).Should(ContainSubstring("/gateway] fake logs"))
+		time.Sleep(50 * time.Millisecond)
+		lines := strings.Count(out.String(), "\n")
+		Consistently(func() int {
+			return strings.Count(out.String(), "\n")
+		}, 100*time.Millisecond).Should(Equal(lines))
+	})
+})
+
+var _ = Describe("line merger", func() {
+	var (
+		start  = time.Now()
+		at     = func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+		merger *lineMerger
+	)
+
+	texts := func(lines []pendingLine) []string {
+		var result []string
+		for _, line := range lines {
+			result = append(result, line.text)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		merger = &lineMerger{}
+	})
+
+	It("orders lines from several streams by timestamp", func() {
+		merger.push(pendingLine{timestamp: at(2), received: at(3), text: "b"})
+		merger.push(pendingLine{timestamp: at(1), received: at(4), text: "a"})
+		merger.push(pendingLine{timestamp: at(3), received: at(5), text: "c"})
+		Expect(texts(merger.pop(time.Time{}))).To(Equal([]string{"a", "b", "c"}))
+		Expect(merger.pop(time.Time{})).To(BeEmpty())
+	})
+
+	It("holds back lines received after the cutoff unless an earlier line is due", func() {
+		merger.push(pendingLine{timestamp: at(2), received: at(2), text: "b"})
+		merger.push(pendingLine{timestamp: at(1), received: at(6), text: "a"})
+		merger.push(pendingLine{timestamp: at(3), received: at(6), text: "c"})
+		Expect(texts(merger.pop(at(4)))).To(Equal([]string{"a", "b"}))
+		Expect(merger.pop(at(5))).To(BeEmpty())
+		Expect(texts(merger.pop(at(6)))).To(Equal([]string{"c"}))
+	})
+})
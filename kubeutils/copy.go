@@ -0,0 +1,198 @@
+package kubeutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/client-go/rest"
+)
+
+var UnsafeArchivePathError = func(name string) error {
+	return eris.Errorf("archive entry %s points outside of the destination", name)
+}
+
+// CopyToPod copies a local file or directory into a directory of a container, like kubectl cp. The container needs
+// a tar binary.
+func CopyToPod(ctx context.Context, cfg *rest.Config, target ContainerRef, localPath, remoteDir string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(WriteTar(writer, localPath))
+	}()
+	defer reader.Close()
+	stderr := &bytes.Buffer{}
+	exitCode, err := StreamExecInPod(ctx, cfg, target, []string{"tar", "-xmf", "-", "-C", remoteDir}, reader, io.Discard, stderr)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return eris.Errorf("unable to copy %s to %s in pod %s.%s (exit code %d): %s",
+			localPath, remoteDir, target.Namespace, target.Pod, exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// CopyFromPod copies a file or directory of a container into a local directory, like kubectl cp. The container
+// needs a tar binary.
+func CopyFromPod(ctx context.Context, cfg *rest.Config, target ContainerRef, remotePath, localDir string) error {
+	reader, writer := io.Pipe()
+	stderr := &bytes.Buffer{}
+	eg := errgroup.Group{}
+	eg.Go(func() error {
+		command := []string{"tar", "-cf", "-", "-C", path.Dir(remotePath), path.Base(remotePath)}
+		exitCode, err := StreamExecInPod(ctx, cfg, target, command, nil, writer, stderr)
+		if err == nil && exitCode != 0 {
+			err = eris.Errorf("unable to copy %s from pod %s.%s (exit code %d): %s",
+				remotePath, target.Namespace, target.Pod, exitCode, strings.TrimSpace(stderr.String()))
+		}
+		writer.CloseWithError(err)
+		return err
+	})
+	eg.Go(func() error {
+		err := ExtractTar(reader, localDir)
+		// unblock the exec if extracting failed
+		reader.CloseWithError(err)
+		return err
+	})
+	return eg.Wait()
+}
+
+// WriteTar writes a file or directory to a tar archive, with paths relative to the parent of srcPath
+func WriteTar(w io.Writer, srcPath string) error {
+	tw := tar.NewWriter(w)
+	base := filepath.Dir(filepath.Clean(srcPath))
+	err := filepath.Walk(srcPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(base, file)
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExtractTar extracts a tar archive into destDir. Entries which would be written outside of destDir, directly or
+// through a symlink, are rejected.
+func ExtractTar(r io.Reader, destDir string) error {
+	destDir, err := filepath.Abs(destDir)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(header.Name))
+		if !isWithin(destDir, target) {
+			return UnsafeArchivePathError(header.Name)
+		}
+		if err := checkNoSymlinkParents(destDir, target); err != nil {
+			return err
+		}
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			linkTarget := header.Linkname
+			if !filepath.IsAbs(linkTarget) {
+				linkTarget = filepath.Join(filepath.Dir(target), linkTarget)
+			}
+			if filepath.IsAbs(header.Linkname) || !isWithin(destDir, linkTarget) {
+				return UnsafeArchivePathError(header.Name)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			// devices, fifos and hard links are not needed to copy test files
+		}
+	}
+}
+
+func isWithin(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// guards against archives which first create a symlink to outside of the destination, then write through it
+func checkNoSymlinkParents(destDir, target string) error {
+	rel, err := filepath.Rel(destDir, filepath.Dir(target))
+	if err != nil || rel == "." {
+		return err
+	}
+	current := destDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return UnsafeArchivePathError(target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package kubeutils_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/k8s-utils/kubeutils"
+)
+
+var _ = Describe("tar copy", func() {
+	var src, dest string
+
+	BeforeEach(func() {
+		src, dest = GinkgoT().TempDir(), GinkgoT().TempDir()
+	})
+
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		b := &bytes.Buffer{}
+		tw := tar.NewWriter(b)
+		for _, header := range headers {
+			header.Mode = 0644
+			Expect(tw.WriteHeader(header)).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).NotTo(HaveOccurred())
+		return b
+	}
+
+	It("copies directories", func() {
+		Expect(os.MkdirAll(filepath.Join(src, "config", "nested"), 0755)).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(src, "config", "envoy.yaml"), []byte("admin: {}"), 0600)).NotTo(HaveOccurred())
+		Expect(os.WriteFile(filepath.Join(src, "config", "nested", "run.sh"), []byte("#!/bin/sh"), 0755)).NotTo(HaveOccurred())
+		Expect(os.Symlink("envoy.yaml", filepath.Join(src, "config", "current.yaml"))).NotTo(HaveOccurred())
+
+		b := &bytes.Buffer{}
+		Expect(WriteTar(b, filepath.Join(src, "config"))).NotTo(HaveOccurred())
+		Expect(ExtractTar(b, dest)).NotTo(HaveOccurred())
+
+		contents, err := os.ReadFile(filepath.Join(dest, "config", "envoy.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("admin: {}"))
+		info, err := os.Stat(filepath.Join(dest, "config", "nested", "run.sh"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+		contents, err = os.ReadFile(filepath.Join(dest, "config", "current.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("admin: {}"))
+	})
+
+	It("copies single files", func() {
+		Expect(os.WriteFile(filepath.Join(src, "envoy.yaml"), []byte("admin: {}"), 0644)).NotTo(HaveOccurred())
+		b := &bytes.Buffer{}
+		Expect(WriteTar(b, filepath.Join(src, "envoy.yaml"))).NotTo(HaveOccurred())
+		Expect(ExtractTar(b, dest)).NotTo(HaveOccurred())
+		Expect(filepath.Join(dest, "envoy.yaml")).To(BeAnExistingFile())
+	})
+
+	It("rejects entries outside of the destination", func() {
+		err := ExtractTar(archive(&tar.Header{Name: "../escape", Typeflag: tar.TypeReg}), dest)
+		Expect(err).To(MatchError(ContainSubstring("points outside of the destination")))
+		Expect(filepath.Join(filepath.Dir(dest), "escape")).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects symlinks outside of the destination", func() {
+		err := ExtractTar(archive(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}), dest)
+		Expect(err).To(MatchError(ContainSubstring("points outside of the destination")))
+
+		err = ExtractTar(archive(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "../.."}), dest)
+		Expect(err).To(MatchError(ContainSubstring("points outside of the destination")))
+	})
+
+	It("rejects writing through symlinks", func() {
+		err := ExtractTar(archive(
+			&tar.Header{Name: "dir", Typeflag: tar.TypeDir},
+			&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "dir"},
+			&tar.Header{Name: "link/file", Typeflag: tar.TypeReg},
+		), dest)
+		Expect(err).To(MatchError(ContainSubstring("points outside of the destination")))
+	})
+})
@@ -0,0 +1,98 @@
+package kubeutils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/rotisserie/eris"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// ContainerRef identifies a container of a pod. The container may be empty for pods with a single container.
+type ContainerRef struct {
+	Namespace string
+	Pod       string
+	Container string
+}
+
+type ExecResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExecInPod runs a command in a container like kubectl exec, without needing kubectl. A command which ran and exited
+// with a non-zero code is not an error, its exit code is returned in the result.
+func ExecInPod(ctx context.Context, cfg *rest.Config, target ContainerRef, command []string, stdin io.Reader) (*ExecResult, error) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	exitCode, err := StreamExecInPod(ctx, cfg, target, command, stdin, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecResult{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		ExitCode: exitCode,
+	}, nil
+}
+
+// StreamExecInPod runs a command in a container, streaming its output as it is written, and returns its exit code
+func StreamExecInPod(ctx context.Context, cfg *rest.Config, target ContainerRef, command []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return 0, err
+	}
+	request := kube.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(target.Namespace).
+		Name(target.Pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: target.Container,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, scheme.ParameterCodec)
+
+	executor, err := newExecutor(cfg, request)
+	if err != nil {
+		return 0, eris.Wrapf(err, "unable to exec in pod %s.%s", target.Namespace, target.Pod)
+	}
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Exited() {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, eris.Wrapf(err, "unable to exec in pod %s.%s", target.Namespace, target.Pod)
+	}
+	return 0, nil
+}
+
+// like kubectl, use websockets and fall back to spdy for api servers which don't support them
+func newExecutor(cfg *rest.Config, request *rest.Request) (remotecommand.Executor, error) {
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(cfg, "POST", request.URL())
+	if err != nil {
+		return nil, err
+	}
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(cfg, "GET", request.URL().String())
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
@@ -0,0 +1,187 @@
+package kubeutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/rotisserie/eris"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+var NoReadyPodsError = func(namespace, service string) error {
+	return eris.Errorf("no ready pods found for service %s.%s", namespace, service)
+}
+
+var ServiceWithoutSelectorError = func(namespace, service string) error {
+	return eris.Errorf("service %s.%s has no pod selector", namespace, service)
+}
+
+var ServicePortNotFoundError = func(namespace, service string, port int) error {
+	return eris.Errorf("service %s.%s has no port %d", namespace, service, port)
+}
+
+// PortForwardPod forwards a local port to a port of a pod, like kubectl port-forward, until the returned stop function
+// is called or the context is cancelled. The local port is picked at random if localPort is 0. Returns the local
+// address to connect to, e.g. 127.0.0.1:54321.
+func PortForwardPod(ctx context.Context, cfg *rest.Config, namespace, pod string, localPort, remotePort int) (string, func(), error) {
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	request := kube.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", request.URL())
+	// like kubectl, use websockets and fall back to spdy for api servers which don't support them
+	websocketDialer, err := portforward.NewSPDYOverWebsocketDialer(request.URL(), cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	dialer = portforward.NewFallbackDialer(websocketDialer, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	stopChan, readyChan := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(stopChan)
+		})
+	}
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"},
+		[]string{fmt.Sprintf("%d:%d", localPort, remotePort)}, stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		return "", nil, eris.Wrapf(err, "unable to port-forward to pod %s.%s", namespace, pod)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.ForwardPorts()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			stop()
+		case <-stopChan:
+		}
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		stop()
+		return "", nil, eris.Wrapf(err, "unable to port-forward to pod %s.%s", namespace, pod)
+	case <-ctx.Done():
+		stop()
+		return "", nil, ctx.Err()
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		stop()
+		return "", nil, eris.Wrapf(err, "unable to port-forward to pod %s.%s", namespace, pod)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", ports[0].Local), stop, nil
+}
+
+// PortForwardService forwards a local port to a port of a service through one of its ready pods, like
+// kubectl port-forward svc/<service>. The connection is not moved to another pod if that pod goes away.
+func PortForwardService(ctx context.Context, cfg *rest.Config, namespace, service string, localPort, servicePort int) (string, func(), error) {
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+	pod, podPort, err := ServicePodPort(ctx, kube, namespace, service, servicePort)
+	if err != nil {
+		return "", nil, err
+	}
+	return PortForwardPod(ctx, cfg, namespace, pod, localPort, podPort)
+}
+
+// ServicePodPort picks a ready pod of a service, and resolves a port of the service to the port of that pod. Services
+// without a selector, such as ExternalName services or services backed by manually managed endpoints, are rejected,
+// as an empty selector would match every pod in the namespace.
+func ServicePodPort(ctx context.Context, kube kubernetes.Interface, namespace, service string, servicePort int) (string, int, error) {
+	svc, err := kube.CoreV1().Services(namespace).Get(ctx, service, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, ServiceWithoutSelectorError(namespace, service)
+	}
+	var targetPort *intstr.IntOrString
+	for _, port := range svc.Spec.Ports {
+		if int(port.Port) == servicePort {
+			targetPort = &port.TargetPort
+			break
+		}
+	}
+	if targetPort == nil {
+		return "", 0, ServicePortNotFoundError(namespace, service, servicePort)
+	}
+
+	pods, err := kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	for _, pod := range pods.Items {
+		if !isPodReady(pod) {
+			continue
+		}
+		switch {
+		case targetPort.Type == intstr.String && targetPort.StrVal != "":
+			// named ports are resolved per pod, as pods of a service may use different numbers for the same name
+			if port, ok := namedContainerPort(pod, targetPort.StrVal); ok {
+				return pod.Name, port, nil
+			}
+		case targetPort.IntValue() != 0:
+			return pod.Name, targetPort.IntValue(), nil
+		default:
+			// the target port defaults to the service port
+			return pod.Name, servicePort, nil
+		}
+	}
+	return "", 0, NoReadyPodsError(namespace, service)
+}
+
+func isPodReady(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func namedContainerPort(pod corev1.Pod, name string) (int, bool) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name {
+				return int(port.ContainerPort), true
+			}
+		}
+	}
+	return 0, false
+}
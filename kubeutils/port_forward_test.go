@@ -0,0 +1,86 @@
+package kubeutils_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/solo-io/k8s-utils/kubeutils"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("ServicePodPort", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	pod := func(name string, ready bool, port int32) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "gloo-system", Labels: map[string]string{"gloo": "gateway-proxy"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "gateway-proxy",
+				Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: port}},
+			}}},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+			},
+		}
+	}
+
+	service := func(targetPort intstr.IntOrString) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "gateway-proxy", Namespace: "gloo-system"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"gloo": "gateway-proxy"},
+				Ports:    []corev1.ServicePort{{Port: 80, TargetPort: targetPort}},
+			},
+		}
+	}
+
+	It("resolves named ports on a ready pod", func() {
+		kube := fake.NewClientset(service(intstr.FromString("http")), pod("not-ready", false, 8080), pod("ready", true, 8081))
+		name, port, err := ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 80)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(name).To(Equal("ready"))
+		Expect(port).To(Equal(8081))
+	})
+
+	It("resolves numeric and default target ports", func() {
+		kube := fake.NewClientset(service(intstr.FromInt32(8443)), pod("ready", true, 8080))
+		_, port, err := ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 80)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(port).To(Equal(8443))
+
+		kube = fake.NewClientset(service(intstr.IntOrString{}), pod("ready", true, 8080))
+		_, port, err = ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 80)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(port).To(Equal(80))
+	})
+
+	It("fails without ready pods or a matching port", func() {
+		kube := fake.NewClientset(service(intstr.FromString("http")), pod("not-ready", false, 8080))
+		_, _, err := ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 80)
+		Expect(err).To(MatchError(NoReadyPodsError("gloo-system", "gateway-proxy").Error()))
+
+		_, _, err = ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 443)
+		Expect(err).To(MatchError(ServicePortNotFoundError("gloo-system", "gateway-proxy", 443).Error()))
+	})
+
+	It("does not pick pods for services without a selector", func() {
+		svc := service(intstr.FromString("http"))
+		svc.Spec.Selector = nil
+		kube := fake.NewClientset(svc, pod("unrelated", true, 8080))
+		_, _, err := ServicePodPort(ctx, kube, "gloo-system", "gateway-proxy", 80)
+		Expect(err).To(MatchError(ServiceWithoutSelectorError("gloo-system", "gateway-proxy").Error()))
+	})
+})
@@ -1,18 +1,16 @@
 package networkutils
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"net"
 	"strconv"
 	"strings"
 
 	"github.com/rotisserie/eris"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -26,117 +24,175 @@ type ServiceRef struct {
 	Namespace string
 }
 
-func GetIngressHostAndPort(ctx context.Context, restCfg *rest.Config, ref *ServiceRef, proxyPort string) (string, uint32, error) {
-	url, err := GetIngressHost(ctx, restCfg, ref, proxyPort)
-	if err != nil {
-		return "", 0, err
+// IngressTarget is the service, and the port of it, whose address strategies resolve
+type IngressTarget struct {
+	Service *v1.Service
+	Port    *v1.ServicePort
+}
+
+// IngressAddress is an address at which a service can be reached from outside the cluster
+type IngressAddress struct {
+	Host string
+	Port uint32
+	// name of the strategy which resolved the address
+	Strategy string
+
+	// stops the port-forward of addresses resolved by forwarding
+	stop func()
+}
+
+func (a *IngressAddress) String() string {
+	return net.JoinHostPort(a.Host, strconv.Itoa(int(a.Port)))
+}
+
+// Close releases what the address holds on to, i.e. stops the port-forward of addresses resolved by forwarding
+func (a *IngressAddress) Close() {
+	if a.stop != nil {
+		a.stop()
 	}
-	url = strings.TrimPrefix(url, "https://")
-	url = strings.TrimPrefix(url, "http://")
-	parts := strings.Split(url, ":")
-	if len(parts) == 2 {
-		port, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return "", 0, eris.Wrapf(err, "could not convert port to int")
-		}
-		return parts[0], uint32(port), nil
+}
+
+// NoAddressError is returned by strategies which do not apply to a service, e.g. by the load balancer strategy for
+// services without load balancer ingress. Resolving moves on to the next strategy then, and returns a NoAddressError
+// itself when no strategy applies.
+type NoAddressError struct {
+	Reason string
+}
+
+func (e *NoAddressError) Error() string {
+	return e.Reason
+}
+
+func IsNoAddressError(err error) bool {
+	var noAddressErr *NoAddressError
+	return errors.As(err, &noAddressErr)
+}
+
+func noAddress(format string, args ...interface{}) error {
+	return &NoAddressError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// IngressAddressStrategy resolves the address of a service in one kind of environment. Strategies return a
+// NoAddressError when they do not apply to the service.
+type IngressAddressStrategy interface {
+	Name() string
+	Address(ctx context.Context, target *IngressTarget) (*IngressAddress, error)
+}
+
+// IngressResolver resolves the address of a service with the first of its strategies which applies
+type IngressResolver struct {
+	kube       kubernetes.Interface
+	strategies []IngressAddressStrategy
+}
+
+func NewIngressResolver(kube kubernetes.Interface, strategies ...IngressAddressStrategy) *IngressResolver {
+	return &IngressResolver{
+		kube:       kube,
+		strategies: strategies,
 	}
-	return "", 0, eris.Errorf("Unexpected url %s", url)
 }
 
-func GetIngressHost(ctx context.Context, restCfg *rest.Config, ref *ServiceRef, proxyPort string) (string, error) {
-	kube, err := kubernetes.NewForConfig(restCfg)
-	if err != nil {
-		return "", err
+// DefaultIngressStrategies resolve load balancer ingress, external IPs, and node ports on kind and k3d nodes and on
+// any other node, in that order
+func DefaultIngressStrategies(kube kubernetes.Interface) []IngressAddressStrategy {
+	return []IngressAddressStrategy{
+		LoadBalancerStrategy(),
+		ExternalIPsStrategy(),
+		DockerNodePortStrategy(kube),
+		NodePortStrategy(kube),
 	}
+}
+
+// Target gets the service and selects its port. Services with a single port always use it, otherwise the proxy port
+// is matched against the port names first and against the port numbers second.
+func (r *IngressResolver) Target(ctx context.Context, ref *ServiceRef, proxyPort string) (*IngressTarget, error) {
 	namespace, name := ref.Namespace, ref.Name
-	svc, err := kube.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	svc, err := r.kube.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		return "", eris.Wrapf(err, "could not detect '%v' service in %v namespace", name, namespace)
+		// keeps the status error, so that waiting can tell a missing service from a forbidden request
+		return nil, fmt.Errorf("could not detect '%v' service in %v namespace: %w", name, namespace, err)
 	}
-	var svcPort *v1.ServicePort
-	switch len(svc.Spec.Ports) {
-	case 0:
-		return "", eris.Errorf("service %v is missing ports", name)
-	case 1:
-		svcPort = &svc.Spec.Ports[0]
-	default:
-		for _, p := range svc.Spec.Ports {
-			if p.Name == proxyPort {
-				svcPort = &p
-				break
-			}
-		}
-		if svcPort == nil {
-			return "", eris.Errorf("named port %v not found on service %v", proxyPort, name)
-		}
+	svcPort, err := selectServicePort(svc, proxyPort)
+	if err != nil {
+		return nil, err
 	}
+	return &IngressTarget{Service: svc, Port: svcPort}, nil
+}
 
-	var host, port string
-	if len(svc.Status.LoadBalancer.Ingress) == 0 {
-		// assume nodeport on kubernetes
-		// TODO: support more types of NodePort services
-		host, err = getNodeIp(ctx, svc, kube)
+// Resolve returns the address resolved by the first strategy which applies to the service. The address needs to be
+// closed once it is no longer used.
+func (r *IngressResolver) Resolve(ctx context.Context, ref *ServiceRef, proxyPort string) (*IngressAddress, error) {
+	target, err := r.Target(ctx, ref, proxyPort)
+	if err != nil {
+		return nil, err
+	}
+	return r.ResolveTarget(ctx, target)
+}
+
+func (r *IngressResolver) ResolveTarget(ctx context.Context, target *IngressTarget) (*IngressAddress, error) {
+	var reasons []string
+	for _, strategy := range r.strategies {
+		addr, err := strategy.Address(ctx, target)
+		if IsNoAddressError(err) {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", strategy.Name(), err))
+			continue
+		}
 		if err != nil {
-			return "", eris.Wrapf(err, "")
+			return nil, eris.Wrapf(err, "resolving the %s address of service %v", strategy.Name(), target.Service.Name)
 		}
-		port = fmt.Sprintf("%v", svcPort.NodePort)
-	} else {
-		host = svc.Status.LoadBalancer.Ingress[0].Hostname
-		if host == "" {
-			host = svc.Status.LoadBalancer.Ingress[0].IP
+		if addr.Strategy == "" {
+			addr.Strategy = strategy.Name()
 		}
-		port = fmt.Sprintf("%v", svcPort.Port)
+		return addr, nil
 	}
-	return host + ":" + port, nil
+	return nil, noAddress("no address found for service %v in %v namespace (%s)",
+		target.Service.Name, target.Service.Namespace, strings.Join(reasons, "; "))
 }
 
-func getNodeIp(ctx context.Context, svc *v1.Service, kube kubernetes.Interface) (string, error) {
-	// pick a node where one of our pods is running
-	pods, err := kube.CoreV1().Pods(svc.Namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
-	})
-	if err != nil {
-		return "", err
+func selectServicePort(svc *v1.Service, proxyPort string) (*v1.ServicePort, error) {
+	switch len(svc.Spec.Ports) {
+	case 0:
+		return nil, eris.Errorf("service %v is missing ports", svc.Name)
+	case 1:
+		return &svc.Spec.Ports[0], nil
 	}
-	var nodeName string
-	for _, pod := range pods.Items {
-		if pod.Spec.NodeName != "" {
-			nodeName = pod.Spec.NodeName
-			break
+	for i, p := range svc.Spec.Ports {
+		if p.Name == proxyPort {
+			return &svc.Spec.Ports[i], nil
 		}
 	}
-	if nodeName == "" {
-		return "", eris.Errorf("no node found for %v's pods. ensure at least one pod has been deployed "+
-			"for the %v service", svc.Name, svc.Name)
-	}
-	// special case for minikube
-	// we run `minikube ip` which avoids an issue where
-	// we get a NAT network IP when the minikube provider is virtualbox
-	if nodeName == "minikube" {
-		return minikubeIp(LocalClusterName)
+	if number, err := strconv.Atoi(proxyPort); err == nil {
+		for i, p := range svc.Spec.Ports {
+			if int(p.Port) == number {
+				return &svc.Spec.Ports[i], nil
+			}
+		}
 	}
+	return nil, eris.Errorf("port %v not found on service %v", proxyPort, svc.Name)
+}
 
-	node, err := kube.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+func GetIngressHostAndPort(ctx context.Context, restCfg *rest.Config, ref *ServiceRef, proxyPort string) (string, uint32, error) {
+	addr, err := resolveIngressAddress(ctx, restCfg, ref, proxyPort)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
+	return addr.Host, addr.Port, nil
+}
 
-	for _, addr := range node.Status.Addresses {
-		return addr.Address, nil
+// GetIngressHost resolves the host:port of a service with the DefaultIngressStrategies. It does not wait for load
+// balancers to be provisioned, see WaitForIngressAddress for that.
+func GetIngressHost(ctx context.Context, restCfg *rest.Config, ref *ServiceRef, proxyPort string) (string, error) {
+	addr, err := resolveIngressAddress(ctx, restCfg, ref, proxyPort)
+	if err != nil {
+		return "", err
 	}
-
-	return "", eris.Errorf("no active addresses found for node %v", node.Name)
+	return addr.String(), nil
 }
 
-func minikubeIp(clusterName string) (string, error) {
-	minikubeCmd := exec.Command("minikube", "ip", "-p", clusterName)
-
-	hostname := &bytes.Buffer{}
-
-	minikubeCmd.Stdout = hostname
-	minikubeCmd.Stderr = os.Stderr
-	err := minikubeCmd.Run()
-
-	return strings.TrimSuffix(hostname.String(), "\n"), err
+func resolveIngressAddress(ctx context.Context, restCfg *rest.Config, ref *ServiceRef, proxyPort string) (*IngressAddress, error) {
+	kube, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewIngressResolver(kube, DefaultIngressStrategies(kube)...).Resolve(ctx, ref, proxyPort)
 }
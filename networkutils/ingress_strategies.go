@@ -0,0 +1,292 @@
+package networkutils
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	v1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var GatewayGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+
+// LoadBalancerStrategy resolves the first load balancer ingress of the service
+func LoadBalancerStrategy() IngressAddressStrategy {
+	return loadBalancerStrategy{}
+}
+
+type loadBalancerStrategy struct{}
+
+func (loadBalancerStrategy) Name() string {
+	return "load balancer"
+}
+
+func (loadBalancerStrategy) Address(_ context.Context, target *IngressTarget) (*IngressAddress, error) {
+	ingress := target.Service.Status.LoadBalancer.Ingress
+	if len(ingress) == 0 {
+		return nil, noAddress("service has no load balancer ingress")
+	}
+	host := ingress[0].Hostname
+	if host == "" {
+		host = ingress[0].IP
+	}
+	return &IngressAddress{Host: host, Port: uint32(target.Port.Port)}, nil
+}
+
+// ExternalIPsStrategy resolves the first external IP of the service
+func ExternalIPsStrategy() IngressAddressStrategy {
+	return externalIPsStrategy{}
+}
+
+type externalIPsStrategy struct{}
+
+func (externalIPsStrategy) Name() string {
+	return "external IPs"
+}
+
+func (externalIPsStrategy) Address(_ context.Context, target *IngressTarget) (*IngressAddress, error) {
+	if len(target.Service.Spec.ExternalIPs) == 0 {
+		return nil, noAddress("service has no external IPs")
+	}
+	return &IngressAddress{Host: target.Service.Spec.ExternalIPs[0], Port: uint32(target.Port.Port)}, nil
+}
+
+// NodePortStrategy resolves the node port of the service on the first address of the node of one of its pods. On
+// minikube it runs `minikube ip`, which avoids getting a NAT network IP when the minikube provider is virtualbox.
+func NodePortStrategy(kube kubernetes.Interface) IngressAddressStrategy {
+	return &nodePortStrategy{
+		name:        "node port",
+		kube:        kube,
+		nodeAddress: nodeAddress,
+	}
+}
+
+// DockerNodePortStrategy resolves the node port of the service on the internal IP of the node of one of its pods,
+// which is the address of the node container on the docker network of kind and k3d clusters. It does not apply to
+// other clusters.
+func DockerNodePortStrategy(kube kubernetes.Interface) IngressAddressStrategy {
+	return &nodePortStrategy{
+		name:        "docker node port",
+		kube:        kube,
+		nodeAddress: dockerNodeAddress,
+	}
+}
+
+type nodePortStrategy struct {
+	name        string
+	kube        kubernetes.Interface
+	nodeAddress func(node *v1.Node) (string, error)
+}
+
+func (s *nodePortStrategy) Name() string {
+	return s.name
+}
+
+func (s *nodePortStrategy) Address(ctx context.Context, target *IngressTarget) (*IngressAddress, error) {
+	if target.Port.NodePort == 0 {
+		return nil, noAddress("port %v has no node port", target.Port.Port)
+	}
+	node, err := s.podNode(ctx, target.Service)
+	if err != nil {
+		return nil, err
+	}
+	host, err := s.nodeAddress(node)
+	if err != nil {
+		return nil, err
+	}
+	return &IngressAddress{Host: host, Port: uint32(target.Port.NodePort)}, nil
+}
+
+// picks a node where one of the pods of the service is running
+func (s *nodePortStrategy) podNode(ctx context.Context, svc *v1.Service) (*v1.Node, error) {
+	pods, err := s.kube.CoreV1().Pods(svc.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var nodeName string
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			nodeName = pod.Spec.NodeName
+			break
+		}
+	}
+	if nodeName == "" {
+		return nil, noAddress("no node found for %v's pods. ensure at least one pod has been deployed "+
+			"for the %v service", svc.Name, svc.Name)
+	}
+	return s.kube.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+}
+
+func nodeAddress(node *v1.Node) (string, error) {
+	if node.Name == LocalClusterName {
+		return minikubeIp(LocalClusterName)
+	}
+	for _, addr := range node.Status.Addresses {
+		return addr.Address, nil
+	}
+	return "", eris.Errorf("no active addresses found for node %v", node.Name)
+}
+
+func dockerNodeAddress(node *v1.Node) (string, error) {
+	// kind sets the provider id of its nodes to kind://..., k3d runs k3s which sets it to k3s://...
+	if !strings.HasPrefix(node.Spec.ProviderID, "kind://") && !strings.HasPrefix(node.Spec.ProviderID, "k3s://") {
+		return "", noAddress("node %v is not a kind or k3d node", node.Name)
+	}
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address, nil
+		}
+	}
+	return "", noAddress("no internal IP found for node %v", node.Name)
+}
+
+func minikubeIp(clusterName string) (string, error) {
+	minikubeCmd := exec.Command("minikube", "ip", "-p", clusterName)
+
+	hostname := &bytes.Buffer{}
+
+	minikubeCmd.Stdout = hostname
+	minikubeCmd.Stderr = os.Stderr
+	err := minikubeCmd.Run()
+
+	return strings.TrimSuffix(hostname.String(), "\n"), err
+}
+
+// GatewayStrategy resolves the first status address of a Gateway API Gateway, on the port of the service. It does
+// not apply until the gateway exists and has an address.
+func GatewayStrategy(client dynamic.Interface, gateway *ServiceRef) IngressAddressStrategy {
+	return &gatewayStrategy{
+		client:  client,
+		gateway: gateway,
+	}
+}
+
+type gatewayStrategy struct {
+	client  dynamic.Interface
+	gateway *ServiceRef
+}
+
+func (s *gatewayStrategy) Name() string {
+	return "gateway"
+}
+
+func (s *gatewayStrategy) Address(ctx context.Context, target *IngressTarget) (*IngressAddress, error) {
+	gw, err := s.client.Resource(GatewayGVR).Namespace(s.gateway.Namespace).Get(ctx, s.gateway.Name, metav1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil, noAddress("gateway %v not found in %v namespace", s.gateway.Name, s.gateway.Namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	addresses, _, err := unstructured.NestedSlice(gw.Object, "status", "addresses")
+	if err != nil {
+		return nil, eris.Wrapf(err, "reading the addresses of gateway %v", s.gateway.Name)
+	}
+	for _, address := range addresses {
+		value, _ := address.(map[string]interface{})["value"].(string)
+		if value != "" {
+			return &IngressAddress{Host: value, Port: uint32(target.Port.Port)}, nil
+		}
+	}
+	return nil, noAddress("gateway %v has no addresses", s.gateway.Name)
+}
+
+// IngressStatusStrategy resolves the first load balancer ingress in the status of an Ingress, on port 443 when the
+// ingress terminates TLS and on port 80 otherwise. It does not apply until the ingress exists and has an address.
+func IngressStatusStrategy(kube kubernetes.Interface, ingress *ServiceRef) IngressAddressStrategy {
+	return &ingressStatusStrategy{
+		kube:    kube,
+		ingress: ingress,
+	}
+}
+
+type ingressStatusStrategy struct {
+	kube    kubernetes.Interface
+	ingress *ServiceRef
+}
+
+func (s *ingressStatusStrategy) Name() string {
+	return "ingress"
+}
+
+func (s *ingressStatusStrategy) Address(ctx context.Context, _ *IngressTarget) (*IngressAddress, error) {
+	ing, err := s.kube.NetworkingV1().Ingresses(s.ingress.Namespace).Get(ctx, s.ingress.Name, metav1.GetOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil, noAddress("ingress %v not found in %v namespace", s.ingress.Name, s.ingress.Namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ing.Status.LoadBalancer.Ingress) == 0 {
+		return nil, noAddress("ingress %v has no load balancer ingress", s.ingress.Name)
+	}
+	host := ing.Status.LoadBalancer.Ingress[0].Hostname
+	if host == "" {
+		host = ing.Status.LoadBalancer.Ingress[0].IP
+	}
+	port := uint32(80)
+	if len(ing.Spec.TLS) > 0 {
+		port = 443
+	}
+	return &IngressAddress{Host: host, Port: port}, nil
+}
+
+// ServicePortForwarder forwards a local port to a port of a service. It returns the local address, and a function
+// stopping the forward.
+type ServicePortForwarder func(ctx context.Context, namespace, service string, servicePort int) (string, func(), error)
+
+// KubePortForwarder forwards to one of the ready pods of the service, like kubectl port-forward svc/<service>
+func KubePortForwarder(cfg *rest.Config) ServicePortForwarder {
+	return func(ctx context.Context, namespace, service string, servicePort int) (string, func(), error) {
+		return kubeutils.PortForwardService(ctx, cfg, namespace, service, 0, servicePort)
+	}
+}
+
+// PortForwardStrategy resolves a local address forwarding to the service. It always applies, so it belongs last.
+// The forward stops when the address is closed or the context is done, so the context needs to outlive the use of
+// the address.
+func PortForwardStrategy(forward ServicePortForwarder) IngressAddressStrategy {
+	return &portForwardStrategy{forward: forward}
+}
+
+type portForwardStrategy struct {
+	forward ServicePortForwarder
+}
+
+func (s *portForwardStrategy) Name() string {
+	return "port-forward"
+}
+
+func (s *portForwardStrategy) Address(ctx context.Context, target *IngressTarget) (*IngressAddress, error) {
+	local, stop, err := s.forward(ctx, target.Service.Namespace, target.Service.Name, int(target.Port.Port))
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(local)
+	if err != nil {
+		stop()
+		return nil, eris.Wrapf(err, "unexpected address %s", local)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		stop()
+		return nil, eris.Wrapf(err, "could not convert port to int")
+	}
+	return &IngressAddress{Host: host, Port: uint32(portNumber), stop: stop}, nil
+}
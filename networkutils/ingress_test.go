@@ -0,0 +1,211 @@
+package networkutils_test
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/networkutils"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("ingress address resolution", func() {
+	var (
+		ctx       context.Context
+		clientset *fake.Clientset
+		ref       *networkutils.ServiceRef
+	)
+
+	service := func(ports ...corev1.ServicePort) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gloo-system", Name: "gateway-proxy"},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{"app": "gateway-proxy"},
+				Ports:    ports,
+			},
+		}
+	}
+
+	httpPort := corev1.ServicePort{Name: "http", Port: 80, NodePort: 30080}
+	httpsPort := corev1.ServicePort{Name: "https", Port: 443, NodePort: 30443}
+
+	create := func(objects ...runtime.Object) {
+		for _, obj := range objects {
+			Expect(clientset.Tracker().Add(obj)).To(Succeed())
+		}
+	}
+
+	podOn := func(node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gloo-system", Name: "gateway-proxy-abc", Labels: map[string]string{"app": "gateway-proxy"}},
+			Spec:       corev1.PodSpec{NodeName: node},
+		}
+	}
+
+	node := func(name, providerID string, addresses ...corev1.NodeAddress) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.NodeSpec{ProviderID: providerID},
+			Status:     corev1.NodeStatus{Addresses: addresses},
+		}
+	}
+
+	resolve := func(proxyPort string, strategies ...networkutils.IngressAddressStrategy) (*networkutils.IngressAddress, error) {
+		return networkutils.NewIngressResolver(clientset, strategies...).Resolve(ctx, ref, proxyPort)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clientset = fake.NewClientset()
+		ref = &networkutils.ServiceRef{Namespace: "gloo-system", Name: "gateway-proxy"}
+	})
+
+	Context("port selection", func() {
+		It("selects ports by name or number", func() {
+			svc := service(httpPort, httpsPort)
+			svc.Spec.ExternalIPs = []string{"10.0.0.1"}
+			create(svc)
+
+			addr, err := resolve("https", networkutils.ExternalIPsStrategy())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.String()).To(Equal("10.0.0.1:443"))
+
+			addr, err = resolve("80", networkutils.ExternalIPsStrategy())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.String()).To(Equal("10.0.0.1:80"))
+
+			_, err = resolve("8080", networkutils.ExternalIPsStrategy())
+			Expect(err).To(MatchError(ContainSubstring("port 8080 not found on service gateway-proxy")))
+		})
+
+		It("uses the only port of services with a single port", func() {
+			svc := service(httpPort)
+			svc.Spec.ExternalIPs = []string{"10.0.0.1"}
+			create(svc)
+
+			addr, err := resolve("https", networkutils.ExternalIPsStrategy())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.Port).To(Equal(uint32(80)))
+		})
+	})
+
+	It("prefers load balancer ingress and falls back to node ports", func() {
+		svc := service(httpPort)
+		create(svc, podOn("worker"), node("worker", "", corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "172.18.0.3"}))
+
+		addr, err := resolve("http", networkutils.DefaultIngressStrategies(clientset)...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal("172.18.0.3:30080"))
+		Expect(addr.Strategy).To(Equal("node port"))
+
+		svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "35.1.2.3"}}
+		_, err = clientset.CoreV1().Services("gloo-system").UpdateStatus(ctx, svc, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		addr, err = resolve("http", networkutils.DefaultIngressStrategies(clientset)...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal("35.1.2.3:80"))
+		Expect(addr.Strategy).To(Equal("load balancer"))
+	})
+
+	DescribeTable("resolves the internal IP of kind and k3d nodes",
+		func(providerID string) {
+			create(service(httpPort), podOn("control-plane"), node("control-plane", providerID,
+				corev1.NodeAddress{Type: corev1.NodeHostName, Address: "control-plane"},
+				corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "172.18.0.2"},
+			))
+
+			addr, err := resolve("http", networkutils.DockerNodePortStrategy(clientset))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(addr.String()).To(Equal("172.18.0.2:30080"))
+		},
+		Entry("kind", "kind://docker/kind/kind-control-plane"),
+		Entry("k3d", "k3s://k3d-test-server-0"),
+	)
+
+	It("explains why no strategy applies", func() {
+		create(service(httpPort), podOn("worker"), node("worker", "aws:///us-east-1a/i-0123"))
+
+		_, err := resolve("http", networkutils.LoadBalancerStrategy(), networkutils.ExternalIPsStrategy(), networkutils.DockerNodePortStrategy(clientset))
+		Expect(networkutils.IsNoAddressError(err)).To(BeTrue())
+		Expect(err).To(MatchError("no address found for service gateway-proxy in gloo-system namespace (" +
+			"load balancer: service has no load balancer ingress; " +
+			"external IPs: service has no external IPs; " +
+			"docker node port: node worker is not a kind or k3d node)"))
+	})
+
+	It("resolves gateway status addresses", func() {
+		create(service(httpPort))
+		gateway := &unstructured.Unstructured{}
+		gateway.SetAPIVersion("gateway.networking.k8s.io/v1")
+		gateway.SetKind("Gateway")
+		gateway.SetNamespace("default")
+		gateway.SetName("http")
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{networkutils.GatewayGVR: "GatewayList"})
+		gateway, err := dynamicClient.Resource(networkutils.GatewayGVR).Namespace("default").Create(ctx, gateway, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		strategy := networkutils.GatewayStrategy(dynamicClient, &networkutils.ServiceRef{Namespace: "default", Name: "http"})
+
+		_, err = resolve("http", strategy)
+		Expect(err).To(MatchError(ContainSubstring("gateway: gateway http has no addresses")))
+
+		Expect(unstructured.SetNestedSlice(gateway.Object, []interface{}{
+			map[string]interface{}{"type": "Hostname", "value": "gw.example.com"},
+		}, "status", "addresses")).To(Succeed())
+		_, err = dynamicClient.Resource(networkutils.GatewayGVR).Namespace("default").Update(ctx, gateway, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		addr, err := resolve("http", strategy)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal("gw.example.com:80"))
+	})
+
+	It("resolves ingress status addresses", func() {
+		create(service(httpPort), &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec:       networkingv1.IngressSpec{TLS: []networkingv1.IngressTLS{{Hosts: []string{"web.example.com"}}}},
+			Status: networkingv1.IngressStatus{LoadBalancer: networkingv1.IngressLoadBalancerStatus{
+				Ingress: []networkingv1.IngressLoadBalancerIngress{{Hostname: "lb.example.com"}},
+			}},
+		})
+
+		addr, err := resolve("http",
+			networkutils.IngressStatusStrategy(clientset, &networkutils.ServiceRef{Namespace: "default", Name: "missing"}),
+			networkutils.IngressStatusStrategy(clientset, &networkutils.ServiceRef{Namespace: "default", Name: "web"}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal("lb.example.com:443"))
+	})
+
+	It("falls back to port-forwarding", func() {
+		create(service(httpPort, httpsPort))
+		stopped := false
+		forward := func(_ context.Context, namespace, service string, servicePort int) (string, func(), error) {
+			Expect(fmt.Sprintf("%s/%s:%d", namespace, service, servicePort)).To(Equal("gloo-system/gateway-proxy:443"))
+			return "127.0.0.1:50443", func() { stopped = true }, nil
+		}
+
+		addr, err := resolve("https", networkutils.LoadBalancerStrategy(), networkutils.PortForwardStrategy(forward))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal("127.0.0.1:50443"))
+		Expect(addr.Strategy).To(Equal("port-forward"))
+		Expect(stopped).To(BeFalse())
+		addr.Close()
+		Expect(stopped).To(BeTrue())
+
+		failing := func(context.Context, string, string, int) (string, func(), error) {
+			return "", nil, fmt.Errorf("no ready pods")
+		}
+		_, err = resolve("https", networkutils.PortForwardStrategy(failing), networkutils.ExternalIPsStrategy())
+		Expect(err).To(MatchError("resolving the port-forward address of service gateway-proxy: no ready pods"))
+	})
+})
@@ -0,0 +1,221 @@
+package networkutils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	DefaultIngressWaitTimeout  = 5 * time.Minute
+	DefaultIngressWaitInterval = 2 * time.Second
+	DefaultIngressDialTimeout  = 5 * time.Second
+)
+
+// IngressWaitStage is a stage of waiting for an ingress address
+type IngressWaitStage string
+
+const (
+	AddressAssignmentStage IngressWaitStage = "address assignment"
+	DNSResolutionStage     IngressWaitStage = "DNS resolution"
+	TCPReachabilityStage   IngressWaitStage = "TCP reachability"
+)
+
+// IngressWaitOptions configure WaitForIngressAddress, only the address assignment is waited for by default
+type IngressWaitOptions struct {
+	ProxyPort string
+	// strategies resolving the address, default to the LoadBalancerStrategy so that waiting does not end on a node
+	// port while the load balancer is being provisioned
+	Strategies []IngressAddressStrategy
+	// waits until the host of the address resolves, hosts which are IPs are not looked up
+	CheckDNS bool
+	// waits until a TCP connection to the address can be opened
+	CheckTCP bool
+	// for all stages together, defaults to DefaultIngressWaitTimeout
+	Timeout time.Duration
+	// between attempts, defaults to DefaultIngressWaitInterval
+	Interval time.Duration
+	// of each TCP connection attempt, defaults to DefaultIngressDialTimeout
+	DialTimeout time.Duration
+	// default to the lookup of the default resolver and to dialing with a net.Dialer
+	LookupHost  func(ctx context.Context, host string) ([]string, error)
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// IngressWaitError is returned when waiting for an ingress address does not get past a stage in time
+type IngressWaitError struct {
+	Service ServiceRef
+	Stage   IngressWaitStage
+	Timeout time.Duration
+	// the address resolved before the stage timed out, if any
+	Address string
+	// why the last attempt of the stage failed
+	LastError error
+	// the error of the context
+	Err error
+}
+
+func (e *IngressWaitError) Error() string {
+	msg := fmt.Sprintf("timed out after %v waiting for %s of service %v in %v namespace",
+		e.Timeout, e.Stage, e.Service.Name, e.Service.Namespace)
+	if errors.Is(e.Err, context.Canceled) {
+		msg = fmt.Sprintf("canceled waiting for %s of service %v in %v namespace", e.Stage, e.Service.Name, e.Service.Namespace)
+	}
+	if e.Address != "" {
+		msg += " at " + e.Address
+	}
+	if e.LastError != nil {
+		msg += ": " + e.LastError.Error()
+	}
+	return msg
+}
+
+func (e *IngressWaitError) Unwrap() error {
+	return e.Err
+}
+
+func IsIngressWaitError(err error) bool {
+	var waitErr *IngressWaitError
+	return errors.As(err, &waitErr)
+}
+
+// WaitForIngressAddress waits until an address is assigned to the service, and optionally until its host resolves
+// and it accepts TCP connections. Cloud load balancers may take minutes for each of these. It returns an
+// IngressWaitError naming the stage which did not complete in time. Only errors which may go away are retried while
+// waiting for the address assignment, i.e. the service not being found or no strategy applying to it yet; other
+// errors, such as a missing port or a forbidden request, are returned right away. The address needs to be closed once
+// it is no longer used.
+func WaitForIngressAddress(ctx context.Context, kube kubernetes.Interface, ref *ServiceRef, opts IngressWaitOptions) (*IngressAddress, error) {
+	if len(opts.Strategies) == 0 {
+		opts.Strategies = []IngressAddressStrategy{LoadBalancerStrategy()}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultIngressWaitTimeout
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultIngressWaitInterval
+	}
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = DefaultIngressDialTimeout
+	}
+	if opts.LookupHost == nil {
+		opts.LookupHost = net.DefaultResolver.LookupHost
+	}
+	if opts.DialContext == nil {
+		opts.DialContext = (&net.Dialer{}).DialContext
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	resolver := NewIngressResolver(kube, opts.Strategies...)
+
+	var addr *IngressAddress
+	err := poll(ctx, opts.Interval, func() error {
+		var err error
+		addr, err = resolver.Resolve(ctx, ref, opts.ProxyPort)
+		if err != nil && ctx.Err() == nil && !isRetryableAddressError(err) {
+			return &permanentError{err: err}
+		}
+		return err
+	})
+	var permanentErr *permanentError
+	if errors.As(err, &permanentErr) {
+		return nil, fmt.Errorf("waiting for %s of service %v in %v namespace: %w",
+			AddressAssignmentStage, ref.Name, ref.Namespace, permanentErr.err)
+	}
+	if err != nil {
+		return nil, stageError(ctx, ref, AddressAssignmentStage, opts.Timeout, nil, err)
+	}
+
+	if opts.CheckDNS && net.ParseIP(addr.Host) == nil {
+		err := poll(ctx, opts.Interval, func() error {
+			_, err := opts.LookupHost(ctx, addr.Host)
+			return err
+		})
+		if err != nil {
+			addr.Close()
+			return nil, stageError(ctx, ref, DNSResolutionStage, opts.Timeout, addr, err)
+		}
+	}
+
+	if opts.CheckTCP {
+		err := poll(ctx, opts.Interval, func() error {
+			dialCtx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+			defer cancel()
+			conn, err := opts.DialContext(dialCtx, "tcp", addr.String())
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+		if err != nil {
+			addr.Close()
+			return nil, stageError(ctx, ref, TCPReachabilityStage, opts.Timeout, addr, err)
+		}
+	}
+	return addr, nil
+}
+
+// permanentError is returned by attempts to stop polling
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// the service may not have been created yet and load balancers take a while to be provisioned, anything else does
+// not get better by waiting
+func isRetryableAddressError(err error) bool {
+	return IsNoAddressError(err) || kubeerrors.IsNotFound(err)
+}
+
+// calls attempt every interval until it succeeds or returns a permanentError, and returns the last error of it once
+// the context is done. Errors of attempts cut short by the context are only returned when no attempt failed before.
+func poll(ctx context.Context, interval time.Duration, attempt func() error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastErr error
+	for {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		var permanentErr *permanentError
+		if errors.As(err, &permanentErr) {
+			return err
+		}
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+		select {
+		case <-ctx.Done():
+			return lastErr
+		case <-ticker.C:
+		}
+	}
+}
+
+func stageError(ctx context.Context, ref *ServiceRef, stage IngressWaitStage, timeout time.Duration, addr *IngressAddress, lastErr error) error {
+	waitErr := &IngressWaitError{
+		Service:   *ref,
+		Stage:     stage,
+		Timeout:   timeout,
+		LastError: lastErr,
+		Err:       ctx.Err(),
+	}
+	if addr != nil {
+		waitErr.Address = addr.String()
+	}
+	return waitErr
+}
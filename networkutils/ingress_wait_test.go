@@ -0,0 +1,192 @@
+package networkutils_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/networkutils"
+	corev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("WaitForIngressAddress", func() {
+	var (
+		ctx       context.Context
+		clientset *fake.Clientset
+		ref       *networkutils.ServiceRef
+		listener  net.Listener
+		port      int32
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clientset = fake.NewClientset()
+		ref = &networkutils.ServiceRef{Namespace: "gloo-system", Name: "gateway-proxy"}
+
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			// some specs close it themselves
+			_ = listener.Close()
+		})
+		port = int32(listener.Addr().(*net.TCPAddr).Port)
+
+		_, err = clientset.CoreV1().Services("gloo-system").Create(ctx, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "gloo-system", Name: "gateway-proxy"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: port, NodePort: 30080}}},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	assignLater := func(ingress corev1.LoadBalancerIngress) {
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			svc, err := clientset.CoreV1().Services("gloo-system").Get(ctx, "gateway-proxy", metav1.GetOptions{})
+			Expect(err).NotTo(HaveOccurred())
+			svc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{ingress}
+			_, err = clientset.CoreV1().Services("gloo-system").UpdateStatus(ctx, svc, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+
+	It("waits for the load balancer to be assigned and reachable", func() {
+		assignLater(corev1.LoadBalancerIngress{IP: "127.0.0.1"})
+
+		addr, err := networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			CheckDNS: true,
+			CheckTCP: true,
+			Timeout:  5 * time.Second,
+			Interval: 10 * time.Millisecond,
+			LookupHost: func(context.Context, string) ([]string, error) {
+				Fail("IPs are not looked up")
+				return nil, nil
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.String()).To(Equal(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))))
+		Expect(addr.Strategy).To(Equal("load balancer"))
+	})
+
+	It("does not fall back to node ports while the load balancer is provisioned", func() {
+		_, err := networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			Timeout:  100 * time.Millisecond,
+			Interval: 10 * time.Millisecond,
+		})
+		Expect(networkutils.IsIngressWaitError(err)).To(BeTrue())
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(err).To(MatchError("timed out after 100ms waiting for address assignment of service gateway-proxy in gloo-system namespace: " +
+			"no address found for service gateway-proxy in gloo-system namespace (load balancer: service has no load balancer ingress)"))
+	})
+
+	It("waits for the service to be created", func() {
+		ref = &networkutils.ServiceRef{Namespace: "gloo-system", Name: "gateway-proxy-2"}
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			_, err := clientset.CoreV1().Services("gloo-system").Create(ctx, &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "gloo-system", Name: "gateway-proxy-2"},
+				Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: port}}},
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: "127.0.0.1"}},
+				}},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		addr, err := networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			Timeout:  5 * time.Second,
+			Interval: 10 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.Host).To(Equal("127.0.0.1"))
+	})
+
+	It("does not wait on errors which persist", func() {
+		svc, err := clientset.CoreV1().Services("gloo-system").Get(ctx, "gateway-proxy", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		svc.Spec.Ports = append(svc.Spec.Ports, corev1.ServicePort{Name: "admin", Port: 19000})
+		_, err = clientset.CoreV1().Services("gloo-system").Update(ctx, svc, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		start := time.Now()
+		_, err = networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			ProxyPort: "https",
+			Timeout:   5 * time.Second,
+			Interval:  10 * time.Millisecond,
+		})
+		Expect(networkutils.IsIngressWaitError(err)).To(BeFalse())
+		Expect(err).To(MatchError("waiting for address assignment of service gateway-proxy in gloo-system namespace: " +
+			"port https not found on service gateway-proxy"))
+
+		clientset.PrependReactor("get", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, kubeerrors.NewForbidden(corev1.Resource("services"), "gateway-proxy", errors.New("rbac"))
+		})
+		_, err = networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			Timeout:  5 * time.Second,
+			Interval: 10 * time.Millisecond,
+		})
+		Expect(kubeerrors.IsForbidden(err)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("waits for the host to resolve", func() {
+		assignLater(corev1.LoadBalancerIngress{Hostname: "lb.example.com"})
+		var lookups atomic.Int32
+		lookupHost := func(_ context.Context, host string) ([]string, error) {
+			Expect(host).To(Equal("lb.example.com"))
+			if lookups.Add(1) < 3 {
+				return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+			}
+			return []string{"35.1.2.3"}, nil
+		}
+
+		addr, err := networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			CheckDNS:   true,
+			Timeout:    5 * time.Second,
+			Interval:   10 * time.Millisecond,
+			LookupHost: lookupHost,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addr.Host).To(Equal("lb.example.com"))
+		Expect(lookups.Load()).To(BeEquivalentTo(3))
+
+		lookups.Store(-1000)
+		_, err = networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			CheckDNS:   true,
+			Timeout:    100 * time.Millisecond,
+			Interval:   10 * time.Millisecond,
+			LookupHost: lookupHost,
+		})
+		Expect(err).To(MatchError(fmt.Sprintf("timed out after 100ms waiting for DNS resolution of service gateway-proxy in gloo-system namespace "+
+			"at lb.example.com:%d: lookup lb.example.com: no such host", port)))
+	})
+
+	It("reports unreachable addresses", func() {
+		assignLater(corev1.LoadBalancerIngress{IP: "127.0.0.1"})
+		Expect(listener.Close()).To(Succeed())
+
+		_, err := networkutils.WaitForIngressAddress(ctx, clientset, ref, networkutils.IngressWaitOptions{
+			CheckTCP: true,
+			Timeout:  200 * time.Millisecond,
+			Interval: 10 * time.Millisecond,
+		})
+		var waitErr *networkutils.IngressWaitError
+		Expect(errors.As(err, &waitErr)).To(BeTrue())
+		Expect(waitErr.Stage).To(Equal(networkutils.TCPReachabilityStage))
+		Expect(waitErr.Address).To(Equal(net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port)))))
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+	})
+})
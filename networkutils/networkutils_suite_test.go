@@ -0,0 +1,13 @@
+package networkutils_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestNetworkutils(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Networkutils Suite")
+}
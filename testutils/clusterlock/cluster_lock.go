@@ -3,6 +3,7 @@ package clusterlock
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/consul/api"
@@ -25,6 +26,9 @@ const (
 	LockAnnotationKey = "test.lock"
 	// name of the annotation containing the timeout
 	LockTimeoutAnnotationKey = "test.lock.timeout"
+	// name of the annotation containing the json data of the lock: the HolderMetadata of a lock, or the
+	// SemaphoreState of a semaphore
+	LockDataAnnotationKey = "test.lock.data"
 
 	// Default timeout for lock to be held
 	DefaultLockTimeout = time.Second * 30
@@ -34,10 +38,6 @@ const (
 	DefaultHeartbeatTime = time.Second * 10
 )
 
-var defaultClusterLock = &ClusterLock{
-	Name: LockResourceName,
-}
-
 var defaultOpts = []retry.Option{
 	retry.Delay(10 * time.Second),
 	retry.Attempts(60),
@@ -59,9 +59,15 @@ var defaultOpts = []retry.Option{
 }
 
 type TestClusterLocker struct {
-	client  ClusterLockClient
-	ownerId string
-	ctx     context.Context
+	client   ClusterLockClient
+	ownerId  string
+	ctx      context.Context
+	name     string
+	metadata HolderMetadata
+	metrics  Metrics
+
+	lock       sync.Mutex
+	acquiredAt time.Time
 }
 
 type Options struct {
@@ -97,29 +103,73 @@ func NewConsulClusterLocker(ctx context.Context, idPrefix string, consul *api.Cl
 }
 
 func NewClusterLocker(ctx context.Context, idPrefix string, client ClusterLockClient) (*TestClusterLocker, error) {
-	ownerId := idPrefix + uuid.New().String()
+	return NewNamedClusterLocker(ctx, idPrefix, client, LockResourceName)
+}
 
-	_, err := client.Create(ctx, defaultClusterLock)
+// NewNamedClusterLocker returns a locker for the lock with the given name, so that suites which need different
+// shared resources do not wait for each other. Use a TestClusterMultiLocker to hold several of them.
+func NewNamedClusterLocker(ctx context.Context, idPrefix string, client ClusterLockClient, name string) (*TestClusterLocker, error) {
+	return newClusterLocker(ctx, idPrefix+uuid.New().String(), client, name)
+}
+
+func newClusterLocker(ctx context.Context, ownerId string, client ClusterLockClient, name string) (*TestClusterLocker, error) {
+	_, err := client.Create(ctx, &ClusterLock{Name: name})
 	if err != nil && !errors.IsAlreadyExists(err) {
 		return nil, err
 	}
 	return &TestClusterLocker{
-		client:  client,
-		ownerId: ownerId,
-		ctx:     ctx,
+		client:   client,
+		ownerId:  ownerId,
+		ctx:      ctx,
+		name:     name,
+		metadata: DefaultHolderMetadata(""),
+		metrics:  noopMetrics{},
 	}, nil
 }
 
+// WithMetadata sets the metadata recorded in the lock while it is held, the start time is set on acquisition
+func (t *TestClusterLocker) WithMetadata(metadata HolderMetadata) *TestClusterLocker {
+	t.metadata = metadata
+	return t
+}
+
+func (t *TestClusterLocker) WithMetrics(metrics Metrics) *TestClusterLocker {
+	t.metrics = metrics
+	return t
+}
+
+func (t *TestClusterLocker) OwnerID() string {
+	return t.ownerId
+}
+
+func (t *TestClusterLocker) Name() string {
+	return t.name
+}
+
 func (t *TestClusterLocker) AcquireLock(opts ...retry.Option) error {
-	opts = append(defaultOpts, opts...)
-	lockLoop := t.lockLoop()
+	return t.AcquireLockWithContext(t.ctx, opts...)
+}
+
+// AcquireLockWithContext stops waiting for the lock when ctx is done. The heartbeat of an acquired lock still runs
+// until the context of the locker is done.
+func (t *TestClusterLocker) AcquireLockWithContext(ctx context.Context, opts ...retry.Option) error {
+	start := time.Now()
+	opts = append(append(append([]retry.Option{}, defaultOpts...), opts...), retry.Context(ctx))
 
 	err := retry.Do(
-		lockLoop,
+		t.lockLoop(ctx),
 		opts...,
 	)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	t.metrics.ObserveWait(t.name, time.Since(start), err == nil)
 
 	if err == nil {
+		t.lock.Lock()
+		t.acquiredAt = time.Now()
+		t.lock.Unlock()
+
 		// if lock is acquired send heartbeat
 		go func(ctx context.Context) {
 			for {
@@ -149,7 +199,7 @@ func (t *TestClusterLocker) AcquireLock(opts ...retry.Option) error {
 }
 
 func (t *TestClusterLocker) reacquireLock() error {
-	lock, err := t.client.Get(t.ctx, LockResourceName)
+	lock, err := t.client.Get(t.ctx, t.name)
 	if err != nil {
 		return err
 	}
@@ -169,16 +219,27 @@ func (t *TestClusterLocker) reacquireLock() error {
 	return nil
 }
 
-func (t *TestClusterLocker) lockLoop() retry.RetryableFunc {
+func (t *TestClusterLocker) lockLoop(ctx context.Context) retry.RetryableFunc {
+	take := func(lock *ClusterLock) {
+		now := time.Now()
+		metadata := t.metadata
+		metadata.StartTime = now
+		lock.Set(t.ownerId, now.Format(DefaultTimeFormat))
+		lock.Data = metadata.data()
+	}
+
 	var callback = func() error {
-		lock, err := t.concurrentLockGet()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		lock, err := t.concurrentLockGet(ctx)
 		if err != nil && !errors.IsTimeout(err) {
 			return err
 		}
 
 		if lock.Empty() {
 			// Case if lock is are empty
-			lock.Set(t.ownerId, time.Now().Format(DefaultTimeFormat))
+			take(lock)
 		} else {
 			if lock.Timeout != "" {
 				// case if timeout has expired
@@ -187,7 +248,7 @@ func (t *TestClusterLocker) lockLoop() retry.RetryableFunc {
 					return err
 				}
 				if time.Since(savedTime) > DefaultLockTimeout {
-					lock.Set(t.ownerId, time.Now().Format(DefaultTimeFormat))
+					take(lock)
 				}
 			}
 
@@ -196,7 +257,7 @@ func (t *TestClusterLocker) lockLoop() retry.RetryableFunc {
 			}
 		}
 
-		if _, err := t.client.Update(t.ctx, lock); err != nil {
+		if _, err := t.client.Update(ctx, lock); err != nil {
 			return err
 		}
 		return nil
@@ -204,13 +265,13 @@ func (t *TestClusterLocker) lockLoop() retry.RetryableFunc {
 	return callback
 }
 
-func (t *TestClusterLocker) concurrentLockGet() (*ClusterLock, error) {
-	originalLock, err := t.client.Get(t.ctx, LockResourceName)
+func (t *TestClusterLocker) concurrentLockGet(ctx context.Context) (*ClusterLock, error) {
+	originalLock, err := t.client.Get(ctx, t.name)
 	if err == nil {
 		return originalLock, nil
 	}
 	if errors.IsNotFound(err) {
-		newLock, err := t.client.Create(t.ctx, defaultClusterLock)
+		newLock, err := t.client.Create(ctx, &ClusterLock{Name: t.name})
 		if err != nil {
 			// force the loop to restart
 			if errors.IsAlreadyExists(err) {
@@ -242,7 +303,21 @@ var (
 )
 
 func (t *TestClusterLocker) ReleaseLock() error {
-	lock, err := t.client.Get(t.ctx, LockResourceName)
+	if err := t.release(t.ctx); err != nil {
+		return err
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.acquiredAt.IsZero() {
+		t.metrics.ObserveHold(t.name, time.Since(t.acquiredAt))
+		t.acquiredAt = time.Time{}
+	}
+	return nil
+}
+
+func (t *TestClusterLocker) release(ctx context.Context) error {
+	lock, err := t.client.Get(ctx, t.name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return nil
@@ -258,8 +333,37 @@ func (t *TestClusterLocker) ReleaseLock() error {
 
 	lock.Clear()
 
-	if _, err := t.client.Update(t.ctx, lock); err != nil {
+	if _, err := t.client.Update(ctx, lock); err != nil {
 		return err
 	}
 	return nil
 }
+
+// Inspect returns the current holder of the lock
+func (t *TestClusterLocker) Inspect(ctx context.Context) (*LockInfo, error) {
+	lock, err := t.client.Get(ctx, t.name)
+	if err != nil {
+		return nil, err
+	}
+	return lockInfoFrom(lock), nil
+}
+
+// ForceRelease frees the lock whoever holds it, e.g. when the job holding it is stuck. It returns the holder the
+// lock was taken from.
+func (t *TestClusterLocker) ForceRelease(ctx context.Context) (*LockInfo, error) {
+	lock, err := t.client.Get(ctx, t.name)
+	if err != nil {
+		return nil, err
+	}
+	info := lockInfoFrom(lock)
+	if lock.Empty() {
+		return info, nil
+	}
+
+	lock.Clear()
+	if _, err := t.client.Update(ctx, lock); err != nil {
+		return nil, err
+	}
+	contextutils.LoggerFrom(ctx).Warnw("force released lock", zap.String("holder", info.String()))
+	return info, nil
+}
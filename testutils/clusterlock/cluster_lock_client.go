@@ -2,6 +2,7 @@ package clusterlock
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"strconv"
 	"strings"
@@ -19,6 +20,8 @@ type ClusterLock struct {
 	Name    string
 	OwnerID string
 	Timeout string
+	// Optional state of locks with more than a single owner, e.g. semaphores
+	Data string
 
 	// either a kube resource version or consul modify index
 	ResourceVersion string
@@ -30,6 +33,7 @@ func (l *ClusterLock) Empty() bool {
 
 func (l *ClusterLock) Clear() {
 	l.Set("", "")
+	l.Data = ""
 }
 
 func (l *ClusterLock) Set(ownerId, timeout string) {
@@ -38,7 +42,7 @@ func (l *ClusterLock) Set(ownerId, timeout string) {
 }
 
 func (l ClusterLock) ConfigMap(namespace string) *v1.ConfigMap {
-	return &v1.ConfigMap{
+	cm := &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: namespace,
 			Name:      l.Name,
@@ -49,52 +53,72 @@ func (l ClusterLock) ConfigMap(namespace string) *v1.ConfigMap {
 			ResourceVersion: l.ResourceVersion,
 		},
 	}
+	if l.Data != "" {
+		cm.Annotations[LockDataAnnotationKey] = l.Data
+	}
+	return cm
 }
+
 func CLFromConfigMap(cm *v1.ConfigMap) *ClusterLock {
-	var ownerId, timeout string
+	var ownerId, timeout, data string
 	if cm.Annotations != nil {
 		ownerId = cm.Annotations[LockAnnotationKey]
 		timeout = cm.Annotations[LockTimeoutAnnotationKey]
+		data = cm.Annotations[LockDataAnnotationKey]
 	}
 
 	return &ClusterLock{
 		Name:            cm.Name,
 		OwnerID:         ownerId,
 		Timeout:         timeout,
+		Data:            data,
 		ResourceVersion: cm.ResourceVersion,
 	}
 }
 
 var separator = "@"
 
-func toData(ownerId, timeout string) []byte {
-	return []byte(fmt.Sprintf("%v%v%v", ownerId, separator, timeout))
+// the data is only appended when set, so that locks without data keep the format of older versions
+func toData(ownerId, timeout, data string) []byte {
+	if data == "" {
+		return []byte(fmt.Sprintf("%v%v%v", ownerId, separator, timeout))
+	}
+	return []byte(fmt.Sprintf("%v%v%v%v%v", ownerId, separator, timeout, separator, base64.StdEncoding.EncodeToString([]byte(data))))
 }
 
-func fromData(data []byte) (string, string) {
-	parts := strings.Split(string(data), separator)
-	if len(parts) != 2 {
-		return "", ""
+func fromData(value []byte) (string, string, string) {
+	parts := strings.Split(string(value), separator)
+	switch len(parts) {
+	case 2:
+		return parts[0], parts[1], ""
+	case 3:
+		data, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return "", "", ""
+		}
+		return parts[0], parts[1], string(data)
+	default:
+		return "", "", ""
 	}
-	return parts[0], parts[1]
 }
 
 func (l ClusterLock) KVPair(keyPrefix string) *api.KVPair {
 	modifyIndex, _ := strconv.Atoi(l.ResourceVersion)
 	return &api.KVPair{
 		Key:         keyPrefix + l.Name,
-		Value:       toData(l.OwnerID, l.Timeout),
+		Value:       toData(l.OwnerID, l.Timeout, l.Data),
 		ModifyIndex: uint64(modifyIndex),
 	}
 }
 
 func CLFromKVPair(keyPrefix string, kvp *api.KVPair) *ClusterLock {
-	ownerId, timeout := fromData(kvp.Value)
+	ownerId, timeout, data := fromData(kvp.Value)
 
 	return &ClusterLock{
 		Name:            strings.TrimPrefix(kvp.Key, keyPrefix),
 		OwnerID:         ownerId,
 		Timeout:         timeout,
+		Data:            data,
 		ResourceVersion: strconv.Itoa(int(kvp.ModifyIndex)),
 	}
 }
@@ -19,19 +19,36 @@ func TestClusterlock(t *testing.T) {
 	RunSpecs(t, "Clusterlock Suite")
 }
 
+// Only the specs labelled integration need a live cluster or consul, which they set up on first use with
+// requireKube and requireConsul. The other specs use fakes and run anywhere, e.g. with --label-filter='!integration'.
 var (
 	consulFactory *consul.ConsulFactory
 	kubeClient    kubernetes.Interface
 )
 
-var _ = BeforeSuite(func() {
-	kubeClient = kube.MustKubeClient()
+func requireKube() {
+	if kubeClient != nil {
+		return
+	}
+	var err error
+	kubeClient, err = kube.KubeClient()
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func requireConsul() {
+	if consulFactory != nil {
+		return
+	}
 	var err error
 	consulFactory, err = consul.NewConsulFactory()
 	Expect(err).NotTo(HaveOccurred())
-})
+}
 
 var _ = AfterSuite(func() {
-	_ = consulFactory.Clean()
-	kubeClient.CoreV1().ConfigMaps("default").Delete(context.Background(), clusterlock.LockResourceName, v1.DeleteOptions{})
+	if consulFactory != nil {
+		_ = consulFactory.Clean()
+	}
+	if kubeClient != nil {
+		kubeClient.CoreV1().ConfigMaps("default").Delete(context.Background(), clusterlock.LockResourceName, v1.DeleteOptions{})
+	}
 })
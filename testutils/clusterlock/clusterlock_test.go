@@ -18,7 +18,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var _ = Describe("kube cluster lock test", func() {
+var _ = Describe("kube cluster lock test", Label("integration"), func() {
 
 	var (
 		ctx       context.Context
@@ -26,6 +26,7 @@ var _ = Describe("kube cluster lock test", func() {
 	)
 
 	BeforeEach(func() {
+		requireKube()
 		ctx = context.Background()
 		namespace = testutils.RandString(8)
 		err := kubeutils.CreateNamespacesInParallel(ctx, kubeClient, namespace)
@@ -33,6 +34,9 @@ var _ = Describe("kube cluster lock test", func() {
 	})
 
 	AfterEach(func() {
+		if kubeClient == nil {
+			return
+		}
 		err := kubeutils.DeleteNamespacesInParallelBlocking(ctx, kubeClient, namespace)
 		Expect(err).NotTo(HaveOccurred())
 	})
@@ -143,15 +147,35 @@ var _ = Describe("kube cluster lock test", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(lock2.AcquireLock()).NotTo(HaveOccurred())
 	})
+
+	It("can share a semaphore between owners", func() {
+		opts := clusterlock.Options{Namespace: namespace}
+		semaphoreOpts := clusterlock.SemaphoreOptions{Capacity: 2}
+		a, err := clusterlock.NewKubeClusterSemaphore(kubeClient, opts, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := clusterlock.NewKubeClusterSemaphore(kubeClient, opts, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		c, err := clusterlock.NewKubeClusterSemaphore(kubeClient, opts, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Acquire()).NotTo(HaveOccurred())
+		Expect(c.Acquire(retry.Delay(time.Millisecond), retry.Attempts(3))).To(HaveOccurred())
+		Expect(c.Holders()).To(ConsistOf(a.OwnerID(), b.OwnerID()))
+		Expect(a.Release()).NotTo(HaveOccurred())
+		Expect(c.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Release()).NotTo(HaveOccurred())
+		Expect(c.Release()).NotTo(HaveOccurred())
+	})
 })
 
-var _ = Describe("consul cluster lock test", func() {
+var _ = Describe("consul cluster lock test", Label("integration"), func() {
 	var (
 		consulClient   *api.Client
 		consulInstance *consul.ConsulInstance
 		keyPrefix      = testutils.RandString(6)
 	)
 	BeforeEach(func() {
+		requireConsul()
 		var err error
 
 		consulInstance, err = consulFactory.NewConsulInstance()
@@ -168,7 +192,9 @@ var _ = Describe("consul cluster lock test", func() {
 	})
 
 	AfterEach(func() {
-		_ = consulInstance.Clean()
+		if consulInstance != nil {
+			_ = consulInstance.Clean()
+		}
 	})
 
 	It("can handle a single locking scenario", func() {
@@ -221,4 +247,21 @@ var _ = Describe("consul cluster lock test", func() {
 		Expect(lock.ReleaseLock()).NotTo(HaveOccurred())
 	})
 
+	It("can share a semaphore between owners", func() {
+		semaphoreOpts := clusterlock.SemaphoreOptions{Capacity: 2}
+		a, err := clusterlock.NewConsulClusterSemaphore(context.Background(), keyPrefix, consulClient, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := clusterlock.NewConsulClusterSemaphore(context.Background(), keyPrefix, consulClient, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		c, err := clusterlock.NewConsulClusterSemaphore(context.Background(), keyPrefix, consulClient, semaphoreOpts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Acquire()).NotTo(HaveOccurred())
+		Expect(c.Acquire(retry.Delay(time.Millisecond), retry.Attempts(3))).To(HaveOccurred())
+		Expect(c.Holders()).To(ConsistOf(a.OwnerID(), b.OwnerID()))
+		Expect(a.Release()).NotTo(HaveOccurred())
+		Expect(c.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Release()).NotTo(HaveOccurred())
+		Expect(c.Release()).NotTo(HaveOccurred())
+	})
 })
@@ -0,0 +1,161 @@
+package clusterlock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// LeaseClusterLockClient stores locks in coordination.k8s.io/v1 Leases. The owner is the holder identity and the
+// timeout is the renew time. A lease whose renew time is older than its lease duration is expired, and is read as
+// an empty lock so that it can be taken over.
+type LeaseClusterLockClient struct {
+	clientset     kubernetes.Interface
+	namespace     string
+	leaseDuration time.Duration
+}
+
+// NewLeaseClusterLockClient returns a client for leases in the namespace. The lease duration is written to the
+// leases, DefaultLockTimeout is used when it is zero.
+func NewLeaseClusterLockClient(clientset kubernetes.Interface, namespace string, leaseDuration time.Duration) *LeaseClusterLockClient {
+	if namespace == "" {
+		namespace = LockDefaultNamespace
+	}
+	if leaseDuration == 0 {
+		leaseDuration = DefaultLockTimeout
+	}
+	return &LeaseClusterLockClient{
+		clientset:     clientset,
+		namespace:     namespace,
+		leaseDuration: leaseDuration,
+	}
+}
+
+func NewLeaseClusterLocker(clientset kubernetes.Interface, options Options) (*TestClusterLocker, error) {
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	client := NewLeaseClusterLockClient(clientset, options.Namespace, 0)
+	return NewClusterLocker(options.Context, options.IdPrefix, client)
+}
+
+func (l ClusterLock) Lease(namespace string, leaseDuration time.Duration) *coordinationv1.Lease {
+	durationSeconds := int32(leaseDuration.Seconds())
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            l.Name,
+			ResourceVersion: l.ResourceVersion,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			LeaseDurationSeconds: &durationSeconds,
+		},
+	}
+	if l.OwnerID != "" {
+		ownerId := l.OwnerID
+		lease.Spec.HolderIdentity = &ownerId
+	}
+	if renewTime, err := time.Parse(DefaultTimeFormat, l.Timeout); err == nil {
+		lease.Spec.RenewTime = &metav1.MicroTime{Time: renewTime}
+	}
+	if l.Data != "" {
+		lease.Annotations = map[string]string{LockDataAnnotationKey: l.Data}
+	}
+	return lease
+}
+
+func CLFromLease(lease *coordinationv1.Lease) *ClusterLock {
+	cl := &ClusterLock{
+		Name:            lease.Name,
+		Data:            lease.Annotations[LockDataAnnotationKey],
+		ResourceVersion: lease.ResourceVersion,
+	}
+	if leaseExpired(lease, time.Now()) {
+		return cl
+	}
+	if lease.Spec.HolderIdentity != nil {
+		cl.OwnerID = *lease.Spec.HolderIdentity
+	}
+	if lease.Spec.RenewTime != nil {
+		cl.Timeout = lease.Spec.RenewTime.Format(DefaultTimeFormat)
+	}
+	return cl
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+func leaseConflictError(name string) error {
+	return errors.NewConflict(coordinationv1.Resource("leases"), name, fmt.Errorf("the lease changed since it was read"))
+}
+
+func (c *LeaseClusterLockClient) Create(ctx context.Context, cl *ClusterLock) (*ClusterLock, error) {
+	lease := cl.Lease(c.namespace, c.leaseDuration)
+	lease.ResourceVersion = ""
+	if lease.Spec.HolderIdentity != nil {
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+	}
+	lease, err := c.clientset.CoordinationV1().Leases(c.namespace).Create(ctx, lease, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return CLFromLease(lease), nil
+}
+
+// Update fails with a conflict when the lease changed since cl was read
+func (c *LeaseClusterLockClient) Update(ctx context.Context, cl *ClusterLock) (*ClusterLock, error) {
+	original, err := c.clientset.CoordinationV1().Leases(c.namespace).Get(ctx, cl.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if original.ResourceVersion != cl.ResourceVersion {
+		return nil, leaseConflictError(cl.Name)
+	}
+
+	lease := cl.Lease(c.namespace, c.leaseDuration)
+	lease.Labels = original.Labels
+	lease.Spec.AcquireTime = original.Spec.AcquireTime
+	lease.Spec.LeaseTransitions = original.Spec.LeaseTransitions
+	previousHolder := ""
+	if original.Spec.HolderIdentity != nil && !leaseExpired(original, time.Now()) {
+		previousHolder = *original.Spec.HolderIdentity
+	}
+	if cl.OwnerID == "" {
+		lease.Spec.AcquireTime = nil
+	} else if cl.OwnerID != previousHolder {
+		lease.Spec.AcquireTime = lease.Spec.RenewTime
+		transitions := int32(1)
+		if original.Spec.LeaseTransitions != nil {
+			transitions = *original.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+
+	lease, err = c.clientset.CoordinationV1().Leases(c.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return CLFromLease(lease), nil
+}
+
+func (c *LeaseClusterLockClient) Get(ctx context.Context, name string) (*ClusterLock, error) {
+	lease, err := c.clientset.CoordinationV1().Leases(c.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return CLFromLease(lease), nil
+}
+
+func (c *LeaseClusterLockClient) Delete(ctx context.Context, name string) error {
+	return c.clientset.CoordinationV1().Leases(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
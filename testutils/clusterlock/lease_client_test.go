@@ -0,0 +1,138 @@
+package clusterlock_test
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/avast/retry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/clusterlock"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("lease cluster lock", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		clientset *fake.Clientset
+		opts      clusterlock.Options
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		clientset = fake.NewClientset()
+		// the fake clientset does not set resource versions, which the client relies on to detect conflicts
+		version := 0
+		bumpVersion := func(action k8stesting.Action) (bool, runtime.Object, error) {
+			accessor, err := meta.Accessor(action.(interface{ GetObject() runtime.Object }).GetObject())
+			Expect(err).NotTo(HaveOccurred())
+			version++
+			accessor.SetResourceVersion(strconv.Itoa(version))
+			return false, nil, nil
+		}
+		clientset.PrependReactor("create", "leases", bumpVersion)
+		clientset.PrependReactor("update", "leases", bumpVersion)
+		opts = clusterlock.Options{Namespace: "test-ns", Context: ctx}
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	getLease := func() *coordinationv1.Lease {
+		lease, err := clientset.CoordinationV1().Leases("test-ns").Get(ctx, clusterlock.LockResourceName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		return lease
+	}
+
+	It("stores the holder in the lease", func() {
+		lock, err := clusterlock.NewLeaseClusterLocker(clientset, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock.AcquireLock()).NotTo(HaveOccurred())
+
+		lease := getLease()
+		Expect(lease.Spec.HolderIdentity).NotTo(BeNil())
+		holder := *lease.Spec.HolderIdentity
+		Expect(*lease.Spec.LeaseDurationSeconds).To(BeEquivalentTo(clusterlock.DefaultLockTimeout.Seconds()))
+		Expect(lease.Spec.RenewTime.Time).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(lease.Spec.AcquireTime).To(Equal(lease.Spec.RenewTime))
+		Expect(*lease.Spec.LeaseTransitions).To(BeEquivalentTo(1))
+
+		lock2, err := clusterlock.NewLeaseClusterLocker(clientset, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock2.AcquireLock(retry.Delay(time.Millisecond), retry.Attempts(3))).To(HaveOccurred())
+		Expect(clusterlock.IsNotLockOwnerError(lock2.ReleaseLock())).To(BeTrue())
+
+		Expect(lock.ReleaseLock()).NotTo(HaveOccurred())
+		lease = getLease()
+		Expect(lease.Spec.HolderIdentity).To(BeNil())
+		Expect(lease.Spec.AcquireTime).To(BeNil())
+
+		Expect(lock2.AcquireLock()).NotTo(HaveOccurred())
+		Expect(*getLease().Spec.LeaseTransitions).To(BeEquivalentTo(2))
+		Expect(*getLease().Spec.HolderIdentity).NotTo(Equal(holder))
+	})
+
+	It("takes over leases whose renewal expired", func() {
+		lock, err := clusterlock.NewLeaseClusterLocker(clientset, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock.AcquireLock()).NotTo(HaveOccurred())
+
+		// the holder stopped renewing a minute ago
+		lease := getLease()
+		duration := int32(10)
+		lease.Spec.LeaseDurationSeconds = &duration
+		lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now().Add(-time.Minute)}
+		_, err = clientset.CoordinationV1().Leases("test-ns").Update(ctx, lease, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		lock2, err := clusterlock.NewLeaseClusterLocker(clientset, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock2.AcquireLock(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(*getLease().Spec.HolderIdentity).NotTo(Equal(*lease.Spec.HolderIdentity))
+		Expect(*getLease().Spec.LeaseTransitions).To(BeEquivalentTo(2))
+		Expect(clusterlock.IsNotLockOwnerError(lock.ReleaseLock())).To(BeTrue())
+		Expect(lock2.ReleaseLock()).NotTo(HaveOccurred())
+	})
+
+	It("detects conflicting updates", func() {
+		client := clusterlock.NewLeaseClusterLockClient(clientset, "test-ns", 0)
+		created, err := client.Create(ctx, &clusterlock.ClusterLock{Name: "lock"})
+		Expect(err).NotTo(HaveOccurred())
+
+		first := *created
+		first.Set("first", time.Now().Format(clusterlock.DefaultTimeFormat))
+		_, err = client.Update(ctx, &first)
+		Expect(err).NotTo(HaveOccurred())
+
+		second := *created
+		second.Set("second", time.Now().Format(clusterlock.DefaultTimeFormat))
+		_, err = client.Update(ctx, &second)
+		Expect(errors.IsConflict(err)).To(BeTrue())
+
+		lock, err := client.Get(ctx, "lock")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lock.OwnerID).To(Equal("first"))
+	})
+
+	It("backs semaphores", func() {
+		client := clusterlock.NewLeaseClusterLockClient(clientset, "test-ns", 0)
+		semaphore, err := clusterlock.NewClusterSemaphore(ctx, "", client, clusterlock.SemaphoreOptions{Capacity: 2})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(semaphore.Acquire()).NotTo(HaveOccurred())
+
+		lease, err := clientset.CoordinationV1().Leases("test-ns").Get(ctx, clusterlock.SemaphoreResourceName, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lease.Annotations[clusterlock.LockDataAnnotationKey]).To(ContainSubstring(semaphore.OwnerID()))
+		Expect(semaphore.Holders()).To(Equal([]string{semaphore.OwnerID()}))
+		Expect(semaphore.Release()).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,127 @@
+package clusterlock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// HolderMetadata describes who holds a lock, so that a stuck lock can be traced back to its job
+type HolderMetadata struct {
+	// link to the CI job holding the lock
+	JobURL   string `json:"jobUrl,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// when the lock was acquired
+	StartTime time.Time `json:"startTime,omitempty"`
+	// what the lock is held for, e.g. the name of the test suite
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// DefaultHolderMetadata returns the hostname and the url of the CI job this process runs in, if known
+func DefaultHolderMetadata(purpose string) HolderMetadata {
+	hostname, _ := os.Hostname()
+	return HolderMetadata{
+		JobURL:   ciJobURL(),
+		Hostname: hostname,
+		Purpose:  purpose,
+	}
+}
+
+// the url of the job from the environment variables of common CI systems
+func ciJobURL() string {
+	// jenkins
+	if url := os.Getenv("BUILD_URL"); url != "" {
+		return url
+	}
+	// gitlab
+	if url := os.Getenv("CI_JOB_URL"); url != "" {
+		return url
+	}
+	// github actions
+	server, repository, runId := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server != "" && repository != "" && runId != "" {
+		return fmt.Sprintf("%s/%s/actions/runs/%s", server, repository, runId)
+	}
+	return ""
+}
+
+func (m HolderMetadata) String() string {
+	var parts []string
+	if m.Purpose != "" {
+		parts = append(parts, "purpose: "+m.Purpose)
+	}
+	if m.JobURL != "" {
+		parts = append(parts, "job: "+m.JobURL)
+	}
+	if m.Hostname != "" {
+		parts = append(parts, "host: "+m.Hostname)
+	}
+	if !m.StartTime.IsZero() {
+		parts = append(parts, "since: "+m.StartTime.Format(time.RFC3339))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func metadataFromData(data string) *HolderMetadata {
+	if data == "" {
+		return nil
+	}
+	metadata := &HolderMetadata{}
+	if err := json.Unmarshal([]byte(data), metadata); err != nil {
+		// locks written by older versions have no metadata
+		return nil
+	}
+	return metadata
+}
+
+func (m HolderMetadata) data() string {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// LockInfo describes the current holder of a lock
+type LockInfo struct {
+	Name string
+	// empty when the lock is free
+	OwnerID string
+	// nil when the holder did not record any
+	Metadata      *HolderMetadata
+	LastHeartbeat time.Time
+	// the holder stopped sending heartbeats, the next owner to acquire the lock takes it over
+	Expired bool
+}
+
+func lockInfoFrom(lock *ClusterLock) *LockInfo {
+	info := &LockInfo{
+		Name:     lock.Name,
+		OwnerID:  lock.OwnerID,
+		Metadata: metadataFromData(lock.Data),
+	}
+	if heartbeat, err := time.Parse(DefaultTimeFormat, lock.Timeout); err == nil {
+		info.LastHeartbeat = heartbeat
+		info.Expired = time.Since(heartbeat) > DefaultLockTimeout
+	}
+	return info
+}
+
+func (i *LockInfo) String() string {
+	if i.OwnerID == "" {
+		return fmt.Sprintf("%s is free", i.Name)
+	}
+	s := fmt.Sprintf("%s is held by %s", i.Name, i.OwnerID)
+	if i.Metadata != nil {
+		if details := i.Metadata.String(); details != "" {
+			s += " (" + details + ")"
+		}
+	}
+	s += ", last heartbeat " + i.LastHeartbeat.Format(time.RFC3339)
+	if i.Expired {
+		s += ", expired"
+	}
+	return s
+}
@@ -0,0 +1,212 @@
+package clusterlock_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/solo-io/k8s-utils/testutils/clusterlock"
+)
+
+type recordedMetrics struct {
+	lock  sync.Mutex
+	waits []bool
+	holds []time.Duration
+}
+
+func (m *recordedMetrics) ObserveWait(_ string, _ time.Duration, acquired bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.waits = append(m.waits, acquired)
+}
+
+func (m *recordedMetrics) ObserveHold(_ string, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.holds = append(m.holds, duration)
+}
+
+var _ = Describe("cluster lock administration", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *memoryClient
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		client = newMemoryClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newLocker := func(prefix string) *clusterlock.TestClusterLocker {
+		lock, err := clusterlock.NewClusterLocker(ctx, prefix, client)
+		Expect(err).NotTo(HaveOccurred())
+		return lock
+	}
+
+	It("records the holder metadata", func() {
+		lock := newLocker("a-").WithMetadata(clusterlock.HolderMetadata{
+			JobURL:   "https://ci.example.com/job/1",
+			Hostname: "runner-1",
+			Purpose:  "e2e tests",
+		})
+		info, err := lock.Inspect(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OwnerID).To(BeEmpty())
+		Expect(info.String()).To(Equal("test-lock is free"))
+
+		Expect(lock.AcquireLock()).NotTo(HaveOccurred())
+		info, err = lock.Inspect(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OwnerID).To(Equal(lock.OwnerID()))
+		Expect(info.Expired).To(BeFalse())
+		Expect(info.LastHeartbeat).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(info.Metadata).NotTo(BeNil())
+		Expect(info.Metadata.JobURL).To(Equal("https://ci.example.com/job/1"))
+		Expect(info.Metadata.Hostname).To(Equal("runner-1"))
+		Expect(info.Metadata.Purpose).To(Equal("e2e tests"))
+		Expect(info.Metadata.StartTime).To(BeTemporally("~", time.Now(), time.Second))
+		Expect(info.String()).To(ContainSubstring("purpose: e2e tests, job: https://ci.example.com/job/1, host: runner-1"))
+
+		Expect(lock.ReleaseLock()).NotTo(HaveOccurred())
+		info, err = lock.Inspect(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OwnerID).To(BeEmpty())
+		Expect(info.Metadata).To(BeNil())
+	})
+
+	It("reads the job url from the CI environment", func() {
+		for _, env := range []string{"BUILD_URL", "CI_JOB_URL", "GITHUB_SERVER_URL", "GITHUB_REPOSITORY", "GITHUB_RUN_ID"} {
+			if value, ok := os.LookupEnv(env); ok {
+				DeferCleanup(os.Setenv, env, value)
+				Expect(os.Unsetenv(env)).To(Succeed())
+			}
+		}
+		Expect(clusterlock.DefaultHolderMetadata("").JobURL).To(BeEmpty())
+
+		DeferCleanup(os.Unsetenv, "GITHUB_SERVER_URL")
+		DeferCleanup(os.Unsetenv, "GITHUB_REPOSITORY")
+		DeferCleanup(os.Unsetenv, "GITHUB_RUN_ID")
+		os.Setenv("GITHUB_SERVER_URL", "https://github.com")
+		os.Setenv("GITHUB_REPOSITORY", "solo-io/k8s-utils")
+		os.Setenv("GITHUB_RUN_ID", "42")
+		metadata := clusterlock.DefaultHolderMetadata("purpose")
+		Expect(metadata.JobURL).To(Equal("https://github.com/solo-io/k8s-utils/actions/runs/42"))
+		Expect(metadata.Purpose).To(Equal("purpose"))
+		Expect(metadata.Hostname).NotTo(BeEmpty())
+	})
+
+	It("force releases locks of other owners", func() {
+		a, b := newLocker("a-"), newLocker("b-")
+		Expect(a.AcquireLock()).NotTo(HaveOccurred())
+
+		info, err := b.ForceRelease(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OwnerID).To(Equal(a.OwnerID()))
+		Expect(b.AcquireLock(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(clusterlock.IsNotLockOwnerError(a.ReleaseLock())).To(BeTrue())
+		Expect(b.ReleaseLock()).NotTo(HaveOccurred())
+
+		info, err = b.ForceRelease(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.OwnerID).To(BeEmpty())
+	})
+
+	It("stops waiting when the context is done", func() {
+		a, b := newLocker("a-"), newLocker("b-")
+		Expect(a.AcquireLock()).NotTo(HaveOccurred())
+
+		waitCtx, cancelWait := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancelWait()
+		start := time.Now()
+		err := b.AcquireLockWithContext(waitCtx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+
+		Expect(a.ReleaseLock()).NotTo(HaveOccurred())
+		// the locker can still be used after giving up
+		Expect(b.AcquireLock(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(b.ReleaseLock()).NotTo(HaveOccurred())
+	})
+
+	It("observes wait and hold durations", func() {
+		metrics := &recordedMetrics{}
+		a := newLocker("a-").WithMetrics(metrics)
+		b := newLocker("b-").WithMetrics(metrics)
+		Expect(a.AcquireLock()).NotTo(HaveOccurred())
+		Expect(b.AcquireLock(retry.Delay(time.Millisecond), retry.Attempts(2))).To(HaveOccurred())
+		time.Sleep(10 * time.Millisecond)
+		Expect(a.ReleaseLock()).NotTo(HaveOccurred())
+
+		metrics.lock.Lock()
+		defer metrics.lock.Unlock()
+		Expect(metrics.waits).To(Equal([]bool{true, false}))
+		Expect(metrics.holds).To(HaveLen(1))
+		Expect(metrics.holds[0]).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+
+	It("exports metrics to prometheus", func() {
+		registry := prometheus.NewRegistry()
+		metrics, err := clusterlock.NewPrometheusMetrics(registry)
+		Expect(err).NotTo(HaveOccurred())
+		lock := newLocker("a-").WithMetrics(metrics)
+		Expect(lock.AcquireLock()).NotTo(HaveOccurred())
+		Expect(lock.ReleaseLock()).NotTo(HaveOccurred())
+
+		families, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+		counts := map[string]uint64{}
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				counts[family.GetName()] += metric.GetHistogram().GetSampleCount()
+			}
+		}
+		Expect(counts).To(Equal(map[string]uint64{
+			"clusterlock_wait_seconds": 1,
+			"clusterlock_hold_seconds": 1,
+		}))
+
+		_, err = clusterlock.NewPrometheusMetrics(registry)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("records metadata and force releases semaphores", func() {
+		newSemaphore := func(prefix string) *clusterlock.TestClusterSemaphore {
+			semaphore, err := clusterlock.NewClusterSemaphore(ctx, prefix, client, clusterlock.SemaphoreOptions{Capacity: 1})
+			Expect(err).NotTo(HaveOccurred())
+			return semaphore
+		}
+		a := newSemaphore("a-").WithMetadata(clusterlock.HolderMetadata{Purpose: "e2e tests"})
+		b := newSemaphore("b-")
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+
+		state, err := b.State()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Holders).To(HaveLen(1))
+		Expect(state.Holders[0].Metadata.Purpose).To(Equal("e2e tests"))
+		Expect(state.Holders[0].Metadata.StartTime).To(BeTemporally("~", time.Now(), time.Second))
+
+		waitCtx, cancelWait := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancelWait()
+		Expect(b.AcquireWithContext(waitCtx)).To(MatchError(context.DeadlineExceeded))
+
+		removed, err := b.ForceRelease(ctx, a.OwnerID())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed.OwnerID).To(Equal(a.OwnerID()))
+		_, err = b.ForceRelease(ctx, a.OwnerID())
+		Expect(clusterlock.IsNotQueuedError(err)).To(BeTrue())
+
+		Expect(b.Acquire(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(clusterlock.IsNotLockOwnerError(a.Release())).To(BeTrue())
+		Expect(b.Release()).NotTo(HaveOccurred())
+	})
+})
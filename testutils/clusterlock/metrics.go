@@ -0,0 +1,59 @@
+package clusterlock
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics observes how long owners wait for and hold locks
+type Metrics interface {
+	// ObserveWait is called once per acquisition, whether it succeeded or not
+	ObserveWait(lock string, duration time.Duration, acquired bool)
+	ObserveHold(lock string, duration time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveWait(string, time.Duration, bool) {}
+func (noopMetrics) ObserveHold(string, time.Duration)       {}
+
+type prometheusMetrics struct {
+	wait *prometheus.HistogramVec
+	hold *prometheus.HistogramVec
+}
+
+// lock waits and holds are in the order of minutes
+var durationBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 2400}
+
+// NewPrometheusMetrics registers the clusterlock_wait_seconds and clusterlock_hold_seconds histograms
+func NewPrometheusMetrics(registerer prometheus.Registerer) (Metrics, error) {
+	m := &prometheusMetrics{
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "clusterlock_wait_seconds",
+			Help:    "Time spent waiting to acquire a cluster lock",
+			Buckets: durationBuckets,
+		}, []string{"lock", "acquired"}),
+		hold: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "clusterlock_hold_seconds",
+			Help:    "Time a cluster lock was held for",
+			Buckets: durationBuckets,
+		}, []string{"lock"}),
+	}
+	if err := registerer.Register(m.wait); err != nil {
+		return nil, err
+	}
+	if err := registerer.Register(m.hold); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *prometheusMetrics) ObserveWait(lock string, duration time.Duration, acquired bool) {
+	m.wait.WithLabelValues(lock, strconv.FormatBool(acquired)).Observe(duration.Seconds())
+}
+
+func (m *prometheusMetrics) ObserveHold(lock string, duration time.Duration) {
+	m.hold.WithLabelValues(lock).Observe(duration.Seconds())
+}
@@ -0,0 +1,158 @@
+package clusterlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/avast/retry-go"
+	"github.com/google/uuid"
+	"github.com/hashicorp/consul/api"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+var noLockNamesError = fmt.Errorf("at least one lock name is required")
+
+// TestClusterMultiLocker holds several named locks at once, e.g. "gateway-namespace" and "crd-install". The locks
+// are always acquired in the order of their names and the ones already taken are released when acquiring the next
+// one fails, so lockers of overlapping sets of locks cannot deadlock.
+type TestClusterMultiLocker struct {
+	ctx     context.Context
+	ownerId string
+	// sorted by name
+	lockers []*TestClusterLocker
+}
+
+func NewKubeClusterMultiLocker(clientset kubernetes.Interface, options Options, names ...string) (*TestClusterMultiLocker, error) {
+	if options.Namespace == "" {
+		options.Namespace = LockDefaultNamespace
+	}
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	client := &KubeClusterLockClient{
+		namespace: options.Namespace,
+		clientset: clientset,
+	}
+	return NewClusterMultiLocker(options.Context, options.IdPrefix, client, names...)
+}
+
+func NewConsulClusterMultiLocker(ctx context.Context, idPrefix string, consul *api.Client, names ...string) (*TestClusterMultiLocker, error) {
+	client := &ConsulClusterLockClient{
+		client: consul,
+	}
+	return NewClusterMultiLocker(ctx, idPrefix, client, names...)
+}
+
+// NewClusterMultiLocker returns a locker for the named locks, all of them held by the same owner
+func NewClusterMultiLocker(ctx context.Context, idPrefix string, client ClusterLockClient, names ...string) (*TestClusterMultiLocker, error) {
+	names = canonicalLockNames(names)
+	if len(names) == 0 {
+		return nil, noLockNamesError
+	}
+	m := &TestClusterMultiLocker{
+		ctx:     ctx,
+		ownerId: idPrefix + uuid.New().String(),
+	}
+	for _, name := range names {
+		locker, err := newClusterLocker(ctx, m.ownerId, client, name)
+		if err != nil {
+			return nil, err
+		}
+		m.lockers = append(m.lockers, locker)
+	}
+	return m, nil
+}
+
+// sorted and without duplicates
+func canonicalLockNames(names []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (m *TestClusterMultiLocker) OwnerID() string {
+	return m.ownerId
+}
+
+// Names returns the names of the locks in the order they are acquired
+func (m *TestClusterMultiLocker) Names() []string {
+	var names []string
+	for _, locker := range m.lockers {
+		names = append(names, locker.name)
+	}
+	return names
+}
+
+func (m *TestClusterMultiLocker) WithMetadata(metadata HolderMetadata) *TestClusterMultiLocker {
+	for _, locker := range m.lockers {
+		locker.WithMetadata(metadata)
+	}
+	return m
+}
+
+func (m *TestClusterMultiLocker) WithMetrics(metrics Metrics) *TestClusterMultiLocker {
+	for _, locker := range m.lockers {
+		locker.WithMetrics(metrics)
+	}
+	return m
+}
+
+// AcquireLocks acquires all locks, or none of them. The retry options apply to each lock.
+func (m *TestClusterMultiLocker) AcquireLocks(opts ...retry.Option) error {
+	return m.AcquireLocksWithContext(m.ctx, opts...)
+}
+
+func (m *TestClusterMultiLocker) AcquireLocksWithContext(ctx context.Context, opts ...retry.Option) error {
+	for i, locker := range m.lockers {
+		if err := locker.AcquireLockWithContext(ctx, opts...); err != nil {
+			// give the other lockers a chance instead of holding on to the locks they may be waiting for
+			if rollbackErr := release(m.lockers[:i]); rollbackErr != nil {
+				contextutils.LoggerFrom(m.ctx).Warnw("could not release locks after failing to acquire all of them",
+					zap.Error(rollbackErr))
+			}
+			return fmt.Errorf("acquiring lock %s: %w", locker.name, err)
+		}
+	}
+	return nil
+}
+
+// ReleaseLocks releases all locks, also when releasing one of them fails
+func (m *TestClusterMultiLocker) ReleaseLocks() error {
+	return release(m.lockers)
+}
+
+// releases in the reverse order of acquisition
+func release(lockers []*TestClusterLocker) error {
+	var errs []error
+	for i := len(lockers) - 1; i >= 0; i-- {
+		if err := lockers[i].ReleaseLock(); err != nil {
+			errs = append(errs, fmt.Errorf("releasing lock %s: %w", lockers[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Inspect returns the current holders of the locks, in the order they are acquired
+func (m *TestClusterMultiLocker) Inspect(ctx context.Context) ([]*LockInfo, error) {
+	var infos []*LockInfo
+	for _, locker := range m.lockers {
+		info, err := locker.Inspect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
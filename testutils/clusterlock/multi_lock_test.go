@@ -0,0 +1,121 @@
+package clusterlock_test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/clusterlock"
+)
+
+var _ = Describe("named cluster locks", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		client *memoryClient
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		client = newMemoryClient()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	newMultiLocker := func(prefix string, names ...string) *clusterlock.TestClusterMultiLocker {
+		lock, err := clusterlock.NewClusterMultiLocker(ctx, prefix, client, names...)
+		Expect(err).NotTo(HaveOccurred())
+		return lock
+	}
+
+	holder := func(name string) string {
+		lock, err := client.Get(ctx, name)
+		Expect(err).NotTo(HaveOccurred())
+		return lock.OwnerID
+	}
+
+	It("holds differently named locks independently", func() {
+		a, err := clusterlock.NewNamedClusterLocker(ctx, "a-", client, "gateway-namespace")
+		Expect(err).NotTo(HaveOccurred())
+		b, err := clusterlock.NewNamedClusterLocker(ctx, "b-", client, "crd-install")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.AcquireLock(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(b.AcquireLock(retry.Attempts(1))).NotTo(HaveOccurred())
+
+		Expect(holder("gateway-namespace")).To(Equal(a.OwnerID()))
+		Expect(holder("crd-install")).To(Equal(b.OwnerID()))
+		Expect(a.ReleaseLock()).NotTo(HaveOccurred())
+		Expect(b.ReleaseLock()).NotTo(HaveOccurred())
+	})
+
+	It("acquires the locks in the order of their names", func() {
+		lock := newMultiLocker("a-", "gateway-namespace", "crd-install", "gateway-namespace")
+		Expect(lock.Names()).To(Equal([]string{"crd-install", "gateway-namespace"}))
+		Expect(lock.AcquireLocks(retry.Attempts(1))).NotTo(HaveOccurred())
+
+		infos, err := lock.Inspect(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+		for _, info := range infos {
+			Expect(info.OwnerID).To(Equal(lock.OwnerID()))
+		}
+		Expect(lock.ReleaseLocks()).NotTo(HaveOccurred())
+		Expect(holder("crd-install")).To(BeEmpty())
+		Expect(holder("gateway-namespace")).To(BeEmpty())
+
+		_, err = clusterlock.NewClusterMultiLocker(ctx, "", client)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("releases the locks it took when it cannot take all of them", func() {
+		other, err := clusterlock.NewNamedClusterLocker(ctx, "other-", client, "gateway-namespace")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(other.AcquireLock()).NotTo(HaveOccurred())
+
+		lock := newMultiLocker("a-", "crd-install", "gateway-namespace")
+		err = lock.AcquireLocks(retry.Delay(time.Millisecond), retry.Attempts(3))
+		Expect(err).To(MatchError(ContainSubstring("acquiring lock gateway-namespace")))
+		Expect(holder("crd-install")).To(BeEmpty())
+		Expect(holder("gateway-namespace")).To(Equal(other.OwnerID()))
+
+		Expect(other.ReleaseLock()).NotTo(HaveOccurred())
+		Expect(lock.AcquireLocks(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(lock.ReleaseLocks()).NotTo(HaveOccurred())
+	})
+
+	It("does not deadlock with overlapping sets of locks", func() {
+		fast := []retry.Option{retry.Delay(time.Millisecond), retry.Attempts(1000)}
+		lockers := []*clusterlock.TestClusterMultiLocker{
+			newMultiLocker("a-", "one", "two"),
+			newMultiLocker("b-", "two", "one"),
+			newMultiLocker("c-", "two", "three"),
+		}
+
+		var wg sync.WaitGroup
+		for _, lock := range lockers {
+			wg.Add(1)
+			go func(lock *clusterlock.TestClusterMultiLocker) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					Expect(lock.AcquireLocks(fast...)).NotTo(HaveOccurred())
+					for _, name := range lock.Names() {
+						Expect(holder(name)).To(Equal(lock.OwnerID()))
+					}
+					Expect(lock.ReleaseLocks()).NotTo(HaveOccurred())
+				}
+			}(lock)
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		Eventually(done, 30*time.Second).Should(BeClosed())
+	})
+})
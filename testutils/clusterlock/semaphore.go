@@ -0,0 +1,425 @@
+package clusterlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/google/uuid"
+	"github.com/hashicorp/consul/api"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// name of the kubernetes configmap or consul key holding the semaphore
+	SemaphoreResourceName = "test-semaphore"
+)
+
+var (
+	notQueuedError   = fmt.Errorf("neither holding nor waiting for the semaphore")
+	IsNotQueuedError = func(e error) bool {
+		return e == notQueuedError
+	}
+)
+
+type SemaphoreOptions struct {
+	// Name of the configmap or consul key, defaults to SemaphoreResourceName
+	Name string
+	// Number of owners which can hold the semaphore at the same time, defaults to 1.
+	// All users of a semaphore need to use the same capacity.
+	Capacity int
+}
+
+// SemaphoreEntry is an owner holding the semaphore, or a ticket of an owner waiting for it
+type SemaphoreEntry struct {
+	OwnerID   string          `json:"owner"`
+	Heartbeat time.Time       `json:"heartbeat"`
+	Metadata  *HolderMetadata `json:"metadata,omitempty"`
+}
+
+// SemaphoreState is stored in the Data of the ClusterLock of a semaphore
+type SemaphoreState struct {
+	Holders []SemaphoreEntry `json:"holders,omitempty"`
+	// the owners waiting for the semaphore, in the order they arrived
+	Queue []SemaphoreEntry `json:"queue,omitempty"`
+}
+
+// Position returns 0 when the owner holds the semaphore, its position in the queue starting at 1 when it is waiting,
+// and -1 otherwise
+func (s *SemaphoreState) Position(ownerId string) int {
+	if indexOf(s.Holders, ownerId) >= 0 {
+		return 0
+	}
+	if i := indexOf(s.Queue, ownerId); i >= 0 {
+		return i + 1
+	}
+	return -1
+}
+
+// HolderIDs returns the owners holding the semaphore
+func (s *SemaphoreState) HolderIDs() []string {
+	var ids []string
+	for _, holder := range s.Holders {
+		ids = append(ids, holder.OwnerID)
+	}
+	return ids
+}
+
+// removes the holders and tickets of owners which stopped sending heartbeats
+func (s *SemaphoreState) prune(now time.Time) {
+	alive := func(entries []SemaphoreEntry) []SemaphoreEntry {
+		var result []SemaphoreEntry
+		for _, entry := range entries {
+			if now.Sub(entry.Heartbeat) <= DefaultLockTimeout {
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+	s.Holders = alive(s.Holders)
+	s.Queue = alive(s.Queue)
+}
+
+func indexOf(entries []SemaphoreEntry, ownerId string) int {
+	for i, entry := range entries {
+		if entry.OwnerID == ownerId {
+			return i
+		}
+	}
+	return -1
+}
+
+func semaphoreStateFrom(lock *ClusterLock) (*SemaphoreState, error) {
+	state := &SemaphoreState{}
+	if lock.Data == "" {
+		return state, nil
+	}
+	if err := json.Unmarshal([]byte(lock.Data), state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// TestClusterSemaphore is a counting semaphore: up to Capacity owners hold it at the same time, e.g. so that a few
+// test suites share a cluster. Waiters get a ticket in a queue and acquire in the order they arrived.
+type TestClusterSemaphore struct {
+	client   ClusterLockClient
+	ownerId  string
+	ctx      context.Context
+	name     string
+	capacity int
+	metadata HolderMetadata
+	metrics  Metrics
+
+	lock            sync.Mutex
+	cancelHeartbeat context.CancelFunc
+	acquiredAt      time.Time
+}
+
+func NewKubeClusterSemaphore(clientset kubernetes.Interface, options Options, semaphoreOptions SemaphoreOptions) (*TestClusterSemaphore, error) {
+	if options.Namespace == "" {
+		options.Namespace = LockDefaultNamespace
+	}
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	client := &KubeClusterLockClient{
+		namespace: options.Namespace,
+		clientset: clientset,
+	}
+	return NewClusterSemaphore(options.Context, options.IdPrefix, client, semaphoreOptions)
+}
+
+func NewConsulClusterSemaphore(ctx context.Context, idPrefix string, consul *api.Client, semaphoreOptions SemaphoreOptions) (*TestClusterSemaphore, error) {
+	client := &ConsulClusterLockClient{
+		client: consul,
+	}
+	return NewClusterSemaphore(ctx, idPrefix, client, semaphoreOptions)
+}
+
+func NewClusterSemaphore(ctx context.Context, idPrefix string, client ClusterLockClient, options SemaphoreOptions) (*TestClusterSemaphore, error) {
+	if options.Name == "" {
+		options.Name = SemaphoreResourceName
+	}
+	if options.Capacity <= 0 {
+		options.Capacity = 1
+	}
+	_, err := client.Create(ctx, &ClusterLock{Name: options.Name})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return &TestClusterSemaphore{
+		client:   client,
+		ownerId:  idPrefix + uuid.New().String(),
+		ctx:      ctx,
+		name:     options.Name,
+		capacity: options.Capacity,
+		metadata: DefaultHolderMetadata(""),
+		metrics:  noopMetrics{},
+	}, nil
+}
+
+// WithMetadata sets the metadata recorded in the entry of the owner, the start time is set when it takes a slot
+func (s *TestClusterSemaphore) WithMetadata(metadata HolderMetadata) *TestClusterSemaphore {
+	s.metadata = metadata
+	return s
+}
+
+func (s *TestClusterSemaphore) WithMetrics(metrics Metrics) *TestClusterSemaphore {
+	s.metrics = metrics
+	return s
+}
+
+func (s *TestClusterSemaphore) OwnerID() string {
+	return s.ownerId
+}
+
+// Acquire takes a ticket and waits for a free slot in the order of the tickets. Waiting stops when the retry
+// options give up, which also gives up the ticket.
+func (s *TestClusterSemaphore) Acquire(opts ...retry.Option) error {
+	return s.AcquireWithContext(s.ctx, opts...)
+}
+
+// AcquireWithContext is Acquire, which also stops waiting when ctx is done
+func (s *TestClusterSemaphore) AcquireWithContext(ctx context.Context, opts ...retry.Option) error {
+	start := time.Now()
+	opts = append(append(append([]retry.Option{}, defaultOpts...), opts...), retry.Context(ctx))
+
+	err := retry.Do(func() error {
+		return s.acquireLoop(ctx)
+	}, opts...)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		s.leave()
+	}
+	s.metrics.ObserveWait(s.name, time.Since(start), err == nil)
+	if err != nil {
+		return err
+	}
+
+	heartbeatCtx, cancel := context.WithCancel(s.ctx)
+	s.lock.Lock()
+	s.cancelHeartbeat = cancel
+	s.acquiredAt = time.Now()
+	s.lock.Unlock()
+	go s.heartbeat(heartbeatCtx)
+	return nil
+}
+
+// leave gives up the ticket of the owner, or the slot it took after it stopped waiting
+func (s *TestClusterSemaphore) leave() {
+	err := s.updateWithRetries(s.ctx, func(state *SemaphoreState) error {
+		if i := indexOf(state.Queue, s.ownerId); i >= 0 {
+			state.Queue = append(state.Queue[:i], state.Queue[i+1:]...)
+		}
+		if i := indexOf(state.Holders, s.ownerId); i >= 0 {
+			state.Holders = append(state.Holders[:i], state.Holders[i+1:]...)
+		}
+		return nil
+	})
+	if err != nil {
+		contextutils.LoggerFrom(s.ctx).Warnw("could not leave the semaphore queue", zap.Error(err))
+	}
+}
+
+func (s *TestClusterSemaphore) acquireLoop(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	acquired := false
+	err := s.update(ctx, func(state *SemaphoreState) error {
+		now := time.Now()
+		state.prune(now)
+		if i := indexOf(state.Holders, s.ownerId); i >= 0 {
+			state.Holders[i].Heartbeat = now
+			acquired = true
+			return nil
+		}
+		i := indexOf(state.Queue, s.ownerId)
+		if i < 0 {
+			state.Queue = append(state.Queue, SemaphoreEntry{OwnerID: s.ownerId})
+			i = len(state.Queue) - 1
+		}
+		state.Queue[i].Heartbeat = now
+		// only the first tickets in the queue may take the free slots
+		if i < s.capacity-len(state.Holders) {
+			metadata := s.metadata
+			metadata.StartTime = now
+			state.Queue[i].Metadata = &metadata
+			state.Holders = append(state.Holders, state.Queue[i])
+			state.Queue = append(state.Queue[:i], state.Queue[i+1:]...)
+			acquired = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return lockInUseError
+	}
+	return nil
+}
+
+func (s *TestClusterSemaphore) heartbeat(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(DefaultHeartbeatTime):
+			err := s.updateWithRetries(ctx, func(state *SemaphoreState) error {
+				i := indexOf(state.Holders, s.ownerId)
+				if i < 0 {
+					return notLockOwnerError
+				}
+				state.Holders[i].Heartbeat = time.Now()
+				return nil
+			})
+			if err != nil {
+				contextutils.LoggerFrom(ctx).Errorw("could not refresh semaphore heartbeat", zap.Error(err))
+				return
+			}
+		}
+	}
+}
+
+// Release frees the slot of the owner
+func (s *TestClusterSemaphore) Release() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.cancelHeartbeat != nil {
+		s.cancelHeartbeat()
+		s.cancelHeartbeat = nil
+	}
+	err := s.updateWithRetries(s.ctx, func(state *SemaphoreState) error {
+		i := indexOf(state.Holders, s.ownerId)
+		if i < 0 {
+			return notLockOwnerError
+		}
+		state.Holders = append(state.Holders[:i], state.Holders[i+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !s.acquiredAt.IsZero() {
+		s.metrics.ObserveHold(s.name, time.Since(s.acquiredAt))
+		s.acquiredAt = time.Time{}
+	}
+	return nil
+}
+
+// ForceRelease frees the slot or drops the ticket of any owner, e.g. when the job holding it is stuck. It returns
+// the entry which was removed.
+func (s *TestClusterSemaphore) ForceRelease(ctx context.Context, ownerId string) (*SemaphoreEntry, error) {
+	var removed *SemaphoreEntry
+	err := s.updateWithRetries(ctx, func(state *SemaphoreState) error {
+		if i := indexOf(state.Holders, ownerId); i >= 0 {
+			entry := state.Holders[i]
+			removed = &entry
+			state.Holders = append(state.Holders[:i], state.Holders[i+1:]...)
+			return nil
+		}
+		if i := indexOf(state.Queue, ownerId); i >= 0 {
+			entry := state.Queue[i]
+			removed = &entry
+			state.Queue = append(state.Queue[:i], state.Queue[i+1:]...)
+			return nil
+		}
+		return notQueuedError
+	})
+	if err != nil {
+		return nil, err
+	}
+	contextutils.LoggerFrom(ctx).Warnw("force released semaphore", zap.String("owner", ownerId))
+	return removed, nil
+}
+
+// State returns the current holders and queue of the semaphore
+func (s *TestClusterSemaphore) State() (*SemaphoreState, error) {
+	lock, err := s.client.Get(s.ctx, s.name)
+	if err != nil {
+		return nil, err
+	}
+	state, err := semaphoreStateFrom(lock)
+	if err != nil {
+		return nil, err
+	}
+	state.prune(time.Now())
+	return state, nil
+}
+
+// QueuePosition returns 0 when the owner holds the semaphore, and its position in the queue starting at 1 when it
+// is waiting
+func (s *TestClusterSemaphore) QueuePosition() (int, error) {
+	state, err := s.State()
+	if err != nil {
+		return 0, err
+	}
+	position := state.Position(s.ownerId)
+	if position < 0 {
+		return 0, notQueuedError
+	}
+	return position, nil
+}
+
+// Holders returns the owners holding the semaphore
+func (s *TestClusterSemaphore) Holders() ([]string, error) {
+	state, err := s.State()
+	if err != nil {
+		return nil, err
+	}
+	return state.HolderIDs(), nil
+}
+
+// update applies f to the stored state. It fails with a conflict when the state changed in the meantime.
+func (s *TestClusterSemaphore) update(ctx context.Context, f func(state *SemaphoreState) error) error {
+	lock, err := s.client.Get(ctx, s.name)
+	if errors.IsNotFound(err) {
+		lock, err = s.client.Create(ctx, &ClusterLock{Name: s.name})
+		if errors.IsAlreadyExists(err) {
+			// created concurrently, start over
+			return ConflictError(s.name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	state, err := semaphoreStateFrom(lock)
+	if err != nil {
+		return err
+	}
+	if err := f(state); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	lock.Data = string(data)
+	_, err = s.client.Update(ctx, lock)
+	return err
+}
+
+func (s *TestClusterSemaphore) updateWithRetries(ctx context.Context, f func(state *SemaphoreState) error) error {
+	return retry.Do(
+		func() error {
+			return s.update(ctx, f)
+		},
+		retry.DelayType(retry.FixedDelay),
+		retry.Attempts(5),
+		retry.Delay(100*time.Millisecond),
+		retry.LastErrorOnly(true),
+		retry.RetryIf(func(e error) bool {
+			return errors.IsConflict(e)
+		}),
+	)
+}
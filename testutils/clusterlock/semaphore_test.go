@@ -0,0 +1,170 @@
+package clusterlock_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/avast/retry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/clusterlock"
+)
+
+// memoryClient stores locks in memory, with the same compare-and-swap semantics as the kube and consul clients
+type memoryClient struct {
+	lock    sync.Mutex
+	locks   map[string]clusterlock.ClusterLock
+	version int
+}
+
+func newMemoryClient() *memoryClient {
+	return &memoryClient{locks: map[string]clusterlock.ClusterLock{}}
+}
+
+func (c *memoryClient) Create(_ context.Context, cl *clusterlock.ClusterLock) (*clusterlock.ClusterLock, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.locks[cl.Name]; ok {
+		return nil, clusterlock.ExistsError(cl.Name)
+	}
+	return c.put(*cl), nil
+}
+
+func (c *memoryClient) Update(_ context.Context, cl *clusterlock.ClusterLock) (*clusterlock.ClusterLock, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	existing, ok := c.locks[cl.Name]
+	if !ok {
+		return nil, clusterlock.NotFoundError(cl.Name)
+	}
+	if existing.ResourceVersion != cl.ResourceVersion {
+		return nil, clusterlock.ConflictError(cl.Name)
+	}
+	return c.put(*cl), nil
+}
+
+func (c *memoryClient) put(cl clusterlock.ClusterLock) *clusterlock.ClusterLock {
+	c.version++
+	cl.ResourceVersion = strconv.Itoa(c.version)
+	c.locks[cl.Name] = cl
+	return &cl
+}
+
+func (c *memoryClient) Get(_ context.Context, name string) (*clusterlock.ClusterLock, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cl, ok := c.locks[name]
+	if !ok {
+		return nil, clusterlock.NotFoundError(name)
+	}
+	return &cl, nil
+}
+
+func (c *memoryClient) Delete(_ context.Context, name string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.locks, name)
+	return nil
+}
+
+var _ = Describe("cluster semaphore", func() {
+	var (
+		ctx    context.Context
+		client *memoryClient
+	)
+
+	fast := []retry.Option{retry.Delay(10 * time.Millisecond), retry.Attempts(500)}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		client = newMemoryClient()
+	})
+
+	newSemaphore := func(prefix string, capacity int) *clusterlock.TestClusterSemaphore {
+		semaphore, err := clusterlock.NewClusterSemaphore(ctx, prefix, client, clusterlock.SemaphoreOptions{Capacity: capacity})
+		Expect(err).NotTo(HaveOccurred())
+		return semaphore
+	}
+
+	It("is held by up to capacity owners", func() {
+		a, b, c := newSemaphore("a-", 2), newSemaphore("b-", 2), newSemaphore("c-", 2)
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Acquire()).NotTo(HaveOccurred())
+		Expect(c.Acquire(retry.Delay(time.Millisecond), retry.Attempts(3))).To(HaveOccurred())
+
+		holders, err := c.Holders()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(holders).To(ConsistOf(a.OwnerID(), b.OwnerID()))
+		// giving up waiting gives up the ticket
+		_, err = c.QueuePosition()
+		Expect(clusterlock.IsNotQueuedError(err)).To(BeTrue())
+
+		Expect(a.Release()).NotTo(HaveOccurred())
+		Expect(c.Acquire()).NotTo(HaveOccurred())
+		Expect(b.Release()).NotTo(HaveOccurred())
+		Expect(c.Release()).NotTo(HaveOccurred())
+	})
+
+	It("is acquired in the order of arrival", func() {
+		a, b, c := newSemaphore("a-", 1), newSemaphore("b-", 1), newSemaphore("c-", 1)
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+
+		acquired := make(chan string, 2)
+		wait := func(s *clusterlock.TestClusterSemaphore) {
+			go func() {
+				defer GinkgoRecover()
+				Expect(s.Acquire(fast...)).NotTo(HaveOccurred())
+				acquired <- s.OwnerID()
+			}()
+		}
+		wait(b)
+		Eventually(b.QueuePosition).Should(Equal(1))
+		wait(c)
+		Eventually(c.QueuePosition).Should(Equal(2))
+
+		Expect(a.Release()).NotTo(HaveOccurred())
+		Eventually(acquired).Should(Receive(Equal(b.OwnerID())))
+		Expect(c.QueuePosition()).To(Equal(1))
+		Expect(b.Release()).NotTo(HaveOccurred())
+		Eventually(acquired).Should(Receive(Equal(c.OwnerID())))
+		Expect(c.QueuePosition()).To(Equal(0))
+		Expect(c.Release()).NotTo(HaveOccurred())
+	})
+
+	It("drops holders and tickets which stopped sending heartbeats", func() {
+		stale := time.Now().Add(-time.Hour)
+		state, err := json.Marshal(clusterlock.SemaphoreState{
+			Holders: []clusterlock.SemaphoreEntry{{OwnerID: "crashed", Heartbeat: stale}},
+			Queue:   []clusterlock.SemaphoreEntry{{OwnerID: "gone", Heartbeat: stale}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.Create(ctx, &clusterlock.ClusterLock{Name: clusterlock.SemaphoreResourceName, Data: string(state)})
+		Expect(err).NotTo(HaveOccurred())
+
+		a := newSemaphore("a-", 1)
+		Expect(a.Holders()).To(BeEmpty())
+		Expect(a.Acquire(retry.Attempts(1))).NotTo(HaveOccurred())
+		Expect(a.Holders()).To(Equal([]string{a.OwnerID()}))
+	})
+
+	It("only releases for holders", func() {
+		a, b := newSemaphore("a-", 1), newSemaphore("b-", 1)
+		Expect(a.Acquire()).NotTo(HaveOccurred())
+		Expect(clusterlock.IsNotLockOwnerError(b.Release())).To(BeTrue())
+		Expect(a.Release()).NotTo(HaveOccurred())
+	})
+
+	It("stores its state in configmaps and consul keys", func() {
+		lock := clusterlock.ClusterLock{Name: "test-semaphore", Data: `{"holders":[{"owner":"a@b"}]}`}
+		Expect(clusterlock.CLFromConfigMap(lock.ConfigMap("default")).Data).To(Equal(lock.Data))
+		Expect(clusterlock.CLFromKVPair("prefix-", lock.KVPair("prefix-")).Data).To(Equal(lock.Data))
+
+		legacy := clusterlock.ClusterLock{Name: "test-lock", OwnerID: "owner", Timeout: "timeout"}
+		kvp := legacy.KVPair("")
+		Expect(string(kvp.Value)).To(Equal("owner@timeout"))
+		Expect(*clusterlock.CLFromKVPair("", kvp)).To(Equal(clusterlock.ClusterLock{Name: "test-lock", OwnerID: "owner", Timeout: "timeout", ResourceVersion: "0"}))
+	})
+})
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -9,7 +10,10 @@ import (
 	"time"
 
 	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	"github.com/pkg/errors"
 	"github.com/solo-io/go-utils/log"
+	"github.com/solo-io/k8s-utils/kubeutils"
 )
 
 type CurlOpts struct {
@@ -156,18 +160,8 @@ func (t *testContainer) buildCurlArgs(opts CurlOpts) []string {
 	for h, v := range opts.Headers {
 		args = append(args, "-H", fmt.Sprintf("%v: %v", h, v))
 	}
-	port := opts.Port
-	if port == 0 {
-		port = 8080
-	}
-	protocol := opts.Protocol
-	if protocol == "" {
-		protocol = "http"
-	}
-	service := opts.Service
-	if service == "" {
-		service = "test-ingress"
-	}
+	target := curlTargetFor(opts)
+	port, protocol, service := target.port, target.protocol, target.service
 	if opts.SelfSigned {
 		args = append(args, "-k")
 	}
@@ -197,3 +191,42 @@ func (t *testContainer) CurlAsyncChan(opts CurlOpts) (<-chan io.Reader, chan str
 	args := t.buildCurlArgs(opts)
 	return t.TestRunnerChan(&bytes.Buffer{}, args...)
 }
+
+// CurlResponse sends the request from Go through a port-forward instead of running curl in the container, and
+// returns the structured response. CA files are read from the container, like curl does.
+func (t *testContainer) CurlResponse(ctx context.Context, opts CurlOpts) (*CurlResponse, error) {
+	return t.executor().Do(ctx, opts)
+}
+
+// the executor sending requests from Go, created on first use
+func (t *testContainer) executor() *HttpExecutor {
+	t.httpExecutorOnce.Do(func() {
+		t.httpExecutor = newHttpExecutor(t.cfg, t.namespace, func(ctx context.Context, path string) ([]byte, error) {
+			result, err := kubeutils.ExecInPod(ctx, t.cfg, kubeutils.ContainerRef{Namespace: t.namespace, Pod: t.echoName}, []string{"cat", path}, nil)
+			if err != nil {
+				return nil, err
+			}
+			if result.ExitCode != 0 {
+				return nil, errors.Errorf("reading %s from %s: %s", path, t.echoName, result.Stderr)
+			}
+			return []byte(result.Stdout), nil
+		})
+	})
+	return t.httpExecutor
+}
+
+// CurlEventuallyShouldReturn checks the structured response of the request, e.g.
+//
+//	runner.CurlEventuallyShouldReturn(opts, gstruct.PointTo(gstruct.MatchFields(gstruct.IgnoreExtras, gstruct.Fields{
+//		"StatusCode": Equal(http.StatusOK),
+//	})), 1)
+func (t *testContainer) CurlEventuallyShouldReturn(opts CurlOpts, matcher types.GomegaMatcher, ginkgoOffset int, timeout ...time.Duration) {
+	currentTimeout, pollingInterval := getTimeouts(timeout...)
+	// a stalled request must not keep the poll running past its timeout
+	deadline := time.Now().Add(currentTimeout)
+	gomega.EventuallyWithOffset(ginkgoOffset+1, func() (*CurlResponse, error) {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		return t.CurlResponse(ctx, opts)
+	}, currentTimeout, pollingInterval).Should(matcher)
+}
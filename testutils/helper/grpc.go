@@ -0,0 +1,309 @@
+package helper
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type GrpcOpts struct {
+	// defaults to test-ingress
+	Service string
+	// defaults to 8080
+	Port int
+	// Optional :authority header, like the Host header of CurlOpts
+	Authority string
+	// Tls enables tls. Sni, CaFile and SelfSigned behave like they do in CurlOpts.
+	Tls        bool
+	Sni        string
+	CaFile     string
+	SelfSigned bool
+	// Full name of the method to call, e.g. helloworld.Greeter/SayHello
+	Method string
+	// The request message, as JSON
+	Request string
+	// Sent as request metadata
+	Headers map[string]string
+	// Optional descriptors of the service, e.g. from protoc --descriptor_set_out --include_imports.
+	// When nil, the descriptors are fetched with server reflection.
+	Descriptors *descriptorpb.FileDescriptorSet
+	// Optional deadline of the call
+	Timeout time.Duration
+}
+
+// GrpcResponse is the result of a unary call. Calls which fail with a grpc status, e.g. Unavailable, are responses
+// with that code rather than errors.
+type GrpcResponse struct {
+	Code    codes.Code
+	Message string
+	// the response message, as JSON
+	Body     string
+	Headers  metadata.MD
+	Trailers metadata.MD
+}
+
+func (o GrpcOpts) target() curlTarget {
+	return curlTargetFor(CurlOpts{Service: o.Service, Port: o.Port})
+}
+
+// GrpcCall calls a unary method. The request and response messages are built from the descriptors of the method.
+func (e *HttpExecutor) GrpcCall(ctx context.Context, opts GrpcOpts) (*GrpcResponse, error) {
+	serviceName, methodName, err := splitGrpcMethod(opts.Method)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := e.grpcConn(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ctx, cancel := grpcContext(ctx, opts)
+	defer cancel()
+
+	files, err := grpcDescriptors(ctx, conn, opts.Descriptors, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, errors.Wrapf(err, "finding service %s", serviceName)
+	}
+	service, ok := descriptor.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.Errorf("%s is not a service", serviceName)
+	}
+	method := service.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, errors.Errorf("service %s has no method %s", serviceName, methodName)
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, errors.Errorf("%s is a streaming method, only unary methods can be called", opts.Method)
+	}
+
+	request := dynamicpb.NewMessage(method.Input())
+	if opts.Request != "" {
+		if err := protojson.Unmarshal([]byte(opts.Request), request); err != nil {
+			return nil, errors.Wrapf(err, "parsing request as %s", method.Input().FullName())
+		}
+	}
+	reply := dynamicpb.NewMessage(method.Output())
+	response := &GrpcResponse{}
+	err = conn.Invoke(ctx, "/"+serviceName+"/"+methodName, request, reply, grpc.Header(&response.Headers), grpc.Trailer(&response.Trailers))
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			return nil, err
+		}
+		response.Code, response.Message = st.Code(), st.Message()
+		return response, nil
+	}
+	body, err := protojson.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = string(body)
+	return response, nil
+}
+
+// GrpcHealthCheck calls the grpc health checking protocol for a service, or for the server when service is empty
+func (e *HttpExecutor) GrpcHealthCheck(ctx context.Context, opts GrpcOpts, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	conn, err := e.grpcConn(ctx, opts)
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	defer conn.Close()
+	ctx, cancel := grpcContext(ctx, opts)
+	defer cancel()
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		return healthpb.HealthCheckResponse_UNKNOWN, err
+	}
+	return response.GetStatus(), nil
+}
+
+func (e *HttpExecutor) grpcConn(ctx context.Context, opts GrpcOpts) (*grpc.ClientConn, error) {
+	target := opts.target()
+	creds := insecure.NewCredentials()
+	if opts.Tls {
+		tlsConfig, err := e.tlsConfig(ctx, opts.CaFile, opts.SelfSigned)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ServerName = opts.Sni
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = target.service
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			address, err := e.dial(ctx, target.service, target.port)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+			if err != nil {
+				e.resetForward(target.service, target.port)
+			}
+			return conn, err
+		}),
+	}
+	if opts.Authority != "" {
+		dialOpts = append(dialOpts, grpc.WithAuthority(opts.Authority))
+	}
+	log.Printf("grpc: %s on %s:%d", opts.Method, target.service, target.port)
+	return grpc.NewClient("passthrough:///"+target.service, dialOpts...)
+}
+
+func grpcContext(ctx context.Context, opts GrpcOpts) (context.Context, context.CancelFunc) {
+	for k, v := range opts.Headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	if opts.Timeout > 0 {
+		return context.WithTimeout(ctx, opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func splitGrpcMethod(fullMethod string) (string, string, error) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	i := strings.LastIndex(fullMethod, "/")
+	if i <= 0 || i == len(fullMethod)-1 {
+		return "", "", errors.Errorf("invalid grpc method %q, expected <package>.<service>/<method>", fullMethod)
+	}
+	return fullMethod[:i], fullMethod[i+1:], nil
+}
+
+// grpcDescriptors returns the given descriptors, or the descriptors of the service fetched with server reflection
+func grpcDescriptors(ctx context.Context, conn *grpc.ClientConn, set *descriptorpb.FileDescriptorSet, serviceName string) (*protoregistry.Files, error) {
+	if set != nil {
+		return protodesc.NewFiles(set)
+	}
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "starting server reflection")
+	}
+	defer stream.CloseSend()
+	request := func(req *reflectionpb.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResponse := res.GetErrorResponse(); errResponse != nil {
+			return nil, errors.Errorf("server reflection: %s", errResponse.GetErrorMessage())
+		}
+		var files []*descriptorpb.FileDescriptorProto
+		for _, b := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			file := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(b, file); err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		return files, nil
+	}
+
+	files, err := request(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: serviceName},
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving service %s with server reflection", serviceName)
+	}
+	// servers may leave out dependencies which were sent before, or well known types
+	byName := map[string]*descriptorpb.FileDescriptorProto{}
+	for len(files) > 0 {
+		file := files[0]
+		files = files[1:]
+		if _, ok := byName[file.GetName()]; ok {
+			continue
+		}
+		byName[file.GetName()] = file
+		for _, dependency := range file.GetDependency() {
+			if _, ok := byName[dependency]; ok {
+				continue
+			}
+			if known, err := protoregistry.GlobalFiles.FindFileByPath(dependency); err == nil {
+				files = append(files, protodesc.ToFileDescriptorProto(known))
+				continue
+			}
+			fetched, err := request(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dependency},
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "resolving file %s", dependency)
+			}
+			files = append(files, fetched...)
+		}
+	}
+	resolved := &descriptorpb.FileDescriptorSet{}
+	for _, file := range byName {
+		resolved.File = append(resolved.File, file)
+	}
+	return protodesc.NewFiles(resolved)
+}
+
+// GrpcCall calls a unary method from Go through a port-forward to the service
+func (t *testContainer) GrpcCall(ctx context.Context, opts GrpcOpts) (*GrpcResponse, error) {
+	return t.executor().GrpcCall(ctx, opts)
+}
+
+// GrpcHealthCheck checks the health of a service, or of the server when service is empty, from Go through a
+// port-forward to the service
+func (t *testContainer) GrpcHealthCheck(ctx context.Context, opts GrpcOpts, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	return t.executor().GrpcHealthCheck(ctx, opts, service)
+}
+
+// GrpcEventuallyShouldRespond checks that the call eventually succeeds with a response containing substr, like
+// CurlEventuallyShouldRespond
+func (t *testContainer) GrpcEventuallyShouldRespond(opts GrpcOpts, substr string, ginkgoOffset int, timeout ...time.Duration) {
+	currentTimeout, pollingInterval := getTimeouts(timeout...)
+	deadline := time.Now().Add(currentTimeout)
+	gomega.EventuallyWithOffset(ginkgoOffset+1, func() string {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		response, err := t.GrpcCall(ctx, opts)
+		if err != nil {
+			return err.Error()
+		}
+		if response.Code != codes.OK {
+			return response.Code.String() + ": " + response.Message
+		}
+		return response.Body
+	}, currentTimeout, pollingInterval).Should(gomega.ContainSubstring(substr))
+}
+
+// GrpcHealthEventuallyShouldBe checks that the health of a service, or of the server when service is empty,
+// eventually has the given status
+func (t *testContainer) GrpcHealthEventuallyShouldBe(opts GrpcOpts, service string, expected healthpb.HealthCheckResponse_ServingStatus, ginkgoOffset int, timeout ...time.Duration) {
+	currentTimeout, pollingInterval := getTimeouts(timeout...)
+	deadline := time.Now().Add(currentTimeout)
+	gomega.EventuallyWithOffset(ginkgoOffset+1, func() (healthpb.HealthCheckResponse_ServingStatus, error) {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		return t.GrpcHealthCheck(ctx, opts, service)
+	}, currentTimeout, pollingInterval).Should(gomega.Equal(expected))
+}
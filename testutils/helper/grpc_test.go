@@ -0,0 +1,111 @@
+package helper
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var _ = Describe("grpc probes", func() {
+	var (
+		ctx      context.Context
+		listener net.Listener
+		server   *grpc.Server
+		executor *HttpExecutor
+	)
+
+	start := func(withReflection bool) {
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		server = grpc.NewServer()
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus("gloo", healthpb.HealthCheckResponse_NOT_SERVING)
+		healthpb.RegisterHealthServer(server, healthServer)
+		if withReflection {
+			reflection.Register(server)
+		}
+		go server.Serve(listener)
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		executor = &HttpExecutor{
+			dial: func(_ context.Context, service string, port int) (string, error) {
+				Expect(service).To(Equal("grpc-server"))
+				return listener.Addr().String(), nil
+			},
+			forwards: map[string]portForward{},
+		}
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	It("builds requests with server reflection", func() {
+		start(true)
+		response, err := executor.GrpcCall(ctx, GrpcOpts{
+			Service: "grpc-server",
+			Method:  "grpc.health.v1.Health/Check",
+			Request: `{"service": "gloo"}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Code).To(Equal(codes.OK))
+		Expect(response.Body).To(MatchJSON(`{"status": "NOT_SERVING"}`))
+	})
+
+	It("builds requests with descriptors", func() {
+		start(false)
+		opts := GrpcOpts{
+			Service: "grpc-server",
+			Method:  "/grpc.health.v1.Health/Check",
+			Descriptors: &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+				protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto),
+			}},
+		}
+		response, err := executor.GrpcCall(ctx, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Body).To(MatchJSON(`{"status": "SERVING"}`))
+
+		opts.Descriptors = nil
+		_, err = executor.GrpcCall(ctx, opts)
+		Expect(err).To(MatchError(ContainSubstring("server reflection")))
+	})
+
+	It("returns grpc statuses as responses", func() {
+		start(true)
+		response, err := executor.GrpcCall(ctx, GrpcOpts{
+			Service: "grpc-server",
+			Method:  "grpc.health.v1.Health/Check",
+			Request: `{"service": "missing"}`,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.Code).To(Equal(codes.NotFound))
+		Expect(response.Body).To(BeEmpty())
+
+		_, err = executor.GrpcCall(ctx, GrpcOpts{Service: "grpc-server", Method: "grpc.health.v1.Health/Missing"})
+		Expect(err).To(MatchError(ContainSubstring("has no method Missing")))
+		_, err = executor.GrpcCall(ctx, GrpcOpts{Service: "grpc-server", Method: "grpc.health.v1.Health/Watch"})
+		Expect(err).To(MatchError(ContainSubstring("streaming method")))
+	})
+
+	It("checks health", func() {
+		start(false)
+		status, err := executor.GrpcHealthCheck(ctx, GrpcOpts{Service: "grpc-server"}, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(healthpb.HealthCheckResponse_SERVING))
+		status, err = executor.GrpcHealthCheck(ctx, GrpcOpts{Service: "grpc-server"}, "gloo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+	})
+})
@@ -0,0 +1,300 @@
+package helper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/log"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// CurlResponse is the structured result of sending CurlOpts with an HttpExecutor
+type CurlResponse struct {
+	StatusCode int
+	// e.g. HTTP/1.1
+	Proto   string
+	Headers http.Header
+	Body    string
+	// the certificates presented by the server, leaf first. Empty for plain http.
+	PeerCertificates []*x509.Certificate
+	// the tls version negotiated with the server, e.g. tls.VersionTLS13. Zero for plain http.
+	TLSVersion uint16
+	Timings    CurlTimings
+}
+
+// CurlTimings are measured from the start of the request, like the timings of curl's --write-out
+type CurlTimings struct {
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	Total        time.Duration
+}
+
+// HttpExecutor sends the requests described by CurlOpts from Go, through a port-forward to the service, instead of
+// running curl in the testrunner pod. The url, Host header, SNI name and certificate checks are the same as the
+// ones of the curl command built for the same options.
+type HttpExecutor struct {
+	// returns the local address to connect to for a port of a service
+	dial func(ctx context.Context, service string, port int) (string, error)
+	// returns the contents of CurlOpts.CaFile
+	readFile func(ctx context.Context, path string) ([]byte, error)
+
+	lock     sync.Mutex
+	forwards map[string]portForward
+}
+
+type portForward struct {
+	address string
+	stop    func()
+}
+
+// NewHttpExecutor port-forwards to services of the given namespace, or of the namespace named in the service,
+// like gateway-proxy.gloo-system or gateway-proxy.gloo-system.svc.cluster.local. CA files are read from the local
+// filesystem.
+func NewHttpExecutor(cfg *rest.Config, namespace string) *HttpExecutor {
+	return newHttpExecutor(cfg, namespace, func(_ context.Context, path string) ([]byte, error) {
+		return os.ReadFile(path)
+	})
+}
+
+func newHttpExecutor(cfg *rest.Config, namespace string, readFile func(ctx context.Context, path string) ([]byte, error)) *HttpExecutor {
+	e := &HttpExecutor{readFile: readFile, forwards: map[string]portForward{}}
+	e.dial = func(ctx context.Context, service string, port int) (string, error) {
+		return e.forward(ctx, cfg, namespace, service, port)
+	}
+	return e
+}
+
+// splitServiceHost returns the name and namespace of a service addressed the way cluster DNS resolves it:
+// name, name.namespace, name.namespace.svc or name.namespace.svc.<cluster domain>. Like the DNS search path, a
+// name.namespace host only names a service if the namespace exists, so that e.g. example.com is left as is.
+func splitServiceHost(service, defaultNamespace string, namespaceExists func(namespace string) bool) (string, string) {
+	parts := strings.Split(service, ".")
+	switch {
+	case len(parts) == 2 && namespaceExists(parts[1]):
+		return parts[0], parts[1]
+	case len(parts) > 2 && parts[2] == "svc":
+		return parts[0], parts[1]
+	default:
+		return service, defaultNamespace
+	}
+}
+
+// forwards are kept open across requests, and reopened after a request fails in case the pod went away
+func (e *HttpExecutor) forward(ctx context.Context, cfg *rest.Config, namespace, service string, port int) (string, error) {
+	key := fmt.Sprintf("%s:%d", service, port)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if forward, ok := e.forwards[key]; ok {
+		return forward.address, nil
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	name, serviceNamespace := splitServiceHost(service, namespace, func(namespace string) bool {
+		_, err := kube.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		// the namespace is taken to exist if it can't be read
+		return !kubeerrors.IsNotFound(err)
+	})
+	// the forward outlives the request, so it is not bound to the request's context
+	address, stop, err := kubeutils.PortForwardService(context.Background(), cfg, serviceNamespace, name, 0, port)
+	if err != nil {
+		return "", err
+	}
+	e.forwards[key] = portForward{address: address, stop: stop}
+	return address, nil
+}
+
+func (e *HttpExecutor) resetForward(service string, port int) {
+	key := fmt.Sprintf("%s:%d", service, port)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if forward, ok := e.forwards[key]; ok {
+		forward.stop()
+		delete(e.forwards, key)
+	}
+}
+
+// Close stops the port-forwards opened by the executor
+func (e *HttpExecutor) Close() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for key, forward := range e.forwards {
+		forward.stop()
+		delete(e.forwards, key)
+	}
+}
+
+// Do sends the request described by opts. A response with any status code is not an error.
+func (e *HttpExecutor) Do(ctx context.Context, opts CurlOpts) (*CurlResponse, error) {
+	target := curlTargetFor(opts)
+	tlsConfig, err := e.tlsConfig(ctx, opts.CaFile, opts.SelfSigned)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(opts.ConnectionTimeout) * time.Second
+	// the request is sent to the sni name like curl --resolve, which dials the service instead
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			address, err := e.dial(ctx, target.service, target.port)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+		DisableKeepAlives: true,
+		// the custom dialer and tls config turn off http/2, which curl negotiates over tls
+		ForceAttemptHTTP2: true,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		// like curl without -L
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var body io.Reader
+	if opts.Body != "" {
+		body = strings.NewReader(opts.Body)
+	}
+	request, err := http.NewRequestWithContext(ctx, target.method(opts), target.url(opts), body)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Host != "" {
+		request.Host = opts.Host
+	}
+	if opts.Body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for h, v := range opts.Headers {
+		if strings.EqualFold(h, "host") {
+			request.Host = v
+			continue
+		}
+		request.Header.Set(h, v)
+	}
+
+	response := &CurlResponse{}
+	start := time.Now()
+	request = request.WithContext(httptrace.WithClientTrace(request.Context(), &httptrace.ClientTrace{
+		ConnectDone: func(string, string, error) {
+			response.Timings.Connect = time.Since(start)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			response.Timings.TLSHandshake = time.Since(start)
+		},
+		GotFirstResponseByte: func() {
+			response.Timings.FirstByte = time.Since(start)
+		},
+	}))
+	if opts.Verbose || opts.LogResponses {
+		log.Printf("sending: %s %s", request.Method, request.URL)
+	}
+	httpResponse, err := client.Do(request)
+	if err != nil {
+		e.resetForward(target.service, target.port)
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Timings.Total = time.Since(start)
+	response.StatusCode = httpResponse.StatusCode
+	response.Proto = httpResponse.Proto
+	response.Headers = httpResponse.Header
+	response.Body = string(responseBody)
+	if httpResponse.TLS != nil {
+		response.PeerCertificates = httpResponse.TLS.PeerCertificates
+		response.TLSVersion = httpResponse.TLS.Version
+	}
+	if opts.LogResponses {
+		log.GreyPrintf("response: %d %s", response.StatusCode, response.Body)
+	}
+	return response, nil
+}
+
+func (e *HttpExecutor) tlsConfig(ctx context.Context, caFile string, selfSigned bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: selfSigned}
+	if caFile != "" {
+		caPem, err := e.readFile(ctx, caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading ca file %s", caFile)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPem) {
+			return nil, errors.Errorf("no certificates found in ca file %s", caFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// curlTarget holds the defaults shared by the curl command and the HttpExecutor
+type curlTarget struct {
+	protocol string
+	service  string
+	port     int
+}
+
+func curlTargetFor(opts CurlOpts) curlTarget {
+	target := curlTarget{protocol: opts.Protocol, service: opts.Service, port: opts.Port}
+	if target.port == 0 {
+		target.port = 8080
+	}
+	if target.protocol == "" {
+		target.protocol = "http"
+	}
+	if target.service == "" {
+		target.service = "test-ingress"
+	}
+	return target
+}
+
+func (t curlTarget) url(opts CurlOpts) string {
+	host := t.service
+	if opts.Sni != "" {
+		host = opts.Sni
+	}
+	// like curl, leave out default ports so that they are not sent in the Host header
+	if (t.protocol == "http" && t.port == 80) || (t.protocol == "https" && t.port == 443) {
+		return fmt.Sprintf("%s://%s%s", t.protocol, host, opts.Path)
+	}
+	return fmt.Sprintf("%s://%s%s", t.protocol, net.JoinHostPort(host, strconv.Itoa(t.port)), opts.Path)
+}
+
+// the method curl uses for the options: -I sends HEAD and -d sends POST, unless overridden by -X
+func (t curlTarget) method(opts CurlOpts) string {
+	switch {
+	case opts.Method != "" && opts.Method != "GET":
+		return opts.Method
+	case opts.ReturnHeaders:
+		return http.MethodHead
+	case opts.Body != "":
+		return http.MethodPost
+	default:
+		return http.MethodGet
+	}
+}
@@ -0,0 +1,175 @@
+package helper
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("http executor", func() {
+	var (
+		ctx      context.Context
+		server   *httptest.Server
+		executor *HttpExecutor
+		dialed   []string
+
+		lock       sync.Mutex
+		serverName string
+	)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Host", r.Host)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("X-Custom", r.Header.Get("X-Custom"))
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, r.URL.Path+" "+string(body))
+	})
+
+	newExecutor := func() *HttpExecutor {
+		return &HttpExecutor{
+			dial: func(_ context.Context, service string, port int) (string, error) {
+				dialed = append(dialed, service)
+				return server.Listener.Addr().String(), nil
+			},
+			readFile: func(_ context.Context, path string) ([]byte, error) {
+				return os.ReadFile(path)
+			},
+			forwards: map[string]portForward{},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dialed = nil
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Context("http", func() {
+		BeforeEach(func() {
+			server = httptest.NewServer(handler)
+			executor = newExecutor()
+		})
+
+		It("sends the request curl would send", func() {
+			response, err := executor.Do(ctx, CurlOpts{
+				Service: "gateway-proxy",
+				Port:    80,
+				Path:    "/echo",
+				Host:    "example.com",
+				Body:    `{"hello":"world"}`,
+				Headers: map[string]string{"X-Custom": "value"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"gateway-proxy"}))
+			Expect(response.StatusCode).To(Equal(http.StatusTeapot))
+			Expect(response.Body).To(Equal(`/echo {"hello":"world"}`))
+			Expect(response.Headers.Get("X-Method")).To(Equal(http.MethodPost))
+			Expect(response.Headers.Get("X-Host")).To(Equal("example.com"))
+			Expect(response.Headers.Get("X-Content-Type")).To(Equal("application/json"))
+			Expect(response.Headers.Get("X-Custom")).To(Equal("value"))
+			Expect(response.PeerCertificates).To(BeEmpty())
+			Expect(response.Timings.Total).To(BeNumerically(">=", response.Timings.FirstByte))
+		})
+
+		It("defaults to the curl defaults", func() {
+			Expect(curlTargetFor(CurlOpts{}).url(CurlOpts{Path: "/"})).To(Equal("http://test-ingress:8080/"))
+			response, err := executor.Do(ctx, CurlOpts{ReturnHeaders: true})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"test-ingress"}))
+			Expect(response.Headers.Get("X-Method")).To(Equal(http.MethodHead))
+		})
+	})
+
+	Context("https", func() {
+		var caFile string
+
+		BeforeEach(func() {
+			server = httptest.NewUnstartedServer(handler)
+			server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				lock.Lock()
+				defer lock.Unlock()
+				serverName = hello.ServerName
+				return nil, nil
+			}}
+			server.EnableHTTP2 = true
+			server.StartTLS()
+			executor = newExecutor()
+
+			caFile = filepath.Join(GinkgoT().TempDir(), "ca.crt")
+			caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+			Expect(os.WriteFile(caFile, caPem, 0644)).NotTo(HaveOccurred())
+		})
+
+		It("verifies the sni name against the ca file", func() {
+			response, err := executor.Do(ctx, CurlOpts{
+				Protocol: "https",
+				Service:  "gateway-proxy",
+				Port:     443,
+				Sni:      "example.com",
+				CaFile:   caFile,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"gateway-proxy"}))
+			lock.Lock()
+			Expect(serverName).To(Equal("example.com"))
+			lock.Unlock()
+			Expect(response.Headers.Get("X-Host")).To(Equal("example.com"))
+			Expect(response.PeerCertificates).NotTo(BeEmpty())
+			Expect(response.PeerCertificates[0].DNSNames).To(ContainElement("example.com"))
+			Expect(response.TLSVersion).NotTo(BeZero())
+			// like curl, http/2 is negotiated over tls
+			Expect(response.Proto).To(Equal("HTTP/2.0"))
+			Expect(response.Timings.TLSHandshake).To(BeNumerically(">=", response.Timings.Connect))
+		})
+
+		It("rejects untrusted certificates unless self signed is set", func() {
+			opts := CurlOpts{Protocol: "https", Service: "gateway-proxy", Sni: "example.com"}
+			_, err := executor.Do(ctx, opts)
+			Expect(err).To(HaveOccurred())
+			Expect(strings.ToLower(err.Error())).To(ContainSubstring("certificate"))
+
+			opts.SelfSigned = true
+			response, err := executor.Do(ctx, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.StatusCode).To(Equal(http.StatusTeapot))
+		})
+
+		It("rejects certificates for other names", func() {
+			_, err := executor.Do(ctx, CurlOpts{Protocol: "https", Service: "gateway-proxy", Sni: "other.com", CaFile: caFile})
+			Expect(err).To(MatchError(ContainSubstring("other.com")))
+		})
+	})
+})
+
+var _ = Describe("service host", func() {
+	DescribeTable("resolves the namespace of the service like cluster dns",
+		func(service, expectedName, expectedNamespace string) {
+			name, namespace := splitServiceHost(service, "default-ns", func(namespace string) bool {
+				return namespace == "gloo-system"
+			})
+			Expect(name).To(Equal(expectedName))
+			Expect(namespace).To(Equal(expectedNamespace))
+		},
+		Entry("name only", "gateway-proxy", "gateway-proxy", "default-ns"),
+		Entry("name and namespace", "gateway-proxy.gloo-system", "gateway-proxy", "gloo-system"),
+		Entry("svc suffix", "gateway-proxy.gloo-system.svc", "gateway-proxy", "gloo-system"),
+		Entry("cluster domain", "gateway-proxy.gloo-system.svc.cluster.local", "gateway-proxy", "gloo-system"),
+		Entry("external host", "example.com", "example.com", "default-ns"),
+		Entry("external host with a subdomain", "example.com.au", "example.com.au", "default-ns"),
+	)
+})
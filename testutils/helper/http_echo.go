@@ -2,6 +2,8 @@ package helper
 
 import (
 	"time"
+
+	"github.com/solo-io/k8s-utils/testutils/helper/testserver"
 )
 
 type echoPod struct {
@@ -28,6 +30,19 @@ func NewEchoHttp(namespace string) (*echoPod, error) {
 	}, nil
 }
 
+// NewEchoHttpTestServer deploys the test server image, see NewTestServerBuilder, in place of the http echo, with the
+// same name and port. Its responses describe the request as json, see testserver.EchoResponse.
+func NewEchoHttpTestServer(namespace, image string) (*echoPod, error) {
+	container, err := newTestContainer(namespace, image, HttpEchoName, HttpEchoPort)
+	if err != nil {
+		return nil, err
+	}
+	container.args = testserver.Config{Port: HttpEchoPort}.Args()
+	return &echoPod{
+		testContainer: container,
+	}, nil
+}
+
 const (
 	defaultTcpEchoImage = "soloio/tcp-echo:latest"
 	TcpEchoName         = "tcp-echo"
@@ -3,17 +3,21 @@ package helper
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
 
+	"github.com/onsi/gomega/types"
 	"github.com/pkg/errors"
 	"github.com/solo-io/go-utils/log"
 
 	"github.com/solo-io/go-utils/testutils"
 	"github.com/solo-io/k8s-utils/kubeutils"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 type TestRunner interface {
@@ -28,6 +32,34 @@ type TestRunner interface {
 	Curl(opts CurlOpts) (string, error)
 }
 
+var _ TestRunner = &testRunner{}
+
+// HttpRunner sends the requests of CurlOpts from Go instead of running curl, see HttpExecutor. It is kept apart from
+// TestRunner so that other implementations of TestRunner keep compiling.
+type HttpRunner interface {
+	// Sends the request from Go instead of running curl in the container
+	CurlResponse(ctx context.Context, opts CurlOpts) (*CurlResponse, error)
+	// Checks the structured response of the request
+	CurlEventuallyShouldReturn(opts CurlOpts, matcher types.GomegaMatcher, ginkgoOffset int, timeout ...time.Duration)
+}
+
+var _ HttpRunner = &testRunner{}
+
+// ProbeRunner probes grpc and websocket services from Go. Like HttpRunner, it is kept apart from TestRunner.
+type ProbeRunner interface {
+	GrpcCall(ctx context.Context, opts GrpcOpts) (*GrpcResponse, error)
+	GrpcHealthCheck(ctx context.Context, opts GrpcOpts, service string) (healthpb.HealthCheckResponse_ServingStatus, error)
+	// Checks the response of the unary grpc call
+	GrpcEventuallyShouldRespond(opts GrpcOpts, substr string, ginkgoOffset int, timeout ...time.Duration)
+	// Checks the status reported by the grpc health-check protocol
+	GrpcHealthEventuallyShouldBe(opts GrpcOpts, service string, expected healthpb.HealthCheckResponse_ServingStatus, ginkgoOffset int, timeout ...time.Duration)
+	WebSocketEcho(ctx context.Context, opts WebSocketOpts) (*WebSocketResponse, error)
+	// Checks the message echoed back after the websocket handshake
+	WebSocketEventuallyShouldEcho(opts WebSocketOpts, substr string, ginkgoOffset int, timeout ...time.Duration)
+}
+
+var _ ProbeRunner = &testRunner{}
+
 func newTestContainer(namespace, imageTag, echoName string, port int32) (*testContainer, error) {
 	cfg, err := kubeutils.GetConfig("", "")
 	if err != nil {
@@ -41,6 +73,7 @@ func newTestContainer(namespace, imageTag, echoName string, port int32) (*testCo
 	return &testContainer{
 		namespace: namespace,
 		kube:      kube,
+		cfg:       cfg,
 
 		echoName: echoName,
 		port:     port,
@@ -54,10 +87,16 @@ type testContainer struct {
 	containerPort      uint
 	namespace          string
 	kube               kubernetes.Interface
+	cfg                *rest.Config
 
 	imageTag string
+	// arguments of the container, the image's defaults when empty
+	args     []string
 	echoName string
 	port     int32
+
+	httpExecutorOnce sync.Once
+	httpExecutor     *HttpExecutor
 }
 
 // Deploys the http echo to the kubernetes cluster the kubeconfig is pointing to and waits for the given time for the
@@ -81,6 +120,7 @@ func (t *testContainer) deploy(timeout time.Duration) error {
 					Image:           t.imageTag,
 					ImagePullPolicy: corev1.PullIfNotPresent,
 					Name:            t.echoName,
+					Args:            t.args,
 				},
 			},
 		},
@@ -118,6 +158,9 @@ func (t *testContainer) deploy(timeout time.Duration) error {
 }
 
 func (t *testContainer) Terminate() error {
+	if t.httpExecutor != nil {
+		t.httpExecutor.Close()
+	}
 	if err := testutils.Kubectl("delete", "pod", "-n", t.namespace, t.echoName, "--grace-period=0"); err != nil {
 		return errors.Wrapf(err, "deleting %s pod", t.echoName)
 	}
@@ -0,0 +1,350 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/log"
+	"github.com/solo-io/k8s-utils/certutils"
+	"github.com/solo-io/k8s-utils/kubeutils"
+	"github.com/solo-io/k8s-utils/testutils/helper/testserver"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/cert"
+)
+
+const (
+	testServerTlsDir = "/etc/test-server/tls"
+)
+
+// TestServerBuilder configures a test server, an echo server which runs as a Deployment behind a Service. Its
+// responses describe the request it received, see testserver.EchoResponse.
+type TestServerBuilder struct {
+	name     string
+	image    string
+	replicas int32
+	tls      bool
+	tlsHosts []string
+	cfg      testserver.Config
+}
+
+// NewTestServerBuilder runs the given image, built from testutils/helper/testserver/Dockerfile with
+// `make test-server-image` and pushed to a registry the cluster can pull from.
+func NewTestServerBuilder(name, image string) *TestServerBuilder {
+	return &TestServerBuilder{
+		name:     name,
+		image:    image,
+		replicas: 1,
+		cfg:      testserver.Config{Port: testserver.DefaultPort},
+	}
+}
+
+func (b *TestServerBuilder) WithImage(image string) *TestServerBuilder {
+	b.image = image
+	return b
+}
+
+func (b *TestServerBuilder) WithReplicas(replicas int32) *TestServerBuilder {
+	b.replicas = replicas
+	return b
+}
+
+// WithPort sets the port of the server and of its Service
+func (b *TestServerBuilder) WithPort(port int) *TestServerBuilder {
+	b.cfg.Port = port
+	return b
+}
+
+// WithHttp2 serves HTTP/2 next to HTTP/1.1. Without tls, HTTP/2 is served as h2c with prior knowledge.
+func (b *TestServerBuilder) WithHttp2() *TestServerBuilder {
+	b.cfg.Http2 = true
+	return b
+}
+
+// WithTls serves tls with a certificate generated with certutils. The certificate is valid for the service name
+// and the given extra hosts, e.g. the sni names the tests send. See CaCertificate.
+func (b *TestServerBuilder) WithTls(extraHosts ...string) *TestServerBuilder {
+	b.tls = true
+	b.tlsHosts = append(b.tlsHosts, extraHosts...)
+	return b
+}
+
+func (b *TestServerBuilder) WithStatus(status int) *TestServerBuilder {
+	b.cfg.Status = status
+	return b
+}
+
+func (b *TestServerBuilder) WithHeader(name, value string) *TestServerBuilder {
+	if b.cfg.Headers == nil {
+		b.cfg.Headers = map[string]string{}
+	}
+	b.cfg.Headers[name] = value
+	return b
+}
+
+func (b *TestServerBuilder) WithDelay(delay time.Duration) *TestServerBuilder {
+	b.cfg.Delay = delay
+	return b
+}
+
+// WithFailures fails the given share of the requests, between 0 and 1, with the given status code. When the status
+// is zero, the connection is aborted instead.
+func (b *TestServerBuilder) WithFailures(rate float64, status int) *TestServerBuilder {
+	b.cfg.FailureRate = rate
+	b.cfg.FailureStatus = status
+	return b
+}
+
+// Build returns the test server for the namespace, which is created on Deploy
+func (b *TestServerBuilder) Build(namespace string) (*testServer, error) {
+	cfg, err := kubeutils.GetConfig("", "")
+	if err != nil {
+		return nil, err
+	}
+	kube, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return b.build(namespace, kube)
+}
+
+func (b *TestServerBuilder) build(namespace string, kube kubernetes.Interface) (*testServer, error) {
+	serverCfg := b.cfg
+	// copied so that the builder can be reused
+	serverCfg.Headers = map[string]string{}
+	for k, v := range b.cfg.Headers {
+		serverCfg.Headers[k] = v
+	}
+	if b.tls {
+		serverCfg.TlsCertFile = testServerTlsDir + "/" + corev1.TLSCertKey
+		serverCfg.TlsKeyFile = testServerTlsDir + "/" + corev1.TLSPrivateKeyKey
+	}
+	if err := serverCfg.Validate(); err != nil {
+		return nil, err
+	}
+	if b.image == "" {
+		return nil, errors.Errorf("no image set for test server %s", b.name)
+	}
+	return &testServer{
+		namespace: namespace,
+		kube:      kube,
+		name:      b.name,
+		image:     b.image,
+		replicas:  b.replicas,
+		tlsHosts:  append([]string{}, b.tlsHosts...),
+		cfg:       serverCfg,
+	}, nil
+}
+
+// This object represents a test server deployed to the cluster.
+type testServer struct {
+	namespace string
+	kube      kubernetes.Interface
+
+	name     string
+	image    string
+	replicas int32
+	tlsHosts []string
+	cfg      testserver.Config
+
+	caCertificate []byte
+}
+
+func (t *testServer) Name() string {
+	return t.name
+}
+
+func (t *testServer) Port() int {
+	return t.cfg.Port
+}
+
+// CaCertificate returns the PEM-encoded CA of the serving certificate, once deployed with tls
+func (t *testServer) CaCertificate() []byte {
+	return t.caCertificate
+}
+
+func (t *testServer) labels() map[string]string {
+	return map[string]string{"gloo": t.name}
+}
+
+// Deploy creates the Deployment and Service of the test server and waits for the given time for all replicas to
+// be available.
+func (t *testServer) Deploy(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if t.cfg.TlsCertFile != "" {
+		secret, err := t.tlsSecret()
+		if err != nil {
+			return err
+		}
+		if _, err := t.kube.CoreV1().Secrets(t.namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+	if _, err := t.kube.AppsV1().Deployments(t.namespace).Create(ctx, t.deployment(), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	if _, err := t.kube.CoreV1().Services(t.namespace).Create(ctx, t.service(), metav1.CreateOptions{}); err != nil {
+		return err
+	}
+
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		deployment, err := t.kube.AppsV1().Deployments(t.namespace).Get(ctx, t.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.AvailableReplicas >= t.replicas, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "waiting for test server %s to be available", t.name)
+	}
+	log.Printf("deployed %s", t.name)
+	return nil
+}
+
+func (t *testServer) tlsSecret() (*corev1.Secret, error) {
+	hosts := append([]string{
+		t.name,
+		fmt.Sprintf("%s.%s", t.name, t.namespace),
+		fmt.Sprintf("%s.%s.svc", t.name, t.namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", t.name, t.namespace),
+	}, t.tlsHosts...)
+	certs, err := certutils.GenerateSelfSignedCertificate(cert.Config{
+		CommonName: t.name,
+		AltNames:   cert.AltNames{DNSNames: hosts},
+		Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.caCertificate = certs.CaCertificate
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: t.name + "-tls", Namespace: t.namespace, Labels: t.labels()},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certs.ServerCertificate,
+			corev1.TLSPrivateKeyKey: certs.ServerCertKey,
+		},
+	}, nil
+}
+
+func (t *testServer) deployment() *appsv1.Deployment {
+	zero := int64(0)
+	replicas := t.replicas
+	container := corev1.Container{
+		Name:            "test-server",
+		Image:           t.image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            t.cfg.Args(),
+		Ports:           []corev1.ContainerPort{{Name: "http", ContainerPort: int32(t.cfg.Port)}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(int32(t.cfg.Port))},
+			},
+			PeriodSeconds: 1,
+		},
+	}
+	podSpec := corev1.PodSpec{
+		TerminationGracePeriodSeconds: &zero,
+		Containers:                    []corev1.Container{container},
+	}
+	if t.cfg.TlsCertFile != "" {
+		podSpec.Volumes = []corev1.Volume{{
+			Name:         "tls",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: t.name + "-tls"}},
+		}}
+		podSpec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "tls", MountPath: testServerTlsDir, ReadOnly: true}}
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: t.name, Namespace: t.namespace, Labels: t.labels()},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: t.labels()},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: t.labels()},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+func (t *testServer) service() *corev1.Service {
+	portName := "http"
+	if t.cfg.TlsCertFile != "" {
+		portName = "https"
+	}
+	var appProtocol *string
+	if t.cfg.Http2 && t.cfg.TlsCertFile == "" {
+		// lets proxies in front of the service know that they can send h2c, with tls it is negotiated with alpn
+		protocol := "kubernetes.io/h2c"
+		appProtocol = &protocol
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: t.name, Namespace: t.namespace, Labels: t.labels()},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name:        portName,
+				Protocol:    corev1.ProtocolTCP,
+				Port:        int32(t.cfg.Port),
+				TargetPort:  intstr.FromInt32(int32(t.cfg.Port)),
+				AppProtocol: appProtocol,
+			}},
+			Selector: t.labels(),
+		},
+	}
+}
+
+// AccessLog returns the requests served by all replicas, in the order they were received
+func (t *testServer) AccessLog(ctx context.Context) ([]testserver.AccessLogEntry, error) {
+	pods, err := t.kube.CoreV1().Pods(t.namespace).List(ctx, metav1.ListOptions{LabelSelector: "gloo=" + t.name})
+	if err != nil {
+		return nil, err
+	}
+	var entries []testserver.AccessLogEntry
+	for _, pod := range pods.Items {
+		logs, err := t.kube.CoreV1().Pods(t.namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading logs of %s", pod.Name)
+		}
+		podEntries, err := testserver.ParseAccessLog(bytes.NewReader(logs))
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing access log of %s", pod.Name)
+		}
+		entries = append(entries, podEntries...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries, nil
+}
+
+// Terminate deletes the resources of the test server
+func (t *testServer) Terminate() error {
+	ctx := context.Background()
+	zero := int64(0)
+	deleteOptions := metav1.DeleteOptions{GracePeriodSeconds: &zero}
+	if err := t.kube.AppsV1().Deployments(t.namespace).Delete(ctx, t.name, deleteOptions); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting %s deployment", t.name)
+	}
+	if err := t.kube.CoreV1().Services(t.namespace).Delete(ctx, t.name, deleteOptions); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "deleting %s service", t.name)
+	}
+	if t.cfg.TlsCertFile != "" {
+		if err := t.kube.CoreV1().Secrets(t.namespace).Delete(ctx, t.name+"-tls", deleteOptions); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "deleting %s secret", t.name+"-tls")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package helper
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/helper/testserver"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("test server builder", func() {
+	const testServerImage = "test-server:dev"
+	var kube *fake.Clientset
+
+	BeforeEach(func() {
+		kube = fake.NewClientset()
+		// the fake deployment controller: deployments are available as soon as they are created
+		kube.PrependReactor("create", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			deployment := action.(k8stesting.CreateAction).GetObject().(*appsv1.Deployment)
+			deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+			return false, nil, nil
+		})
+	})
+
+	It("deploys replicas behind a service", func() {
+		server, err := NewTestServerBuilder("echo", testServerImage).
+			WithReplicas(3).
+			WithPort(9090).
+			WithHttp2().
+			WithStatus(http.StatusAccepted).
+			WithHeader("X-Test", "value").
+			WithDelay(time.Second).
+			WithFailures(0.5, http.StatusServiceUnavailable).
+			build("test-ns", kube)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Deploy(time.Second)).NotTo(HaveOccurred())
+
+		deployment, err := kube.AppsV1().Deployments("test-ns").Get(context.Background(), "echo", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*deployment.Spec.Replicas).To(BeEquivalentTo(3))
+		container := deployment.Spec.Template.Spec.Containers[0]
+		Expect(container.Image).To(Equal(testServerImage))
+		cfg, err := testserver.ParseArgs(container.Args)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg).To(Equal(testserver.Config{
+			Port:          9090,
+			Http2:         true,
+			Status:        http.StatusAccepted,
+			Headers:       map[string]string{"X-Test": "value"},
+			Delay:         time.Second,
+			FailureRate:   0.5,
+			FailureStatus: http.StatusServiceUnavailable,
+		}))
+
+		service, err := kube.CoreV1().Services("test-ns").Get(context.Background(), "echo", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(service.Spec.Selector).To(Equal(deployment.Spec.Template.Labels))
+		Expect(service.Spec.Ports[0].Port).To(BeEquivalentTo(9090))
+		Expect(*service.Spec.Ports[0].AppProtocol).To(Equal("kubernetes.io/h2c"))
+
+		Expect(server.Terminate()).NotTo(HaveOccurred())
+		deployments, err := kube.AppsV1().Deployments("test-ns").List(context.Background(), metav1.ListOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployments.Items).To(BeEmpty())
+	})
+
+	It("serves tls with a generated certificate", func() {
+		server, err := NewTestServerBuilder("echo", testServerImage).WithTls("example.com").build("test-ns", kube)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Deploy(time.Second)).NotTo(HaveOccurred())
+
+		secret, err := kube.CoreV1().Secrets("test-ns").Get(context.Background(), "echo-tls", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(certificate.DNSNames).To(ContainElements("echo.test-ns.svc.cluster.local", "example.com"))
+		roots := x509.NewCertPool()
+		Expect(roots.AppendCertsFromPEM(server.CaCertificate())).To(BeTrue())
+		_, err = certificate.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"})
+		Expect(err).NotTo(HaveOccurred())
+
+		deployment, err := kube.AppsV1().Deployments("test-ns").Get(context.Background(), "echo", metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployment.Spec.Template.Spec.Volumes[0].Secret.SecretName).To(Equal("echo-tls"))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Args).To(ContainElement("--tls-cert=" + testServerTlsDir + "/tls.crt"))
+
+		Expect(server.Terminate()).NotTo(HaveOccurred())
+		_, err = kube.CoreV1().Secrets("test-ns").Get(context.Background(), "echo-tls", metav1.GetOptions{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,118 @@
+package testserver
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultPort = 8080
+	// the access log written to stdout starts every entry with this prefix, to tell it apart from other output
+	AccessLogPrefix = "access: "
+)
+
+// Config of the test server. It is passed to the server process as command line arguments, see Args.
+type Config struct {
+	Port int
+	// Serve HTTP/2 next to HTTP/1.1. Without tls, HTTP/2 is served as h2c with prior knowledge.
+	Http2 bool
+	// Serve tls with the certificate and key in these files
+	TlsCertFile string
+	TlsKeyFile  string
+
+	// Status code of the responses, 200 when zero
+	Status int
+	// Headers added to the responses
+	Headers map[string]string
+	// Delay before responding
+	Delay time.Duration
+
+	// Share of the requests, between 0 and 1, which fail
+	FailureRate float64
+	// Status code of the failed requests. When zero, the connection is aborted instead.
+	FailureStatus int
+}
+
+// Args returns the command line arguments which ParseArgs turns back into this config
+func (c Config) Args() []string {
+	var args []string
+	if c.Port != 0 {
+		args = append(args, fmt.Sprintf("--port=%d", c.Port))
+	}
+	if c.Http2 {
+		args = append(args, "--http2")
+	}
+	if c.TlsCertFile != "" {
+		args = append(args, "--tls-cert="+c.TlsCertFile, "--tls-key="+c.TlsKeyFile)
+	}
+	if c.Status != 0 {
+		args = append(args, fmt.Sprintf("--status=%d", c.Status))
+	}
+	var headers []string
+	for k, v := range c.Headers {
+		headers = append(headers, "--header="+k+": "+v)
+	}
+	sort.Strings(headers)
+	args = append(args, headers...)
+	if c.Delay != 0 {
+		args = append(args, "--delay="+c.Delay.String())
+	}
+	if c.FailureRate != 0 {
+		args = append(args, fmt.Sprintf("--failure-rate=%v", c.FailureRate))
+		args = append(args, fmt.Sprintf("--failure-status=%d", c.FailureStatus))
+	}
+	return args
+}
+
+// ParseArgs parses the command line arguments of the server
+func ParseArgs(args []string) (Config, error) {
+	c := Config{}
+	headers := headerFlag{}
+	flags := flag.NewFlagSet("test-server", flag.ContinueOnError)
+	flags.IntVar(&c.Port, "port", DefaultPort, "port to listen on")
+	flags.BoolVar(&c.Http2, "http2", false, "serve HTTP/2")
+	flags.StringVar(&c.TlsCertFile, "tls-cert", "", "tls certificate file")
+	flags.StringVar(&c.TlsKeyFile, "tls-key", "", "tls key file")
+	flags.IntVar(&c.Status, "status", 0, "status code of the responses")
+	flags.Var(headers, "header", "header added to the responses, as 'name: value'. Can be repeated.")
+	flags.DurationVar(&c.Delay, "delay", 0, "delay before responding")
+	flags.Float64Var(&c.FailureRate, "failure-rate", 0, "share of the requests which fail, between 0 and 1")
+	flags.IntVar(&c.FailureStatus, "failure-status", 0, "status code of failed requests, or 0 to abort the connection")
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if len(headers) > 0 {
+		c.Headers = headers
+	}
+	return c, c.Validate()
+}
+
+func (c Config) Validate() error {
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return errors.Errorf("failure rate %v is not between 0 and 1", c.FailureRate)
+	}
+	if (c.TlsCertFile == "") != (c.TlsKeyFile == "") {
+		return errors.Errorf("tls needs both a certificate and a key file")
+	}
+	return nil
+}
+
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+func (h headerFlag) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return errors.Errorf("header %q is not formatted as 'name: value'", value)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
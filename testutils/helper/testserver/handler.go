@@ -0,0 +1,148 @@
+package testserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EchoResponse is the body of the responses of the test server, describing the request it received
+type EchoResponse struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Host    string              `json:"host"`
+	Proto   string              `json:"proto"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body,omitempty"`
+	// the sni name of tls requests
+	ServerName string `json:"serverName,omitempty"`
+	// the pod which served the request
+	Hostname string `json:"hostname"`
+}
+
+type AccessLogEntry struct {
+	Time       time.Time     `json:"time"`
+	Method     string        `json:"method"`
+	Path       string        `json:"path"`
+	Host       string        `json:"host"`
+	Proto      string        `json:"proto"`
+	RemoteAddr string        `json:"remoteAddr"`
+	Status     int           `json:"status"`
+	Duration   time.Duration `json:"duration"`
+	// the failure was injected, Status is zero when the connection was aborted
+	InjectedFailure bool   `json:"injectedFailure,omitempty"`
+	Hostname        string `json:"hostname"`
+}
+
+type handler struct {
+	cfg      Config
+	hostname string
+
+	lock      sync.Mutex
+	accessLog io.Writer
+}
+
+// NewHandler returns the handler of the test server. Every request is written to the access log.
+func NewHandler(cfg Config, accessLog io.Writer) http.Handler {
+	hostname, _ := os.Hostname()
+	return &handler{cfg: cfg, hostname: hostname, accessLog: accessLog}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	entry := AccessLogEntry{
+		Time:       start,
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Host:       r.Host,
+		Proto:      r.Proto,
+		RemoteAddr: r.RemoteAddr,
+		Hostname:   h.hostname,
+	}
+
+	if h.cfg.Delay > 0 {
+		select {
+		case <-time.After(h.cfg.Delay):
+		case <-r.Context().Done():
+			// the client went away, there is no one to respond to
+			h.log(entry, start)
+			return
+		}
+	}
+
+	if h.cfg.FailureRate > 0 && rand.Float64() < h.cfg.FailureRate {
+		entry.InjectedFailure = true
+		if h.cfg.FailureStatus == 0 {
+			h.log(entry, start)
+			// net/http closes the connection without a response
+			panic(http.ErrAbortHandler)
+		}
+		entry.Status = h.cfg.FailureStatus
+		w.WriteHeader(h.cfg.FailureStatus)
+		h.log(entry, start)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	response := EchoResponse{
+		Method:   r.Method,
+		Path:     r.URL.RequestURI(),
+		Host:     r.Host,
+		Proto:    r.Proto,
+		Headers:  r.Header,
+		Body:     string(body),
+		Hostname: h.hostname,
+	}
+	if r.TLS != nil {
+		response.ServerName = r.TLS.ServerName
+	}
+	for k, v := range h.cfg.Headers {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	entry.Status = h.cfg.Status
+	if entry.Status == 0 {
+		entry.Status = http.StatusOK
+	}
+	w.WriteHeader(entry.Status)
+	_ = json.NewEncoder(w).Encode(response)
+	h.log(entry, start)
+}
+
+func (h *handler) log(entry AccessLogEntry, start time.Time) {
+	if h.accessLog == nil {
+		return
+	}
+	entry.Duration = time.Since(start)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	_, _ = io.WriteString(h.accessLog, AccessLogPrefix+string(b)+"\n")
+}
+
+// ParseAccessLog returns the access log entries in the output of the server, ignoring other lines
+func ParseAccessLog(r io.Reader) ([]AccessLogEntry, error) {
+	var entries []AccessLogEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, ok := strings.CutPrefix(scanner.Text(), AccessLogPrefix)
+		if !ok {
+			continue
+		}
+		entry := AccessLogEntry{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
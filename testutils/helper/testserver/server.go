@@ -0,0 +1,58 @@
+package testserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// NewServer returns the http server for the config, which serves HTTP/1.1 and, when enabled, HTTP/2
+func NewServer(cfg Config, accessLog io.Writer) *http.Server {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	if cfg.Http2 {
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return &http.Server{
+		Addr:      fmt.Sprintf(":%d", port),
+		Handler:   NewHandler(cfg, accessLog),
+		Protocols: protocols,
+	}
+}
+
+// Serve serves on the given listener until ctx is done
+func Serve(ctx context.Context, cfg Config, listener net.Listener, accessLog io.Writer) error {
+	server := NewServer(cfg, accessLog)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	var err error
+	if cfg.TlsCertFile != "" {
+		err = server.ServeTLS(listener, cfg.TlsCertFile, cfg.TlsKeyFile)
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenAndServe listens on the port of the config and serves until ctx is done
+func ListenAndServe(ctx context.Context, cfg Config, accessLog io.Writer) error {
+	server := NewServer(cfg, accessLog)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+	return Serve(ctx, cfg, listener, accessLog)
+}
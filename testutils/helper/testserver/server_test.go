@@ -0,0 +1,204 @@
+package testserver_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/certutils"
+	. "github.com/solo-io/k8s-utils/testutils/helper/testserver"
+	"k8s.io/client-go/util/cert"
+)
+
+// synchronized, the handler writes the access log from the server goroutines
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) entries() []AccessLogEntry {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	entries, err := ParseAccessLog(bytes.NewReader(b.buf.Bytes()))
+	Expect(err).NotTo(HaveOccurred())
+	return entries
+}
+
+var _ = Describe("test server", func() {
+	var accessLog *syncBuffer
+
+	BeforeEach(func() {
+		accessLog = &syncBuffer{}
+	})
+
+	It("round-trips the config through command line arguments", func() {
+		cfg := Config{
+			Port:          9090,
+			Http2:         true,
+			TlsCertFile:   "/tls/tls.crt",
+			TlsKeyFile:    "/tls/tls.key",
+			Status:        http.StatusAccepted,
+			Headers:       map[string]string{"X-A": "a", "X-B": "b: c"},
+			Delay:         1500 * time.Millisecond,
+			FailureRate:   0.25,
+			FailureStatus: http.StatusServiceUnavailable,
+		}
+		parsed, err := ParseArgs(cfg.Args())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(cfg))
+
+		parsed, err = ParseArgs(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(Config{Port: DefaultPort}))
+
+		_, err = ParseArgs([]string{"--failure-rate=2"})
+		Expect(err).To(MatchError(ContainSubstring("not between 0 and 1")))
+	})
+
+	It("echoes requests with the configured response", func() {
+		server := httptest.NewServer(NewHandler(Config{
+			Status:  http.StatusCreated,
+			Headers: map[string]string{"X-Test": "value"},
+		}, accessLog))
+		defer server.Close()
+
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/echo?q=1", strings.NewReader("hello"))
+		Expect(err).NotTo(HaveOccurred())
+		request.Host = "example.com"
+		response, err := http.DefaultClient.Do(request)
+		Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusCreated))
+		Expect(response.Header.Get("X-Test")).To(Equal("value"))
+		echo := EchoResponse{}
+		Expect(json.NewDecoder(response.Body).Decode(&echo)).NotTo(HaveOccurred())
+		Expect(echo.Method).To(Equal(http.MethodPost))
+		Expect(echo.Path).To(Equal("/echo?q=1"))
+		Expect(echo.Host).To(Equal("example.com"))
+		Expect(echo.Body).To(Equal("hello"))
+
+		entries := accessLog.entries()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Method).To(Equal(http.MethodPost))
+		Expect(entries[0].Path).To(Equal("/echo?q=1"))
+		Expect(entries[0].Host).To(Equal("example.com"))
+		Expect(entries[0].Status).To(Equal(http.StatusCreated))
+		Expect(entries[0].InjectedFailure).To(BeFalse())
+	})
+
+	It("delays responses", func() {
+		server := httptest.NewServer(NewHandler(Config{Delay: 200 * time.Millisecond}, accessLog))
+		defer server.Close()
+		start := time.Now()
+		response, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		response.Body.Close()
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+		Expect(accessLog.entries()[0].Duration).To(BeNumerically(">=", 200*time.Millisecond))
+	})
+
+	It("injects failures", func() {
+		server := httptest.NewServer(NewHandler(Config{FailureRate: 1, FailureStatus: http.StatusBadGateway}, accessLog))
+		response, err := http.Get(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+		response.Body.Close()
+		Expect(response.StatusCode).To(Equal(http.StatusBadGateway))
+		server.Close()
+
+		server = httptest.NewServer(NewHandler(Config{FailureRate: 1}, accessLog))
+		defer server.Close()
+		_, err = http.Get(server.URL)
+		Expect(err).To(HaveOccurred())
+
+		entries := accessLog.entries()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].InjectedFailure).To(BeTrue())
+		Expect(entries[0].Status).To(Equal(http.StatusBadGateway))
+		Expect(entries[1].InjectedFailure).To(BeTrue())
+		Expect(entries[1].Status).To(BeZero())
+	})
+
+	Context("serving", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+			done   chan error
+		)
+
+		serve := func(cfg Config) string {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			done = make(chan error, 1)
+			go func() {
+				done <- Serve(ctx, cfg, listener, accessLog)
+			}()
+			return listener.Addr().String()
+		}
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+		})
+
+		AfterEach(func() {
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+		})
+
+		It("serves h2c", func() {
+			address := serve(Config{Http2: true})
+			protocols := &http.Protocols{}
+			protocols.SetUnencryptedHTTP2(true)
+			client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+			response, err := client.Get("http://" + address)
+			Expect(err).NotTo(HaveOccurred())
+			response.Body.Close()
+			Expect(response.Proto).To(Equal("HTTP/2.0"))
+		})
+
+		It("serves tls with certutils certificates", func() {
+			certs, err := certutils.GenerateSelfSignedCertificate(cert.Config{
+				CommonName: "test-server",
+				AltNames:   cert.AltNames{DNSNames: []string{"test-server.default"}},
+				Usages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			dir := GinkgoT().TempDir()
+			cfg := Config{Http2: true, TlsCertFile: filepath.Join(dir, "tls.crt"), TlsKeyFile: filepath.Join(dir, "tls.key")}
+			Expect(os.WriteFile(cfg.TlsCertFile, certs.ServerCertificate, 0600)).NotTo(HaveOccurred())
+			Expect(os.WriteFile(cfg.TlsKeyFile, certs.ServerCertKey, 0600)).NotTo(HaveOccurred())
+			address := serve(cfg)
+
+			roots := x509.NewCertPool()
+			Expect(roots.AppendCertsFromPEM(certs.CaCertificate)).To(BeTrue())
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{RootCAs: roots, ServerName: "test-server.default"},
+				ForceAttemptHTTP2: true,
+			}}
+			response, err := client.Get("https://" + address)
+			Expect(err).NotTo(HaveOccurred())
+			defer response.Body.Close()
+			Expect(response.Proto).To(Equal("HTTP/2.0"))
+			echo := EchoResponse{}
+			Expect(json.NewDecoder(response.Body).Decode(&echo)).NotTo(HaveOccurred())
+			Expect(echo.ServerName).To(Equal("test-server.default"))
+		})
+	})
+})
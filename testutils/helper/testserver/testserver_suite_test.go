@@ -0,0 +1,13 @@
+package testserver_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestTestserver(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Testserver Suite")
+}
@@ -0,0 +1,154 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/solo-io/go-utils/log"
+)
+
+type WebSocketOpts struct {
+	// defaults to test-ingress
+	Service string
+	// defaults to 8080
+	Port int
+	Path string
+	// Optional Host header
+	Host string
+	// Tls connects with wss. Sni, CaFile and SelfSigned behave like they do in CurlOpts.
+	Tls        bool
+	Sni        string
+	CaFile     string
+	SelfSigned bool
+	Headers    map[string]string
+	// Optional subprotocols to offer during the handshake
+	Subprotocols []string
+	// The text message sent after the handshake. The first message received in return is the reply.
+	Message string
+	// Optional timeout of the handshake and of the round-trip, each
+	Timeout time.Duration
+}
+
+type WebSocketResponse struct {
+	// status code and headers of the handshake response
+	StatusCode  int
+	Headers     http.Header
+	Subprotocol string
+	Reply       string
+	RoundTrip   time.Duration
+}
+
+func (o WebSocketOpts) url(target curlTarget) string {
+	scheme, host := "ws", target.service
+	if o.Tls {
+		scheme = "wss"
+	}
+	if o.Sni != "" {
+		host = o.Sni
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(host, strconv.Itoa(target.port)), o.Path)
+}
+
+// WebSocketEcho does the websocket handshake, sends opts.Message and waits for one message in return
+func (e *HttpExecutor) WebSocketEcho(ctx context.Context, opts WebSocketOpts) (*WebSocketResponse, error) {
+	target := curlTargetFor(CurlOpts{Service: opts.Service, Port: opts.Port})
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: opts.Timeout,
+		Subprotocols:     opts.Subprotocols,
+		NetDialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			address, err := e.dial(ctx, target.service, target.port)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, address)
+			if err != nil {
+				e.resetForward(target.service, target.port)
+			}
+			return conn, err
+		},
+	}
+	if opts.Tls {
+		tlsConfig, err := e.tlsConfig(ctx, opts.CaFile, opts.SelfSigned)
+		if err != nil {
+			return nil, err
+		}
+		dialer.TLSClientConfig = tlsConfig
+	}
+	header := http.Header{}
+	for h, v := range opts.Headers {
+		header.Set(h, v)
+	}
+	if opts.Host != "" {
+		header.Set("Host", opts.Host)
+	}
+
+	url := opts.url(target)
+	log.Printf("websocket: %s", url)
+	conn, handshake, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if handshake != nil {
+			return nil, errors.Wrapf(err, "websocket handshake with %s returned %d", url, handshake.StatusCode)
+		}
+		return nil, errors.Wrapf(err, "websocket handshake with %s", url)
+	}
+	defer conn.Close()
+	response := &WebSocketResponse{
+		StatusCode:  handshake.StatusCode,
+		Headers:     handshake.Header,
+		Subprotocol: conn.Subprotocol(),
+	}
+
+	deadline := time.Time{}
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetWriteDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(opts.Message)); err != nil {
+		return nil, errors.Wrapf(err, "sending websocket message")
+	}
+	_, reply, err := conn.ReadMessage()
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading websocket reply")
+	}
+	response.RoundTrip = time.Since(start)
+	response.Reply = string(reply)
+	// a clean close is best effort, the connection is closed either way
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	return response, nil
+}
+
+// WebSocketEcho does a websocket round-trip from Go through a port-forward to the service
+func (t *testContainer) WebSocketEcho(ctx context.Context, opts WebSocketOpts) (*WebSocketResponse, error) {
+	return t.executor().WebSocketEcho(ctx, opts)
+}
+
+// WebSocketEventuallyShouldEcho checks that the reply to opts.Message eventually contains substr
+func (t *testContainer) WebSocketEventuallyShouldEcho(opts WebSocketOpts, substr string, ginkgoOffset int, timeout ...time.Duration) {
+	currentTimeout, pollingInterval := getTimeouts(timeout...)
+	deadline := time.Now().Add(currentTimeout)
+	gomega.EventuallyWithOffset(ginkgoOffset+1, func() string {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		response, err := t.WebSocketEcho(ctx, opts)
+		if err != nil {
+			return err.Error()
+		}
+		return response.Reply
+	}, currentTimeout, pollingInterval).Should(gomega.ContainSubstring(substr))
+}
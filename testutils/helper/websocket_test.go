@@ -0,0 +1,73 @@
+package helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("websocket probes", func() {
+	var (
+		ctx      context.Context
+		server   *httptest.Server
+		executor *HttpExecutor
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		upgrader := websocket.Upgrader{Subprotocols: []string{"echo"}}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/ws" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			conn, err := upgrader.Upgrade(w, r, http.Header{"X-Host": []string{r.Host}})
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, append([]byte("echo: "), message...))
+		}))
+		executor = &HttpExecutor{
+			dial: func(_ context.Context, service string, port int) (string, error) {
+				return server.Listener.Addr().String(), nil
+			},
+			forwards: map[string]portForward{},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("does a round-trip", func() {
+		response, err := executor.WebSocketEcho(ctx, WebSocketOpts{
+			Service:      "gateway-proxy",
+			Port:         80,
+			Path:         "/ws",
+			Host:         "example.com",
+			Subprotocols: []string{"echo"},
+			Message:      "hello",
+			Timeout:      5 * time.Second,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(response.Headers.Get("X-Host")).To(Equal("example.com"))
+		Expect(response.Subprotocol).To(Equal("echo"))
+		Expect(response.Reply).To(Equal("echo: hello"))
+	})
+
+	It("reports failed handshakes", func() {
+		_, err := executor.WebSocketEcho(ctx, WebSocketOpts{Path: "/missing", Message: "hello"})
+		Expect(err).To(MatchError(ContainSubstring("returned 404")))
+	})
+})
@@ -7,7 +7,6 @@ import (
 
 	. "github.com/onsi/gomega"
 	"github.com/solo-io/k8s-utils/kubeutils"
-	kubev1 "k8s.io/api/core/v1"
 	apiexts "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -16,16 +15,14 @@ import (
 )
 
 func WaitForServicesInNamespaceTeardown(ctx context.Context, ns string) {
-	EventuallyWithOffset(1, func() []kubev1.Service {
-		svcs, err := MustKubeClient().CoreV1().Services(ns).List(ctx, v1.ListOptions{})
-		if err != nil {
-			// namespace is gone
-			return []kubev1.Service{}
-		}
-		return svcs.Items
-	}, time.Second*30).Should(BeEmpty())
+	err := WaitFor(ctx, ServiceResourceClient(MustKubeClient(), ns), Deleted(), WaitOptions{
+		Timeout:     time.Second * 30,
+		Description: "services in namespace " + ns,
+	})
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
 }
 
+// TeardownClusterResourcesWithPrefix only deletes a few kinds of cluster scoped resources, Teardown covers all of them
 func TeardownClusterResourcesWithPrefix(ctx context.Context, kube kubernetes.Interface, prefix string) {
 	clusterroles, err := kube.RbacV1beta1().ClusterRoles().List(ctx, metav1.ListOptions{})
 	if err == nil {
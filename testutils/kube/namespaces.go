@@ -0,0 +1,239 @@
+package kube
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	kubev1 "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// label with the id of the test run which created a namespace
+	NamespaceRunIDLabel = "testutils.solo.io/run-id"
+	// label with the number of seconds after its creation a namespace expires
+	NamespaceTTLLabel = "testutils.solo.io/ttl-seconds"
+
+	// environment variable to share a run id between processes, e.g. the parallel ginkgo nodes of a suite
+	RunIDEnv = "TEST_RUN_ID"
+
+	DefaultNamespaceTTL = 2 * time.Hour
+
+	// longest valid namespace name
+	maxNamespaceLength = 63
+	randomSuffixLength = 5
+)
+
+// NamespaceManager creates uniquely named namespaces labelled with the id of the test run and a TTL, and deletes
+// them at the end of the test. Namespaces which are leaked by crashed runs are deleted by DeleteExpiredNamespaces.
+type NamespaceManager struct {
+	kube  kubernetes.Interface
+	runId string
+	ttl   time.Duration
+
+	lock       sync.Mutex
+	namespaces map[string]bool
+}
+
+// NewNamespaceManager uses DefaultRunID when runId is empty and DefaultNamespaceTTL when ttl is zero. The run id is
+// used as a label value, and must be a valid one.
+func NewNamespaceManager(kube kubernetes.Interface, runId string, ttl time.Duration) (*NamespaceManager, error) {
+	if runId == "" {
+		runId = DefaultRunID()
+	}
+	if errs := validation.IsValidLabelValue(runId); len(errs) > 0 {
+		return nil, eris.Errorf("invalid test run id %q: %s", runId, strings.Join(errs, "; "))
+	}
+	if ttl == 0 {
+		ttl = DefaultNamespaceTTL
+	}
+	return &NamespaceManager{
+		kube:       kube,
+		runId:      runId,
+		ttl:        ttl,
+		namespaces: map[string]bool{},
+	}, nil
+}
+
+func MustNewNamespaceManager(kube kubernetes.Interface, runId string, ttl time.Duration) *NamespaceManager {
+	manager, err := NewNamespaceManager(kube, runId, ttl)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return manager
+}
+
+// DefaultRunID returns the value of RunIDEnv, or a random id. The value of RunIDEnv is not validated here, see
+// NewNamespaceManager.
+func DefaultRunID() string {
+	if runId := os.Getenv(RunIDEnv); runId != "" {
+		return runId
+	}
+	return rand.String(10)
+}
+
+func (m *NamespaceManager) RunID() string {
+	return m.runId
+}
+
+// Namespaces returns the namespaces created by the manager which were not deleted yet
+func (m *NamespaceManager) Namespaces() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var namespaces []string
+	for ns := range m.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// Create creates a namespace named after the prefix with a random suffix. The prefix is lowercased, and characters
+// which are not allowed in a namespace name are replaced with '-'.
+func (m *NamespaceManager) Create(ctx context.Context, prefix string) (string, error) {
+	name, err := namespaceName(prefix)
+	if err != nil {
+		return "", err
+	}
+	_, err = m.kube.CoreV1().Namespaces().Create(ctx, &kubev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				NamespaceRunIDLabel: m.runId,
+				NamespaceTTLLabel:   strconv.Itoa(int(m.ttl.Seconds())),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return "", eris.Wrapf(err, "creating namespace %s", name)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.namespaces[name] = true
+	return name, nil
+}
+
+func namespaceName(prefix string) (string, error) {
+	sanitized := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(prefix))
+	if maxPrefix := maxNamespaceLength - randomSuffixLength - 1; len(sanitized) > maxPrefix {
+		sanitized = sanitized[:maxPrefix]
+	}
+	sanitized = strings.TrimLeft(sanitized, "-")
+	if sanitized == "" {
+		return "", eris.Errorf("namespace prefix %q has no valid characters", prefix)
+	}
+	name := sanitized + "-" + rand.String(randomSuffixLength)
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return "", eris.Errorf("invalid namespace name %q for prefix %q: %s", name, prefix, strings.Join(errs, "; "))
+	}
+	return name, nil
+}
+
+func (m *NamespaceManager) MustCreate(ctx context.Context, prefix string) string {
+	name, err := m.Create(ctx, prefix)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	return name
+}
+
+// CreateForSpec creates a namespace which is deleted when the current ginkgo node finishes. Called in a BeforeEach or
+// It that is after the spec, in a BeforeAll after the ordered container and in a BeforeSuite after the suite.
+func (m *NamespaceManager) CreateForSpec(ctx context.Context, prefix string) string {
+	name, err := m.Create(ctx, prefix)
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
+	ginkgo.DeferCleanup(func(ctx context.Context) error {
+		return m.Delete(ctx, name)
+	}, ginkgo.NodeTimeout(time.Minute))
+	return name
+}
+
+// CreateForTest creates a namespace which is deleted when the test finishes
+func (m *NamespaceManager) CreateForTest(t testing.TB, prefix string) string {
+	t.Helper()
+	name, err := m.Create(context.Background(), prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := m.Delete(context.Background(), name); err != nil {
+			t.Error(err)
+		}
+	})
+	return name
+}
+
+// Delete deletes a namespace created by the manager. It does not wait for the namespace to be torn down.
+func (m *NamespaceManager) Delete(ctx context.Context, name string) error {
+	err := m.kube.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		return eris.Wrapf(err, "deleting namespace %s", name)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.namespaces, name)
+	return nil
+}
+
+// Cleanup deletes all namespaces created by the manager which were not deleted yet
+func (m *NamespaceManager) Cleanup(ctx context.Context) error {
+	eg := errgroup.Group{}
+	for _, name := range m.Namespaces() {
+		name := name
+		eg.Go(func() error {
+			return m.Delete(ctx, name)
+		})
+	}
+	return eg.Wait()
+}
+
+// DeleteExpiredNamespaces is a janitor for namespaces leaked by earlier test runs. It deletes the namespaces created
+// by a NamespaceManager whose TTL has passed and returns their names.
+func DeleteExpiredNamespaces(ctx context.Context, kube kubernetes.Interface) ([]string, error) {
+	list, err := kube.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: NamespaceRunIDLabel})
+	if err != nil {
+		return nil, eris.Wrapf(err, "listing test namespaces")
+	}
+	now := time.Now()
+	var deleted []string
+	for _, ns := range list.Items {
+		if ns.DeletionTimestamp != nil {
+			// already being torn down
+			continue
+		}
+		ttlSeconds, err := strconv.Atoi(ns.Labels[NamespaceTTLLabel])
+		if err != nil {
+			contextutils.LoggerFrom(ctx).Warnw("skipping test namespace with an invalid ttl",
+				zap.String("namespace", ns.Name), zap.Error(err))
+			continue
+		}
+		if ns.CreationTimestamp.Add(time.Duration(ttlSeconds) * time.Second).After(now) {
+			continue
+		}
+		err = kube.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return deleted, eris.Wrapf(err, "deleting expired namespace %s", ns.Name)
+		}
+		deleted = append(deleted, ns.Name)
+	}
+	return deleted, nil
+}
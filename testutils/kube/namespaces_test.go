@@ -0,0 +1,167 @@
+package kube_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/kube"
+	kubev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// recordingT runs the cleanups registered by a test when it is told the test finished
+type recordingT struct {
+	testing.TB
+	cleanups []func()
+	errors   []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func (t *recordingT) Error(args ...any) {
+	t.errors = append(t.errors, fmt.Sprint(args...))
+}
+
+func (t *recordingT) finish() {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+}
+
+var _ = Describe("namespace manager", func() {
+	var (
+		ctx       context.Context
+		clientset *fake.Clientset
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clientset = fake.NewClientset()
+	})
+
+	exists := func(name string) bool {
+		_, err := clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	It("creates labelled namespaces with unique names", func() {
+		manager := kube.MustNewNamespaceManager(clientset, "run-1", time.Hour)
+		a := manager.MustCreate(ctx, "gateway")
+		b := manager.MustCreate(ctx, "gateway")
+		Expect(a).NotTo(Equal(b))
+		Expect(a).To(HavePrefix("gateway-"))
+		Expect(manager.Namespaces()).To(ConsistOf(a, b))
+
+		ns, err := clientset.CoreV1().Namespaces().Get(ctx, a, metav1.GetOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ns.Labels).To(Equal(map[string]string{
+			kube.NamespaceRunIDLabel: "run-1",
+			kube.NamespaceTTLLabel:   "3600",
+		}))
+
+		long := manager.MustCreate(ctx, strings.Repeat("x", 100))
+		Expect(len(long)).To(Equal(63))
+
+		Expect(manager.Delete(ctx, a)).To(Succeed())
+		Expect(exists(a)).To(BeFalse())
+		// already gone
+		Expect(manager.Delete(ctx, a)).To(Succeed())
+
+		Expect(manager.Cleanup(ctx)).To(Succeed())
+		Expect(exists(b)).To(BeFalse())
+		Expect(exists(long)).To(BeFalse())
+		Expect(manager.Namespaces()).To(BeEmpty())
+	})
+
+	It("uses the run id from the environment", func() {
+		GinkgoT().Setenv(kube.RunIDEnv, "shared-run")
+		Expect(kube.MustNewNamespaceManager(clientset, "", 0).RunID()).To(Equal("shared-run"))
+	})
+
+	It("sanitizes prefixes into valid namespace names", func() {
+		manager := kube.MustNewNamespaceManager(clientset, "run-1", time.Hour)
+		name := manager.MustCreate(ctx, "My_Gateway.Test")
+		Expect(name).To(HavePrefix("my-gateway-test-"))
+
+		_, err := manager.Create(ctx, "")
+		Expect(err).To(MatchError(ContainSubstring("has no valid characters")))
+		_, err = manager.Create(ctx, "__")
+		Expect(err).To(MatchError(ContainSubstring("has no valid characters")))
+	})
+
+	It("rejects run ids which are not valid label values", func() {
+		GinkgoT().Setenv(kube.RunIDEnv, "pr #12/job 3")
+		_, err := kube.NewNamespaceManager(clientset, "", 0)
+		Expect(err).To(MatchError(ContainSubstring("invalid test run id")))
+	})
+
+	Context("registering cleanup", func() {
+		var (
+			manager *kube.NamespaceManager
+			name    string
+		)
+
+		BeforeEach(func() {
+			manager = kube.MustNewNamespaceManager(clientset, "", 0)
+		})
+
+		It("creates namespaces for the spec", func() {
+			name = manager.CreateForSpec(ctx, "spec")
+			Expect(exists(name)).To(BeTrue())
+		})
+
+		It("deletes them after the spec", func() {
+			Expect(name).NotTo(BeEmpty())
+			Expect(exists(name)).To(BeFalse())
+		})
+	}, Ordered)
+
+	It("deletes namespaces when a test finishes", func() {
+		manager := kube.MustNewNamespaceManager(clientset, "", 0)
+		t := &recordingT{}
+		name := manager.CreateForTest(t, "test")
+		Expect(exists(name)).To(BeTrue())
+
+		t.finish()
+		Expect(exists(name)).To(BeFalse())
+		Expect(t.errors).To(BeEmpty())
+	})
+
+	It("deletes expired namespaces of earlier runs", func() {
+		create := func(name string, age time.Duration, labels map[string]string) {
+			_, err := clientset.CoreV1().Namespaces().Create(ctx, &kubev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Labels:            labels,
+					CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+				},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		testLabels := func(ttl string) map[string]string {
+			return map[string]string{kube.NamespaceRunIDLabel: "old-run", kube.NamespaceTTLLabel: ttl}
+		}
+		create("expired", 2*time.Hour, testLabels("3600"))
+		create("alive", 30*time.Minute, testLabels("3600"))
+		create("invalid-ttl", 2*time.Hour, testLabels("forever"))
+		create("not-a-test-namespace", 2*time.Hour, nil)
+
+		deleted, err := kube.DeleteExpiredNamespaces(ctx, clientset)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deleted).To(Equal([]string{"expired"}))
+		Expect(exists("expired")).To(BeFalse())
+		Expect(exists("alive")).To(BeTrue())
+		Expect(exists("invalid-ttl")).To(BeTrue())
+		Expect(exists("not-a-test-namespace")).To(BeTrue())
+	})
+})
@@ -0,0 +1,380 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rotisserie/eris"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+// set by the deployment controller on a deployment and its replica sets
+const deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// FailFastContainerReasons are the reasons of waiting containers which do not recover without intervention.
+// Waiting for pods stops as soon as a container is waiting for one of them.
+var FailFastContainerReasons = []string{
+	"CrashLoopBackOff",
+	"ImagePullBackOff",
+	"ErrImageNeverPull",
+	"InvalidImageName",
+}
+
+// PodFailureError is returned when a container of a pod being waited for is failing
+type PodFailureError struct {
+	Namespace string
+	Pod       string
+	Container string
+	Reason    string
+	Message   string
+}
+
+func (e *PodFailureError) Error() string {
+	msg := fmt.Sprintf("container %s of pod %s/%s is in %s", e.Container, e.Namespace, e.Pod, e.Reason)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+func IsPodFailureError(err error) bool {
+	var failureErr *PodFailureError
+	return errors.As(err, &failureErr)
+}
+
+// WorkloadReference identifies the workload whose pods to wait for
+type WorkloadReference struct {
+	// Deployment, StatefulSet, DaemonSet or ReplicaSet
+	Kind string
+	Name string
+}
+
+func (w WorkloadReference) String() string {
+	return strings.ToLower(w.Kind) + "/" + w.Name
+}
+
+// PodsReady is met when at least replicas of the pods are Ready. It fails when a pod failed or one of its containers
+// is waiting for one of the FailFastContainerReasons. Terminating pods, evicted pods and failed pods of a controller,
+// which replaces them, are left out.
+func PodsReady(replicas int) FailFastCondition {
+	return &podsReady{replicas: replicas}
+}
+
+type podsReady struct {
+	replicas int
+}
+
+func (c *podsReady) String() string {
+	return fmt.Sprintf("%d ready", c.replicas)
+}
+
+func (c *podsReady) Met(objects []*unstructured.Unstructured) (bool, string) {
+	ready := 0
+	var unready []string
+	for _, obj := range objects {
+		pod, err := toPod(obj)
+		if err != nil {
+			unready = append(unready, objectName(obj)+": "+err.Error())
+			continue
+		}
+		if pod.DeletionTimestamp != nil {
+			unready = append(unready, objectName(obj)+": terminating")
+			continue
+		}
+		if podReady(pod) {
+			ready++
+			continue
+		}
+		unready = append(unready, objectName(obj)+": "+podState(pod))
+	}
+	observed := fmt.Sprintf("%d/%d ready", ready, c.replicas)
+	if len(unready) > 0 {
+		observed += "; " + strings.Join(unready, "; ")
+	}
+	return ready >= c.replicas, observed
+}
+
+func (c *podsReady) Failed(objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		pod, err := toPod(obj)
+		if err != nil || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Status.Phase == corev1.PodFailed {
+			// evicted pods keep their labels until they are garbage collected, while the controller replaces them
+			if pod.Status.Reason == "Evicted" || metav1.GetControllerOf(pod) != nil {
+				continue
+			}
+			return &PodFailureError{
+				Namespace: pod.Namespace,
+				Pod:       pod.Name,
+				Reason:    "phase " + string(corev1.PodFailed),
+				Message:   pod.Status.Message,
+			}
+		}
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			waiting := status.State.Waiting
+			if waiting == nil {
+				continue
+			}
+			for _, reason := range FailFastContainerReasons {
+				if waiting.Reason == reason {
+					return &PodFailureError{
+						Namespace: pod.Namespace,
+						Pod:       pod.Name,
+						Container: status.Name,
+						Reason:    waiting.Reason,
+						Message:   waiting.Message,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func toPod(obj *unstructured.Unstructured) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, pod); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// the phase of the pod and the state of the containers which are not ready
+func podState(pod *corev1.Pod) string {
+	state := "phase " + string(pod.Status.Phase)
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Ready {
+			continue
+		}
+		switch {
+		case status.State.Waiting != nil:
+			state += fmt.Sprintf(", container %s waiting: %s", status.Name, status.State.Waiting.Reason)
+		case status.State.Terminated != nil:
+			state += fmt.Sprintf(", container %s terminated: %s", status.Name, status.State.Terminated.Reason)
+		default:
+			state += fmt.Sprintf(", container %s not ready", status.Name)
+		}
+	}
+	return state
+}
+
+// WaitUntilPodsReady waits until replicas of the pods matching the selector are Ready. It returns a PodFailureError
+// as soon as one of them is failing.
+func WaitUntilPodsReady(ctx context.Context, kube kubernetes.Interface, namespace string, selector *metav1.LabelSelector, replicas int, timeout time.Duration) error {
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return eris.Wrapf(err, "parsing label selector")
+	}
+	return WaitFor(ctx, PodResourceClient(kube, namespace), PodsReady(replicas), WaitOptions{
+		LabelSelector: labelSelector.String(),
+		Timeout:       timeout,
+		Description:   fmt.Sprintf("pods matching %s in namespace %s", labelSelector, namespace),
+	})
+}
+
+// WaitUntilWorkloadReady waits until the controller of the workload has observed its latest spec, and then until as
+// many pods of its current revision are Ready as it has replicas, or as its daemon set schedules. Pods of earlier
+// revisions which are being replaced during a rollout are not counted. It returns a PodFailureError as soon as one of
+// the pods of the current revision is failing.
+func WaitUntilWorkloadReady(ctx context.Context, kube kubernetes.Interface, namespace string, workload WorkloadReference, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	selector, replicas, err := workloadPods(ctx, kube, namespace, workload, timeout)
+	if err != nil {
+		return eris.Wrapf(err, "getting %s", workload)
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return eris.Wrapf(err, "parsing label selector of %s", workload)
+	}
+	return WaitFor(ctx, PodResourceClient(kube, namespace), PodsReady(replicas), WaitOptions{
+		LabelSelector: labelSelector.String(),
+		Timeout:       timeout,
+		Description:   fmt.Sprintf("pods of %s in namespace %s", workload, namespace),
+	})
+}
+
+// the selector of the pods of the current revision of the workload, and their expected number, once the controller
+// of the workload has observed its latest spec
+func workloadPods(ctx context.Context, kube kubernetes.Interface, namespace string, workload WorkloadReference, timeout time.Duration) (*metav1.LabelSelector, int, error) {
+	replicas := func(replicas *int32) int {
+		if replicas == nil {
+			return 1
+		}
+		return int(*replicas)
+	}
+	switch strings.ToLower(workload.Kind) {
+	case "deployment":
+		deployments := kube.AppsV1().Deployments(namespace)
+		deployment, err := deployments.Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, err
+		}
+		if deployment.Status.ObservedGeneration < deployment.Generation {
+			client := NewTypedResourceClient(deployments.List, deployments.Watch)
+			if err := waitForObservedGeneration(ctx, client, namespace, workload, timeout); err != nil {
+				return nil, 0, err
+			}
+			if deployment, err = deployments.Get(ctx, workload.Name, metav1.GetOptions{}); err != nil {
+				return nil, 0, err
+			}
+		}
+		selector, err := deploymentRevisionSelector(ctx, kube, deployment)
+		if err != nil {
+			return nil, 0, err
+		}
+		return selector, replicas(deployment.Spec.Replicas), nil
+	case "statefulset":
+		statefulSets := kube.AppsV1().StatefulSets(namespace)
+		statefulSet, err := statefulSets.Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, err
+		}
+		if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+			client := NewTypedResourceClient(statefulSets.List, statefulSets.Watch)
+			if err := waitForObservedGeneration(ctx, client, namespace, workload, timeout); err != nil {
+				return nil, 0, err
+			}
+			if statefulSet, err = statefulSets.Get(ctx, workload.Name, metav1.GetOptions{}); err != nil {
+				return nil, 0, err
+			}
+		}
+		selector := statefulSet.Spec.Selector
+		// with OnDelete or a partition, pods of earlier revisions are kept on purpose
+		rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+		if statefulSet.Spec.UpdateStrategy.Type != appsv1.OnDeleteStatefulSetStrategyType &&
+			(rollingUpdate == nil || rollingUpdate.Partition == nil || *rollingUpdate.Partition == 0) &&
+			statefulSet.Status.UpdateRevision != "" {
+			selector = withMatchLabel(selector, appsv1.ControllerRevisionHashLabelKey, statefulSet.Status.UpdateRevision)
+		}
+		return selector, replicas(statefulSet.Spec.Replicas), nil
+	case "replicaset":
+		replicaSets := kube.AppsV1().ReplicaSets(namespace)
+		replicaSet, err := replicaSets.Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, err
+		}
+		if replicaSet.Status.ObservedGeneration < replicaSet.Generation {
+			client := NewTypedResourceClient(replicaSets.List, replicaSets.Watch)
+			if err := waitForObservedGeneration(ctx, client, namespace, workload, timeout); err != nil {
+				return nil, 0, err
+			}
+			if replicaSet, err = replicaSets.Get(ctx, workload.Name, metav1.GetOptions{}); err != nil {
+				return nil, 0, err
+			}
+		}
+		return replicaSet.Spec.Selector, replicas(replicaSet.Spec.Replicas), nil
+	case "daemonset":
+		daemonSets := kube.AppsV1().DaemonSets(namespace)
+		daemonSet, err := daemonSets.Get(ctx, workload.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, 0, err
+		}
+		// the number of pods to schedule is only known once the controller has observed the daemon set
+		if daemonSet.Status.ObservedGeneration < daemonSet.Generation {
+			client := NewTypedResourceClient(daemonSets.List, daemonSets.Watch)
+			if err := waitForObservedGeneration(ctx, client, namespace, workload, timeout); err != nil {
+				return nil, 0, err
+			}
+			if daemonSet, err = daemonSets.Get(ctx, workload.Name, metav1.GetOptions{}); err != nil {
+				return nil, 0, err
+			}
+		}
+		selector, err := daemonSetRevisionSelector(ctx, kube, daemonSet)
+		if err != nil {
+			return nil, 0, err
+		}
+		return selector, int(daemonSet.Status.DesiredNumberScheduled), nil
+	}
+	return nil, 0, eris.Errorf("unsupported workload kind %s", workload.Kind)
+}
+
+func waitForObservedGeneration(ctx context.Context, client ResourceClient, namespace string, workload WorkloadReference, timeout time.Duration) error {
+	return WaitFor(ctx, client, ObservedGeneration(), WaitOptions{
+		Name:        workload.Name,
+		Timeout:     timeout,
+		Description: fmt.Sprintf("%s in namespace %s", workload, namespace),
+	})
+}
+
+// pods of the current revision of a deployment carry the pod-template-hash of its newest replica set
+func deploymentRevisionSelector(ctx context.Context, kube kubernetes.Interface, deployment *appsv1.Deployment) (*metav1.LabelSelector, error) {
+	revision := deployment.Annotations[deploymentRevisionAnnotation]
+	if revision == "" {
+		// not rolled out by a controller yet
+		return deployment.Spec.Selector, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	replicaSets, err := kube.AppsV1().ReplicaSets(deployment.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	for i := range replicaSets.Items {
+		replicaSet := &replicaSets.Items[i]
+		if !metav1.IsControlledBy(replicaSet, deployment) || replicaSet.Annotations[deploymentRevisionAnnotation] != revision {
+			continue
+		}
+		hash := replicaSet.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash == "" {
+			return deployment.Spec.Selector, nil
+		}
+		return withMatchLabel(deployment.Spec.Selector, appsv1.DefaultDeploymentUniqueLabelKey, hash), nil
+	}
+	return nil, eris.Errorf("no replica set of revision %s of deployment %s", revision, deployment.Name)
+}
+
+// pods of the current revision of a daemon set carry the hash of its newest controller revision
+func daemonSetRevisionSelector(ctx context.Context, kube kubernetes.Interface, daemonSet *appsv1.DaemonSet) (*metav1.LabelSelector, error) {
+	selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := kube.AppsV1().ControllerRevisions(daemonSet.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	var current *appsv1.ControllerRevision
+	for i := range revisions.Items {
+		revision := &revisions.Items[i]
+		if metav1.IsControlledBy(revision, daemonSet) && (current == nil || revision.Revision > current.Revision) {
+			current = revision
+		}
+	}
+	if current == nil || current.Labels[appsv1.DefaultDaemonSetUniqueLabelKey] == "" {
+		// not rolled out by a controller yet
+		return daemonSet.Spec.Selector, nil
+	}
+	return withMatchLabel(daemonSet.Spec.Selector, appsv1.DefaultDaemonSetUniqueLabelKey, current.Labels[appsv1.DefaultDaemonSetUniqueLabelKey]), nil
+}
+
+func withMatchLabel(selector *metav1.LabelSelector, key, value string) *metav1.LabelSelector {
+	selector = selector.DeepCopy()
+	if selector.MatchLabels == nil {
+		selector.MatchLabels = map[string]string{}
+	}
+	selector.MatchLabels[key] = value
+	return selector
+}
@@ -0,0 +1,237 @@
+package kube_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/kube"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("pod readiness", func() {
+	var (
+		ctx       context.Context
+		clientset *fake.Clientset
+		selector  *metav1.LabelSelector
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clientset = fake.NewClientset()
+		selector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "gateway"}}
+	})
+
+	pod := func(name string, ready bool, labels map[string]string) *corev1.Pod {
+		status := corev1.ConditionFalse
+		if ready {
+			status = corev1.ConditionTrue
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+			Status: corev1.PodStatus{
+				Phase:      corev1.PodRunning,
+				Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "gateway",
+					Ready: ready,
+					State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+				}},
+			},
+		}
+	}
+
+	gatewayPod := func(name string, ready bool) *corev1.Pod {
+		return pod(name, ready, map[string]string{"app": "gateway"})
+	}
+
+	create := func(p *corev1.Pod) {
+		_, err := clientset.CoreV1().Pods("default").Create(ctx, p, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	updateLater := func(p *corev1.Pod) {
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			_, err := clientset.CoreV1().Pods("default").UpdateStatus(ctx, p, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+
+	It("waits until the expected number of pods are ready", func() {
+		create(gatewayPod("gateway-a", true))
+		create(gatewayPod("gateway-b", false))
+		// matches the name prefix, but not the selector
+		create(pod("gateway-proxy-c", true, map[string]string{"app": "proxy"}))
+		updateLater(gatewayPod("gateway-b", true))
+
+		Expect(kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 2, 5*time.Second)).To(Succeed())
+	})
+
+	It("reports the pods which are not ready on timeout", func() {
+		create(gatewayPod("gateway-a", true))
+		notReady := gatewayPod("gateway-b", false)
+		notReady.Status.ContainerStatuses[0].State = corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"},
+		}
+		create(notReady)
+
+		err := kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 2, 100*time.Millisecond)
+		Expect(kube.IsWaitTimeoutError(err)).To(BeTrue())
+		Expect(err).To(MatchError("timed out after 100ms waiting for pods matching app=gateway in namespace default (2 ready): " +
+			"1/2 ready; default/gateway-b: phase Running, container gateway waiting: ContainerCreating"))
+	})
+
+	DescribeTable("fails fast on failing containers",
+		func(reason string) {
+			failing := gatewayPod("gateway-a", false)
+			failing.Status.ContainerStatuses[0].State = corev1.ContainerState{
+				Waiting: &corev1.ContainerStateWaiting{Reason: reason, Message: "details"},
+			}
+			create(failing)
+
+			start := time.Now()
+			err := kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 1, time.Minute)
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(kube.IsPodFailureError(err)).To(BeTrue())
+			Expect(err).To(MatchError("container gateway of pod default/gateway-a is in " + reason + ": details"))
+		},
+		Entry("crash loops", "CrashLoopBackOff"),
+		Entry("image pull failures", "ImagePullBackOff"),
+	)
+
+	It("fails fast when a container starts failing while waiting", func() {
+		create(gatewayPod("gateway-a", false))
+		failing := gatewayPod("gateway-a", false)
+		failing.Status.InitContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "init",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+		}}
+		updateLater(failing)
+
+		err := kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 1, time.Minute)
+		Expect(err).To(MatchError("container init of pod default/gateway-a is in CrashLoopBackOff"))
+	})
+
+	It("waits for the replacement of evicted pods", func() {
+		controller := true
+		evicted := gatewayPod("gateway-a", false)
+		evicted.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "gateway-5b4c7d8f9", UID: "rs", Controller: &controller,
+		}}
+		evicted.Status = corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted", Message: "The node was low on resource: memory."}
+		create(evicted)
+		create(gatewayPod("gateway-b", false))
+		updateLater(gatewayPod("gateway-b", true))
+
+		Expect(kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 1, 5*time.Second)).To(Succeed())
+	})
+
+	It("fails fast on failed pods without a controller", func() {
+		failed := gatewayPod("gateway-a", false)
+		failed.Status = corev1.PodStatus{Phase: corev1.PodFailed, Message: "exited"}
+		create(failed)
+
+		err := kube.WaitUntilPodsReady(ctx, clientset, "default", selector, 1, time.Minute)
+		Expect(kube.IsPodFailureError(err)).To(BeTrue())
+	})
+
+	It("waits for the replicas of workloads", func() {
+		replicas := int32(2)
+		_, err := clientset.AppsV1().Deployments("default").Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: selector,
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		create(gatewayPod("gateway-a", true))
+		create(gatewayPod("gateway-b", false))
+
+		workload := kube.WorkloadReference{Kind: "Deployment", Name: "gateway"}
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 100*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("waiting for pods of deployment/gateway in namespace default (2 ready): 1/2 ready")))
+
+		updateLater(gatewayPod("gateway-b", true))
+		Expect(kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 5*time.Second)).To(Succeed())
+
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", kube.WorkloadReference{Kind: "Deployment", Name: "missing"}, time.Second)
+		Expect(err).To(MatchError(ContainSubstring("getting deployment/missing")))
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", kube.WorkloadReference{Kind: "Job", Name: "gateway"}, time.Second)
+		Expect(err).To(MatchError(ContainSubstring("unsupported workload kind Job")))
+	})
+
+	It("only counts the pods of the current revision of a deployment", func() {
+		replicas := int32(1)
+		deployment, err := clientset.AppsV1().Deployments("default").Create(ctx, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "default",
+				Name:        "gateway",
+				UID:         "deployment-uid",
+				Generation:  2,
+				Annotations: map[string]string{"deployment.kubernetes.io/revision": "2"},
+			},
+			Spec:   appsv1.DeploymentSpec{Replicas: &replicas, Selector: selector},
+			Status: appsv1.DeploymentStatus{ObservedGeneration: 1},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		for revision, hash := range map[string]string{"1": "old", "2": "new"} {
+			_, err := clientset.AppsV1().ReplicaSets("default").Create(ctx, &appsv1.ReplicaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:       "default",
+					Name:            "gateway-" + hash,
+					Labels:          map[string]string{"app": "gateway", "pod-template-hash": hash},
+					Annotations:     map[string]string{"deployment.kubernetes.io/revision": revision},
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+				},
+			}, metav1.CreateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}
+		// the old pod is ready, and another old one is crashing while it is replaced
+		create(pod("gateway-old-a", true, map[string]string{"app": "gateway", "pod-template-hash": "old"}))
+		crashing := pod("gateway-old-b", false, map[string]string{"app": "gateway", "pod-template-hash": "old"})
+		crashing.Status.ContainerStatuses[0].State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}}
+		create(crashing)
+		create(pod("gateway-new-a", false, map[string]string{"app": "gateway", "pod-template-hash": "new"}))
+
+		workload := kube.WorkloadReference{Kind: "Deployment", Name: "gateway"}
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 100*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("waiting for deployment/gateway in namespace default (observed generation): " +
+			"default/gateway: observed generation 1 of 2")))
+
+		deployment.Status.ObservedGeneration = 2
+		_, err = clientset.AppsV1().Deployments("default").UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 100*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("(1 ready): 0/1 ready; default/gateway-new-a")))
+
+		updateLater(pod("gateway-new-a", true, map[string]string{"app": "gateway", "pod-template-hash": "new"}))
+		Expect(kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 5*time.Second)).To(Succeed())
+	})
+
+	It("waits for the daemon set controller to count the pods to schedule", func() {
+		daemonSet, err := clientset.AppsV1().DaemonSets("default").Create(ctx, &appsv1.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "gateway", Generation: 1},
+			Spec:       appsv1.DaemonSetSpec{Selector: selector},
+		}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		create(gatewayPod("gateway-a", false))
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			daemonSet.Status = appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 1}
+			_, err := clientset.AppsV1().DaemonSets("default").UpdateStatus(ctx, daemonSet, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		workload := kube.WorkloadReference{Kind: "DaemonSet", Name: "gateway"}
+		err = kube.WaitUntilWorkloadReady(ctx, clientset, "default", workload, 500*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("(1 ready): 0/1 ready")))
+	})
+})
@@ -0,0 +1,360 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rotisserie/eris"
+	"github.com/solo-io/go-utils/contextutils"
+	"go.uber.org/zap"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const DefaultTeardownTimeout = time.Minute
+
+var (
+	noTeardownSelectorError  = eris.New("a label selector, a name pattern or an owner is required")
+	noTeardownNamespaceError = eris.New("a name pattern alone selects resources in all namespaces, a namespace or ClusterWide is required")
+)
+
+// resource types served by several groups, which are only torn down through the type they are an alias of
+var teardownAliases = map[schema.GroupResource]schema.GroupResource{
+	{Group: "events.k8s.io", Resource: "events"}: {Resource: "events"},
+}
+
+// TeardownOptions select the resources to delete. Resources need to match all of the label selector, the name
+// pattern and the owner which are set.
+type TeardownOptions struct {
+	LabelSelector string
+	NamePattern   *regexp.Regexp
+	// selects the resources with an owner reference to the object with this uid. The garbage collector already
+	// deletes the dependents of deleted owners, this is for the dependents of owners which are kept.
+	OwnerUID types.UID
+	// limits namespaced resources to the namespace, cluster scoped resources are always considered
+	Namespace string
+	// allows a name pattern alone to select resources in all namespaces
+	ClusterWide bool
+	// skips the resource types for which the filter returns true, e.g. events
+	Exclude func(gvr schema.GroupVersionResource) bool
+	// how long to wait for deleted resources to be gone, defaults to DefaultTeardownTimeout
+	Timeout time.Duration
+	// removes the finalizers of resources which are not gone after the timeout, and waits for them once more
+	StripFinalizers bool
+}
+
+// TeardownResource identifies a resource found by a teardown
+type TeardownResource struct {
+	GVR       schema.GroupVersionResource
+	Namespace string
+	Name      string
+}
+
+func (r TeardownResource) String() string {
+	resource := r.GVR.GroupResource().String()
+	if r.Namespace == "" {
+		return resource + " " + r.Name
+	}
+	return resource + " " + r.Namespace + "/" + r.Name
+}
+
+type TeardownFailure struct {
+	Resource TeardownResource
+	Err      error
+}
+
+// TeardownReport lists what a teardown did
+type TeardownReport struct {
+	// resources which were deleted and are gone
+	Deleted []TeardownResource
+	// resources whose finalizers were removed, they are also listed as deleted or remaining
+	FinalizersStripped []TeardownResource
+	// resources which were deleted but are still present, e.g. waiting for finalizers
+	Remaining []TeardownResource
+	// resource types which could not be listed and resources which could not be deleted
+	Failed []TeardownFailure
+}
+
+func (r *TeardownReport) String() string {
+	msg := fmt.Sprintf("deleted %d resources", len(r.Deleted))
+	if len(r.FinalizersStripped) > 0 {
+		msg += fmt.Sprintf(", stripped the finalizers of %d", len(r.FinalizersStripped))
+	}
+	if len(r.Remaining) > 0 {
+		var remaining []string
+		for _, resource := range r.Remaining {
+			remaining = append(remaining, resource.String())
+		}
+		msg += fmt.Sprintf(", %d remaining: %s", len(r.Remaining), strings.Join(remaining, ", "))
+	}
+	if len(r.Failed) > 0 {
+		var failed []string
+		for _, failure := range r.Failed {
+			failed = append(failed, fmt.Sprintf("%s: %v", failure.Resource, failure.Err))
+		}
+		msg += fmt.Sprintf(", %d failed: %s", len(r.Failed), strings.Join(failed, "; "))
+	}
+	return msg
+}
+
+// Teardown deletes the resources of all types the api server serves which match a selection, e.g. everything a
+// test suite labelled
+type Teardown struct {
+	discovery discovery.DiscoveryInterface
+	dynamic   dynamic.Interface
+}
+
+func NewTeardown(discovery discovery.DiscoveryInterface, dynamic dynamic.Interface) *Teardown {
+	return &Teardown{
+		discovery: discovery,
+		dynamic:   dynamic,
+	}
+}
+
+func NewTeardownForConfig(cfg *rest.Config) (*Teardown, error) {
+	disc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewTeardown(disc, client), nil
+}
+
+// Run deletes the selected resources and waits for them to be gone. It returns an error along with the report when
+// resources remain or could not be deleted.
+func (t *Teardown) Run(ctx context.Context, opts TeardownOptions) (*TeardownReport, error) {
+	if opts.LabelSelector == "" && opts.NamePattern == nil && opts.OwnerUID == "" {
+		return nil, noTeardownSelectorError
+	}
+	if opts.LabelSelector == "" && opts.OwnerUID == "" && opts.Namespace == "" && !opts.ClusterWide {
+		return nil, noTeardownNamespaceError
+	}
+	if _, err := labels.Parse(opts.LabelSelector); err != nil {
+		return nil, eris.Wrapf(err, "parsing label selector")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTeardownTimeout
+	}
+
+	report := &TeardownReport{}
+	resources, err := t.resources(report)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []TeardownResource
+	for _, resource := range resources {
+		if opts.Exclude != nil && opts.Exclude(resource.gvr) {
+			continue
+		}
+		deleted = append(deleted, t.deleteAll(ctx, resource, opts, report)...)
+	}
+
+	remaining := t.waitUntilGone(ctx, deleted, opts.Timeout)
+	if opts.StripFinalizers && len(remaining) > 0 {
+		var stripped []TeardownResource
+		for _, resource := range remaining {
+			if err := t.stripFinalizers(ctx, resource); err != nil {
+				report.Failed = append(report.Failed, TeardownFailure{Resource: resource, Err: eris.Wrapf(err, "removing finalizers")})
+				continue
+			}
+			stripped = append(stripped, resource)
+		}
+		report.FinalizersStripped = stripped
+		remaining = t.waitUntilGone(ctx, remaining, opts.Timeout)
+	}
+
+	remainingSet := sets.New[TeardownResource](remaining...)
+	for _, resource := range deleted {
+		if !remainingSet.Has(resource) {
+			report.Deleted = append(report.Deleted, resource)
+		}
+	}
+	report.Remaining = remaining
+	contextutils.LoggerFrom(ctx).Infow("teardown finished", zap.String("report", report.String()))
+
+	if len(report.Remaining) > 0 || len(report.Failed) > 0 {
+		return report, eris.Errorf("teardown incomplete: %s", report)
+	}
+	return report, nil
+}
+
+type teardownResourceType struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
+
+// the types which can be listed and deleted, in the preferred version of their group
+func (t *Teardown) resources(report *TeardownReport) ([]teardownResourceType, error) {
+	groups, resourceLists, err := t.discovery.ServerGroupsAndResources()
+	if err != nil {
+		if !discovery.IsGroupDiscoveryFailedError(err) {
+			return nil, eris.Wrapf(err, "discovering resources")
+		}
+		// continue with the groups which could be discovered
+		for gv, groupErr := range err.(*discovery.ErrGroupDiscoveryFailed).Groups {
+			report.Failed = append(report.Failed, TeardownFailure{
+				Resource: TeardownResource{GVR: gv.WithResource("")},
+				Err:      eris.Wrapf(groupErr, "discovering %s", gv),
+			})
+		}
+	}
+	preferredVersions := map[string]string{}
+	for _, group := range groups {
+		preferredVersions[group.Name] = group.PreferredVersion.Version
+	}
+
+	deletable := discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, resourceLists)
+	byGroupResource := map[schema.GroupResource]teardownResourceType{}
+	var order []schema.GroupResource
+	for _, list := range deletable {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				// subresource
+				continue
+			}
+			gr := schema.GroupResource{Group: gv.Group, Resource: resource.Name}
+			if _, ok := byGroupResource[gr]; ok {
+				if gv.Version != preferredVersions[gv.Group] {
+					continue
+				}
+			} else {
+				order = append(order, gr)
+			}
+			byGroupResource[gr] = teardownResourceType{gvr: gv.WithResource(resource.Name), namespaced: resource.Namespaced}
+		}
+	}
+
+	var resources []teardownResourceType
+	for _, gr := range order {
+		if alias, ok := teardownAliases[gr]; ok {
+			if _, ok := byGroupResource[alias]; ok {
+				continue
+			}
+		}
+		resources = append(resources, byGroupResource[gr])
+	}
+	return resources, nil
+}
+
+// deletes the selected resources of the type and returns them
+func (t *Teardown) deleteAll(ctx context.Context, resourceType teardownResourceType, opts TeardownOptions, report *TeardownReport) []TeardownResource {
+	var client dynamic.ResourceInterface = t.dynamic.Resource(resourceType.gvr)
+	if resourceType.namespaced && opts.Namespace != "" {
+		client = t.dynamic.Resource(resourceType.gvr).Namespace(opts.Namespace)
+	}
+	list, err := client.List(ctx, metav1.ListOptions{LabelSelector: opts.LabelSelector})
+	if err != nil {
+		report.Failed = append(report.Failed, TeardownFailure{
+			Resource: TeardownResource{GVR: resourceType.gvr},
+			Err:      eris.Wrapf(err, "listing"),
+		})
+		return nil
+	}
+
+	var deleted []TeardownResource
+	propagation := metav1.DeletePropagationBackground
+	for _, obj := range list.Items {
+		if opts.NamePattern != nil && !opts.NamePattern.MatchString(obj.GetName()) {
+			continue
+		}
+		if opts.OwnerUID != "" && !ownedBy(obj.GetOwnerReferences(), opts.OwnerUID) {
+			continue
+		}
+		resource := TeardownResource{GVR: resourceType.gvr, Namespace: obj.GetNamespace(), Name: obj.GetName()}
+		err := t.client(resource).Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			report.Failed = append(report.Failed, TeardownFailure{Resource: resource, Err: eris.Wrapf(err, "deleting")})
+			continue
+		}
+		deleted = append(deleted, resource)
+	}
+	return deleted
+}
+
+func ownedBy(owners []metav1.OwnerReference, uid types.UID) bool {
+	for _, owner := range owners {
+		if owner.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Teardown) client(resource TeardownResource) dynamic.ResourceInterface {
+	if resource.Namespace == "" {
+		return t.dynamic.Resource(resource.GVR)
+	}
+	return t.dynamic.Resource(resource.GVR).Namespace(resource.Namespace)
+}
+
+// waits up to the timeout for all resources to be gone, and returns the ones which are not. The resources of a type
+// in a namespace are waited for together, with a single watch.
+func (t *Teardown) waitUntilGone(ctx context.Context, resources []TeardownResource, timeout time.Duration) []TeardownResource {
+	type typeInNamespace struct {
+		gvr       schema.GroupVersionResource
+		namespace string
+	}
+	var order []typeInNamespace
+	names := map[typeInNamespace]sets.Set[string]{}
+	for _, resource := range resources {
+		key := typeInNamespace{gvr: resource.GVR, namespace: resource.Namespace}
+		if _, ok := names[key]; !ok {
+			order = append(order, key)
+			names[key] = sets.New[string]()
+		}
+		names[key].Insert(resource.Name)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var remaining []TeardownResource
+	for _, key := range order {
+		err := WaitFor(waitCtx, DynamicResourceClient(t.dynamic, key.gvr, key.namespace), Deleted(), WaitOptions{
+			Filter: func(obj *unstructured.Unstructured) bool {
+				return names[key].Has(obj.GetName())
+			},
+			Timeout:     timeout,
+			Description: fmt.Sprintf("%s %s", key.gvr.GroupResource(), strings.Join(sets.List(names[key]), ", ")),
+		})
+		if err == nil {
+			continue
+		}
+		// the wait fails right away once the timeout passed, the resources may be gone nevertheless
+		for _, name := range sets.List(names[key]) {
+			resource := TeardownResource{GVR: key.gvr, Namespace: key.namespace, Name: name}
+			if _, err := t.client(resource).Get(ctx, name, metav1.GetOptions{}); kubeerrors.IsNotFound(err) {
+				continue
+			}
+			remaining = append(remaining, resource)
+		}
+	}
+	return remaining
+}
+
+func (t *Teardown) stripFinalizers(ctx context.Context, resource TeardownResource) error {
+	patch := []byte(`{"metadata":{"finalizers":null}}`)
+	_, err := t.client(resource).Patch(ctx, resource.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if kubeerrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,247 @@
+package kube_test
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/kube"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	discoveryfake "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Teardown", func() {
+	var (
+		ctx           context.Context
+		dynamicClient *dynamicfake.FakeDynamicClient
+		teardown      *kube.Teardown
+	)
+
+	var (
+		configMaps   = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+		namespaces   = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+		clusterRoles = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+		widgets      = schema.GroupVersionResource{Group: "example.solo.io", Version: "v1", Resource: "widgets"}
+		oldWidgets   = schema.GroupVersionResource{Group: "example.solo.io", Version: "v1beta1", Resource: "widgets"}
+		events       = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+		newEvents    = schema.GroupVersionResource{Group: "events.k8s.io", Version: "v1", Resource: "events"}
+	)
+
+	object := func(apiVersion, kind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	exists := func(gvr schema.GroupVersionResource, namespace, name string) bool {
+		_, err := dynamicClient.Tracker().Get(gvr, namespace, name)
+		return err == nil
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		suite := map[string]string{"suite": "gateway"}
+		stuck := object("example.solo.io/v1", "Widget", "default", "test-widget", suite)
+		stuck.SetFinalizers([]string{"example.solo.io/cleanup"})
+		dynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{
+				configMaps:   "ConfigMapList",
+				namespaces:   "NamespaceList",
+				clusterRoles: "ClusterRoleList",
+				widgets:      "WidgetList",
+				oldWidgets:   "WidgetList",
+				events:       "EventList",
+				newEvents:    "EventList",
+			},
+			object("v1", "ConfigMap", "default", "test-config", suite),
+			object("v1", "ConfigMap", "default", "keep", nil),
+			object("v1", "ConfigMap", "other", "test-other", nil),
+			object("v1", "Namespace", "", "default", nil),
+			object("rbac.authorization.k8s.io/v1", "ClusterRole", "", "test-role", suite),
+			object("v1", "Event", "default", "test-event", suite),
+			stuck,
+		)
+
+		// deleting resources with finalizers only marks them for deletion, like the api server does
+		dynamicClient.PrependReactor("delete", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			deleteAction := action.(k8stesting.DeleteAction)
+			obj, err := dynamicClient.Tracker().Get(widgets, deleteAction.GetNamespace(), deleteAction.GetName())
+			if err != nil {
+				return true, nil, err
+			}
+			widget := obj.(*unstructured.Unstructured)
+			if len(widget.GetFinalizers()) == 0 {
+				return false, nil, nil
+			}
+			now := metav1.Now()
+			widget.SetDeletionTimestamp(&now)
+			return true, nil, dynamicClient.Tracker().Update(widgets, widget, widget.GetNamespace())
+		})
+		// and removing the finalizers of resources marked for deletion deletes them
+		dynamicClient.PrependReactor("patch", "widgets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			patchAction := action.(k8stesting.PatchAction)
+			Expect(string(patchAction.GetPatch())).To(Equal(`{"metadata":{"finalizers":null}}`))
+			obj, err := dynamicClient.Tracker().Get(widgets, patchAction.GetNamespace(), patchAction.GetName())
+			if err != nil {
+				return true, nil, err
+			}
+			return true, obj, dynamicClient.Tracker().Delete(widgets, patchAction.GetNamespace(), patchAction.GetName())
+		})
+
+		discovery := &discoveryfake.FakeDiscovery{Fake: &k8stesting.Fake{Resources: []*metav1.APIResourceList{
+			{
+				GroupVersion: "v1",
+				APIResources: []metav1.APIResource{
+					{Name: "configmaps", Namespaced: true, Verbs: []string{"get", "list", "watch", "delete"}},
+					{Name: "namespaces", Verbs: []string{"get", "list", "watch", "delete"}},
+					{Name: "pods/log", Namespaced: true, Verbs: []string{"get", "list", "delete"}},
+					{Name: "componentstatuses", Verbs: []string{"get", "list"}},
+					{Name: "events", Namespaced: true, Verbs: []string{"get", "list", "watch", "delete"}},
+				},
+			},
+			{
+				GroupVersion: "events.k8s.io/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "events", Namespaced: true, Verbs: []string{"get", "list", "watch", "delete"}},
+				},
+			},
+			{
+				GroupVersion: "example.solo.io/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "widgets", Namespaced: true, Verbs: []string{"get", "list", "watch", "delete", "patch"}},
+				},
+			},
+			{
+				GroupVersion: "example.solo.io/v1beta1",
+				APIResources: []metav1.APIResource{
+					{Name: "widgets", Namespaced: true, Verbs: []string{"get", "list", "watch", "delete", "patch"}},
+				},
+			},
+			{
+				GroupVersion: "rbac.authorization.k8s.io/v1",
+				APIResources: []metav1.APIResource{
+					{Name: "clusterroles", Verbs: []string{"get", "list", "watch", "delete"}},
+				},
+			},
+		}}}
+		teardown = kube.NewTeardown(discovery, dynamicClient)
+	})
+
+	deletes := func(resource string) int {
+		count := 0
+		for _, action := range dynamicClient.Actions() {
+			if action.GetVerb() == "delete" && action.GetResource().Resource == resource {
+				count++
+			}
+		}
+		return count
+	}
+
+	It("deletes resources of all types matching the label selector", func() {
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			LabelSelector: "suite=gateway",
+			Timeout:       100 * time.Millisecond,
+		})
+		Expect(err).To(MatchError(ContainSubstring("teardown incomplete")))
+		Expect(report.Deleted).To(ConsistOf(
+			kube.TeardownResource{GVR: configMaps, Namespace: "default", Name: "test-config"},
+			kube.TeardownResource{GVR: clusterRoles, Name: "test-role"},
+			kube.TeardownResource{GVR: events, Namespace: "default", Name: "test-event"},
+		))
+		Expect(report.Remaining).To(Equal([]kube.TeardownResource{{GVR: widgets, Namespace: "default", Name: "test-widget"}}))
+		Expect(report.String()).To(Equal("deleted 3 resources, 1 remaining: widgets.example.solo.io default/test-widget"))
+		Expect(report.Failed).To(BeEmpty())
+
+		Expect(exists(configMaps, "default", "keep")).To(BeTrue())
+		Expect(exists(configMaps, "default", "test-config")).To(BeFalse())
+		// only in the preferred version
+		Expect(deletes("widgets")).To(Equal(1))
+		// only through the core group, events.k8s.io serves the same objects
+		Expect(deletes("events")).To(Equal(1))
+	})
+
+	It("strips stuck finalizers", func() {
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			LabelSelector:   "suite=gateway",
+			Timeout:         100 * time.Millisecond,
+			StripFinalizers: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(HaveLen(4))
+		Expect(report.FinalizersStripped).To(Equal([]kube.TeardownResource{{GVR: widgets, Namespace: "default", Name: "test-widget"}}))
+		Expect(report.Remaining).To(BeEmpty())
+		Expect(exists(widgets, "default", "test-widget")).To(BeFalse())
+	})
+
+	It("deletes resources matching the name pattern in the namespace", func() {
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			NamePattern: regexp.MustCompile("^test-"),
+			Namespace:   "other",
+			Timeout:     100 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(ConsistOf(
+			kube.TeardownResource{GVR: configMaps, Namespace: "other", Name: "test-other"},
+			kube.TeardownResource{GVR: clusterRoles, Name: "test-role"},
+		))
+		Expect(exists(configMaps, "default", "test-config")).To(BeTrue())
+		Expect(exists(namespaces, "", "default")).To(BeTrue())
+	})
+
+	It("skips excluded types", func() {
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			LabelSelector: "suite=gateway",
+			Exclude: func(gvr schema.GroupVersionResource) bool {
+				return gvr.Group == "example.solo.io"
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(HaveLen(3))
+		Expect(exists(widgets, "default", "test-widget")).To(BeTrue())
+	})
+
+	It("deletes resources owned by an owner", func() {
+		owned := object("v1", "ConfigMap", "other", "owned", nil)
+		owned.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "owner", UID: "owner-uid"}})
+		Expect(dynamicClient.Tracker().Create(configMaps, owned, "other")).To(Succeed())
+
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			OwnerUID: "owner-uid",
+			Timeout:  100 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(Equal([]kube.TeardownResource{{GVR: configMaps, Namespace: "other", Name: "owned"}}))
+		Expect(exists(configMaps, "other", "test-other")).To(BeTrue())
+	})
+
+	It("requires a selection", func() {
+		_, err := teardown.Run(ctx, kube.TeardownOptions{})
+		Expect(err).To(MatchError("a label selector, a name pattern or an owner is required"))
+		Expect(dynamicClient.Actions()).To(BeEmpty())
+	})
+
+	It("requires a namespace or an opt-in to select by name pattern in all namespaces", func() {
+		_, err := teardown.Run(ctx, kube.TeardownOptions{NamePattern: regexp.MustCompile("^test-")})
+		Expect(err).To(MatchError(ContainSubstring("a namespace or ClusterWide is required")))
+		Expect(dynamicClient.Actions()).To(BeEmpty())
+
+		report, err := teardown.Run(ctx, kube.TeardownOptions{
+			NamePattern: regexp.MustCompile("^test-other$"),
+			ClusterWide: true,
+			Timeout:     100 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Deleted).To(Equal([]kube.TeardownResource{{GVR: configMaps, Namespace: "other", Name: "test-other"}}))
+	})
+})
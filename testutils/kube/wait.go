@@ -2,17 +2,15 @@ package kube
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"strings"
 	"time"
 
 	. "github.com/onsi/gomega"
 	"github.com/rotisserie/eris"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/kubernetes"
-
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func WaitForNamespaceTeardown(ctx context.Context, ns string) {
@@ -20,81 +18,42 @@ func WaitForNamespaceTeardown(ctx context.Context, ns string) {
 }
 
 func WaitForNamespaceTeardownWithClient(ctx context.Context, ns string, client kubernetes.Interface) {
-	EventuallyWithOffset(1, func() (bool, error) {
-		namespaces, err := client.CoreV1().Namespaces().List(ctx, v1.ListOptions{})
-		if err != nil {
-			// namespace is gone
-			return false, err
-		}
-		for _, n := range namespaces.Items {
-			if n.Name == ns {
-				return false, nil
-			}
-		}
-		return true, nil
-	}, time.Second*180).Should(BeTrue())
+	err := WaitFor(ctx, NamespaceResourceClient(client), Deleted(), WaitOptions{
+		Name:        ns,
+		Timeout:     time.Second * 180,
+		Description: "namespace " + ns,
+	})
+	ExpectWithOffset(1, err).NotTo(HaveOccurred())
 }
 
+// WaitUntilClusterPodsRunning matches pods by name prefix, which can match unrelated pods. Prefer
+// WaitUntilPodsReady or WaitUntilWorkloadReady.
 func WaitUntilClusterPodsRunning(ctx context.Context, timeout time.Duration, kubeconfig, kubecontext, namespace string, podPrefixes ...string) error {
 	return waitUntilPodsRunning(ctx, MustKubeClientFromContext(kubeconfig, kubecontext), timeout, namespace, podPrefixes...)
 }
 
+// WaitUntilPodsRunning matches pods by name prefix, which can match unrelated pods. Prefer WaitUntilPodsReady or
+// WaitUntilWorkloadReady.
 func WaitUntilPodsRunning(ctx context.Context, timeout time.Duration, namespace string, podPrefixes ...string) error {
 	return waitUntilPodsRunning(ctx, MustKubeClient(), timeout, namespace, podPrefixes...)
 }
 
 func waitUntilPodsRunning(ctx context.Context, kubeClient kubernetes.Interface, timeout time.Duration, namespace string, podPrefixes ...string) error {
-	pods := kubeClient.CoreV1().Pods(namespace)
-	podsWithPrefixReady := func(prefix string) (bool, error) {
-		list, err := pods.List(ctx, metav1.ListOptions{})
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pods := PodResourceClient(kubeClient, namespace)
+	for _, prefix := range podPrefixes {
+		prefix := prefix
+		err := WaitFor(ctx, pods, StatusCondition(string(corev1.ContainersReady), string(corev1.ConditionTrue)), WaitOptions{
+			Filter: func(pod *unstructured.Unstructured) bool {
+				return strings.HasPrefix(pod.GetName(), prefix)
+			},
+			Timeout:     timeout,
+			Description: fmt.Sprintf("pods with prefix %s in namespace %s", prefix, namespace),
+		})
 		if err != nil {
-			return false, err
-		}
-		var podsWithPrefix []corev1.Pod
-		for _, pod := range list.Items {
-			if strings.HasPrefix(pod.Name, prefix) {
-				podsWithPrefix = append(podsWithPrefix, pod)
-			}
+			return eris.Wrapf(err, "waiting for pods to come online")
 		}
-		if len(podsWithPrefix) == 0 {
-			return false, eris.Errorf("no pods found with prefix %v", prefix)
-		}
-		for _, pod := range podsWithPrefix {
-			var podReady bool
-			for _, cond := range pod.Status.Conditions {
-				if cond.Type == corev1.ContainersReady && cond.Status == corev1.ConditionTrue {
-					podReady = true
-					break
-				}
-			}
-			if !podReady {
-				return false, nil
-			}
-		}
-		return true, nil
-	}
-	failed := time.After(timeout)
-	notYetRunning := make(map[string]struct{})
-	for {
-		select {
-		case <-failed:
-			return eris.Errorf("timed out waiting for pods to come online: %v", notYetRunning)
-		case <-time.After(time.Second / 2):
-			notYetRunning = make(map[string]struct{})
-			for _, prefix := range podPrefixes {
-				ready, err := podsWithPrefixReady(prefix)
-				if err != nil {
-					log.Printf("failed to get pod status: %v", err)
-					notYetRunning[prefix] = struct{}{}
-				}
-				if !ready {
-					notYetRunning[prefix] = struct{}{}
-				}
-			}
-			if len(notYetRunning) == 0 {
-				return nil
-			}
-		}
-
 	}
+	return nil
 }
@@ -0,0 +1,533 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	DefaultWaitTimeout = 2 * time.Minute
+	// how long to wait before relisting after watching failed or the watch was closed
+	DefaultRelistInterval = time.Second
+	// how often to relist while the watch is healthy, in case it missed events
+	DefaultResyncPeriod = 30 * time.Second
+)
+
+// ResourceClient lists and watches the objects of one resource. Namespaced and cluster scoped
+// dynamic.ResourceInterfaces implement it, typed clients are adapted with NewTypedResourceClient.
+type ResourceClient interface {
+	List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// DynamicResourceClient returns a client for the resource in the namespace, or for all namespaces when it is empty
+func DynamicResourceClient(client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) ResourceClient {
+	if namespace == "" {
+		return client.Resource(gvr)
+	}
+	return client.Resource(gvr).Namespace(namespace)
+}
+
+// NewTypedResourceClient adapts the List and Watch functions of a typed client, e.g.
+// NewTypedResourceClient(kube.CoreV1().Pods(ns).List, kube.CoreV1().Pods(ns).Watch)
+func NewTypedResourceClient[L runtime.Object](
+	list func(context.Context, metav1.ListOptions) (L, error),
+	watchFunc func(context.Context, metav1.ListOptions) (watch.Interface, error),
+) ResourceClient {
+	return &typedResourceClient{
+		list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+			return list(ctx, opts)
+		},
+		watch: watchFunc,
+	}
+}
+
+func PodResourceClient(kube kubernetes.Interface, namespace string) ResourceClient {
+	return NewTypedResourceClient(kube.CoreV1().Pods(namespace).List, kube.CoreV1().Pods(namespace).Watch)
+}
+
+func ServiceResourceClient(kube kubernetes.Interface, namespace string) ResourceClient {
+	return NewTypedResourceClient(kube.CoreV1().Services(namespace).List, kube.CoreV1().Services(namespace).Watch)
+}
+
+func NamespaceResourceClient(kube kubernetes.Interface) ResourceClient {
+	return NewTypedResourceClient(kube.CoreV1().Namespaces().List, kube.CoreV1().Namespaces().Watch)
+}
+
+type typedResourceClient struct {
+	list  func(context.Context, metav1.ListOptions) (runtime.Object, error)
+	watch func(context.Context, metav1.ListOptions) (watch.Interface, error)
+}
+
+func (c *typedResourceClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	list, err := c.list(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	result := &unstructured.UnstructuredList{}
+	if listMeta, err := meta.ListAccessor(list); err == nil {
+		result.SetResourceVersion(listMeta.GetResourceVersion())
+	}
+	for _, item := range items {
+		obj, err := toUnstructured(item)
+		if err != nil {
+			return nil, err
+		}
+		result.Items = append(result.Items, *obj)
+	}
+	return result, nil
+}
+
+func (c *typedResourceClient) Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error) {
+	w, err := c.watch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+		if event.Type == watch.Error {
+			return event, true
+		}
+		obj, err := toUnstructured(event.Object)
+		if err != nil {
+			return event, false
+		}
+		event.Object = obj
+		return event, true
+	}), nil
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u, nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// Condition is evaluated against all objects selected by a wait
+type Condition interface {
+	// Met reports whether the objects satisfy the condition, and otherwise describes their state
+	Met(objects []*unstructured.Unstructured) (bool, string)
+	String() string
+}
+
+// FailFastCondition is a Condition which can tell that it will not be met, so that waiting for it stops early
+type FailFastCondition interface {
+	Condition
+	// Failed returns an error when the objects are in a state which needs intervention, e.g. crashing containers
+	Failed(objects []*unstructured.Unstructured) error
+}
+
+type condition struct {
+	description string
+	met         func(objects []*unstructured.Unstructured) (bool, string)
+}
+
+func (c *condition) Met(objects []*unstructured.Unstructured) (bool, string) {
+	return c.met(objects)
+}
+
+func (c *condition) String() string {
+	return c.description
+}
+
+// Deleted is met when no object is selected anymore
+func Deleted() Condition {
+	return &condition{
+		description: "deleted",
+		met: func(objects []*unstructured.Unstructured) (bool, string) {
+			if len(objects) == 0 {
+				return true, ""
+			}
+			var names []string
+			for _, obj := range objects {
+				names = append(names, objectName(obj))
+			}
+			return false, fmt.Sprintf("%d remaining: %s", len(objects), strings.Join(names, ", "))
+		},
+	}
+}
+
+// ObjectCondition is met when at least one object is selected and all of them satisfy check. check describes the state
+// of the objects which do not satisfy it.
+func ObjectCondition(description string, check func(obj *unstructured.Unstructured) (bool, string)) Condition {
+	return &condition{
+		description: description,
+		met: func(objects []*unstructured.Unstructured) (bool, string) {
+			if len(objects) == 0 {
+				return false, "no objects found"
+			}
+			var unmet []string
+			for _, obj := range objects {
+				if ok, state := check(obj); !ok {
+					unmet = append(unmet, objectName(obj)+": "+state)
+				}
+			}
+			return len(unmet) == 0, strings.Join(unmet, "; ")
+		},
+	}
+}
+
+// Phase is met when all objects are in one of the phases, e.g. "Running" or "Active"
+func Phase(phases ...string) Condition {
+	return ObjectCondition("phase "+strings.Join(phases, " or "), func(obj *unstructured.Unstructured) (bool, string) {
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		for _, expected := range phases {
+			if phase == expected {
+				return true, ""
+			}
+		}
+		if phase == "" {
+			return false, "no phase"
+		}
+		return false, "phase " + phase
+	})
+}
+
+// StatusCondition is met when all objects have the status condition with the status, e.g. "Ready" and "True"
+func StatusCondition(conditionType, status string) Condition {
+	return ObjectCondition(conditionType+"="+status, func(obj *unstructured.Unstructured) (bool, string) {
+		conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		for _, c := range conditions {
+			c, ok := c.(map[string]interface{})
+			if !ok || c["type"] != conditionType {
+				continue
+			}
+			if c["status"] == status {
+				return true, ""
+			}
+			state := fmt.Sprintf("condition %s is %v", conditionType, c["status"])
+			if reason, message := c["reason"], c["message"]; reason != nil || message != nil {
+				state += fmt.Sprintf(" (%v: %v)", reason, message)
+			}
+			return false, state
+		}
+		return false, "no condition " + conditionType
+	})
+}
+
+// JSONPath is met when the expression evaluates to the value for all objects, like kubectl wait --for=jsonpath
+func JSONPath(expression, value string) (Condition, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	parser := jsonpath.New("wait").AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, err
+	}
+	return ObjectCondition(expression+"="+value, func(obj *unstructured.Unstructured) (bool, string) {
+		var buf bytes.Buffer
+		if err := parser.Execute(&buf, obj.Object); err != nil {
+			return false, err.Error()
+		}
+		actual := strings.TrimSpace(buf.String())
+		if actual == value {
+			return true, ""
+		}
+		return false, fmt.Sprintf("%s is %q", expression, actual)
+	}), nil
+}
+
+// ObservedGeneration is met when the controller of all objects has observed their latest spec
+func ObservedGeneration() Condition {
+	return ObjectCondition("observed generation", func(obj *unstructured.Unstructured) (bool, string) {
+		observed, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+		if observed >= obj.GetGeneration() {
+			return true, ""
+		}
+		return false, fmt.Sprintf("observed generation %d of %d", observed, obj.GetGeneration())
+	})
+}
+
+func objectName(obj *unstructured.Unstructured) string {
+	if obj.GetNamespace() == "" {
+		return obj.GetName()
+	}
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// WaitOptions select the objects a condition is evaluated against. All objects of the resource are selected by default.
+type WaitOptions struct {
+	Name          string
+	LabelSelector string
+	FieldSelector string
+	// Filter selects objects on the client side, e.g. by name prefix
+	Filter func(obj *unstructured.Unstructured) bool
+	// defaults to DefaultWaitTimeout
+	Timeout time.Duration
+	// delay before relisting and watching again when watching failed, defaults to DefaultRelistInterval
+	RelistInterval time.Duration
+	// how often to relist while watching, defaults to DefaultResyncPeriod
+	ResyncPeriod time.Duration
+	// Description of the selected objects in errors, e.g. "pods in namespace default"
+	Description string
+}
+
+// WaitTimeoutError is returned when the condition was not met in time, or before the context of the wait was cancelled
+type WaitTimeoutError struct {
+	Description string
+	Condition   string
+	Timeout     time.Duration
+	// what the condition reported for the objects observed last
+	LastObserved string
+	// the last error listing or watching, if any
+	LastError error
+	// the error of the context of the wait
+	Err error
+}
+
+func (e *WaitTimeoutError) Error() string {
+	msg := fmt.Sprintf("timed out after %v waiting for %s (%s)", e.Timeout, e.Description, e.Condition)
+	if errors.Is(e.Err, context.Canceled) {
+		msg = fmt.Sprintf("canceled waiting for %s (%s)", e.Description, e.Condition)
+	}
+	if e.LastObserved != "" {
+		msg += ": " + e.LastObserved
+	}
+	if e.LastError != nil {
+		msg += fmt.Sprintf(" (last error: %v)", e.LastError)
+	}
+	return msg
+}
+
+func (e *WaitTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func IsWaitTimeoutError(err error) bool {
+	var timeoutErr *WaitTimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// WaitFor waits until the objects selected by the options meet the condition. It watches the objects, and relists them
+// when watching fails and every ResyncPeriod in case events were missed. On timeout or cancellation it returns a
+// WaitTimeoutError describing the state last observed. Waiting for a FailFastCondition stops with its error as soon as
+// it failed.
+func WaitFor(ctx context.Context, client ResourceClient, condition Condition, opts WaitOptions) error {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultWaitTimeout
+	}
+	if opts.RelistInterval == 0 {
+		opts.RelistInterval = DefaultRelistInterval
+	}
+	if opts.ResyncPeriod == 0 {
+		opts.ResyncPeriod = DefaultResyncPeriod
+	}
+	if opts.Description == "" {
+		opts.Description = "objects"
+		if opts.Name != "" {
+			opts.Description = opts.Name
+		}
+	}
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return err
+	}
+	fieldSelector := opts.FieldSelector
+	if opts.Name != "" {
+		nameSelector := fields.OneTermEqualSelector("metadata.name", opts.Name).String()
+		if fieldSelector == "" {
+			fieldSelector = nameSelector
+		} else {
+			fieldSelector += "," + nameSelector
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	w := &waiter{
+		client:    client,
+		condition: condition,
+		opts:      opts,
+		selector:  selector,
+		listOptions: metav1.ListOptions{
+			LabelSelector: opts.LabelSelector,
+			FieldSelector: fieldSelector,
+		},
+		objects: map[string]*unstructured.Unstructured{},
+	}
+	return w.run(ctx)
+}
+
+type waiter struct {
+	client      ResourceClient
+	condition   Condition
+	opts        WaitOptions
+	selector    labels.Selector
+	listOptions metav1.ListOptions
+
+	// the selected objects by namespace and name
+	objects         map[string]*unstructured.Unstructured
+	resourceVersion string
+	lastObserved    string
+	lastErr         error
+	failure         error
+}
+
+func (w *waiter) run(ctx context.Context) error {
+	for {
+		if err := w.relist(ctx); err != nil {
+			w.recordError(ctx, err)
+		} else if w.done() {
+			return w.failure
+		} else if done, err := w.watch(ctx); done {
+			return w.failure
+		} else if err != nil {
+			w.recordError(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return w.timeoutError(ctx.Err())
+		case <-time.After(w.opts.RelistInterval):
+		}
+	}
+}
+
+func (w *waiter) relist(ctx context.Context) error {
+	list, err := w.client.List(ctx, w.listOptions)
+	if err != nil {
+		return err
+	}
+	w.objects = map[string]*unstructured.Unstructured{}
+	for i := range list.Items {
+		obj := &list.Items[i]
+		if w.selected(obj) {
+			w.objects[objectName(obj)] = obj
+		}
+	}
+	w.resourceVersion = list.GetResourceVersion()
+	return nil
+}
+
+// watch applies events until the wait is done or the watch ends. It relists every ResyncPeriod meanwhile.
+func (w *waiter) watch(ctx context.Context) (bool, error) {
+	opts := w.listOptions
+	opts.ResourceVersion = w.resourceVersion
+	opts.AllowWatchBookmarks = true
+	watcher, err := w.client.Watch(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	defer watcher.Stop()
+
+	resync := time.NewTicker(w.opts.ResyncPeriod)
+	defer resync.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-resync.C:
+			if err := w.relist(ctx); err != nil {
+				w.recordError(ctx, err)
+				continue
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+			if event.Type == watch.Error {
+				return false, kubeerrors.FromObject(event.Object)
+			}
+			obj, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			w.resourceVersion = obj.GetResourceVersion()
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if w.selected(obj) {
+					w.objects[objectName(obj)] = obj
+				} else {
+					// it may no longer match the selector
+					delete(w.objects, objectName(obj))
+				}
+			case watch.Deleted:
+				delete(w.objects, objectName(obj))
+			default:
+				continue
+			}
+		}
+		if w.done() {
+			return true, nil
+		}
+	}
+}
+
+// errors caused by the end of the wait are not worth reporting
+func (w *waiter) recordError(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		w.lastErr = err
+	}
+}
+
+func (w *waiter) selected(obj *unstructured.Unstructured) bool {
+	// fake clients do not apply field selectors
+	if w.opts.Name != "" && obj.GetName() != w.opts.Name {
+		return false
+	}
+	if !w.selector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	return w.opts.Filter == nil || w.opts.Filter(obj)
+}
+
+// done reports whether the condition was met, or failed in which case the failure is set
+func (w *waiter) done() bool {
+	var objects []*unstructured.Unstructured
+	for _, obj := range w.objects {
+		objects = append(objects, obj)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objectName(objects[i]) < objectName(objects[j])
+	})
+	met, observed := w.condition.Met(objects)
+	w.lastObserved = observed
+	if met {
+		return true
+	}
+	if failFast, ok := w.condition.(FailFastCondition); ok {
+		w.failure = failFast.Failed(objects)
+	}
+	return w.failure != nil
+}
+
+func (w *waiter) timeoutError(err error) error {
+	lastObserved := w.lastObserved
+	if lastObserved == "" && w.lastErr != nil {
+		lastObserved = "could not observe any objects"
+	}
+	return &WaitTimeoutError{
+		Description:  w.opts.Description,
+		Condition:    w.condition.String(),
+		Timeout:      w.opts.Timeout,
+		LastObserved: lastObserved,
+		LastError:    w.lastErr,
+		Err:          err,
+	}
+}
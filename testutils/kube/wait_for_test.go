@@ -0,0 +1,220 @@
+package kube_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/solo-io/k8s-utils/testutils/kube"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("WaitFor", func() {
+	var (
+		ctx       context.Context
+		clientset *fake.Clientset
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		clientset = fake.NewClientset()
+	})
+
+	pod := func(name string, phase corev1.PodPhase, ready corev1.ConditionStatus) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: map[string]string{"app": "test"}},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				Conditions: []corev1.PodCondition{{
+					Type:    corev1.PodReady,
+					Status:  ready,
+					Reason:  "ContainersNotReady",
+					Message: "containers with unready status: [app]",
+				}},
+			},
+		}
+	}
+
+	createPod := func(p *corev1.Pod) {
+		_, err := clientset.CoreV1().Pods("default").Create(ctx, p, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	updateLater := func(p *corev1.Pod) {
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			_, err := clientset.CoreV1().Pods("default").UpdateStatus(ctx, p, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+	}
+
+	It("waits for status conditions", func() {
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+		updateLater(pod("a", corev1.PodRunning, corev1.ConditionTrue))
+
+		err := kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.StatusCondition("Ready", "True"), kube.WaitOptions{
+			Name:           "a",
+			Timeout:        5 * time.Second,
+			RelistInterval: time.Minute,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("waits for phases of the selected objects", func() {
+		createPod(pod("a", corev1.PodPending, corev1.ConditionFalse))
+		createPod(pod("b", corev1.PodRunning, corev1.ConditionFalse))
+		other := pod("c", corev1.PodPending, corev1.ConditionFalse)
+		other.Labels = nil
+		createPod(other)
+		updateLater(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+
+		err := kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.Phase("Running"), kube.WaitOptions{
+			LabelSelector:  "app=test",
+			Timeout:        5 * time.Second,
+			RelistInterval: time.Minute,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("explains the last observed state on timeout", func() {
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+		createPod(pod("b", corev1.PodPending, corev1.ConditionFalse))
+
+		err := kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.StatusCondition("Ready", "True"), kube.WaitOptions{
+			Timeout:     100 * time.Millisecond,
+			Description: "test pods",
+		})
+		Expect(kube.IsWaitTimeoutError(err)).To(BeTrue())
+		Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+		Expect(err.Error()).To(Equal("timed out after 100ms waiting for test pods (Ready=True): " +
+			"default/a: condition Ready is False (ContainersNotReady: containers with unready status: [app]); " +
+			"default/b: condition Ready is False (ContainersNotReady: containers with unready status: [app])"))
+
+		err = kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.Phase("Running"), kube.WaitOptions{
+			Filter: func(obj *unstructured.Unstructured) bool {
+				return obj.GetName() == "missing"
+			},
+			Timeout: 100 * time.Millisecond,
+		})
+		Expect(err).To(MatchError(ContainSubstring("(phase Running): no objects found")))
+	})
+
+	It("reports when the wait was cancelled", func() {
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+		cancelled, cancel := context.WithCancel(ctx)
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		err := kube.WaitFor(cancelled, kube.PodResourceClient(clientset, "default"), kube.StatusCondition("Ready", "True"), kube.WaitOptions{
+			Timeout:     5 * time.Second,
+			Description: "test pods",
+		})
+		Expect(kube.IsWaitTimeoutError(err)).To(BeTrue())
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(err).To(MatchError(HavePrefix("canceled waiting for test pods (Ready=True): default/a")))
+	})
+
+	It("does not relist while the watch is healthy", func() {
+		lists := 0
+		clientset.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+			lists++
+			return false, nil, nil
+		})
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+
+		err := kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.StatusCondition("Ready", "True"), kube.WaitOptions{
+			Timeout:        200 * time.Millisecond,
+			RelistInterval: 10 * time.Millisecond,
+		})
+		Expect(kube.IsWaitTimeoutError(err)).To(BeTrue())
+		Expect(lists).To(Equal(1))
+	})
+
+	It("waits for deletion", func() {
+		_, err := clientset.CoreV1().Namespaces().Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}, metav1.CreateOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			Expect(clientset.CoreV1().Namespaces().Delete(ctx, "ns", metav1.DeleteOptions{})).To(Succeed())
+		}()
+		kube.WaitForNamespaceTeardownWithClient(ctx, "ns", clientset)
+
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionTrue))
+		err = kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.Deleted(), kube.WaitOptions{
+			Timeout: 100 * time.Millisecond,
+		})
+		Expect(err).To(MatchError(ContainSubstring("(deleted): 1 remaining: default/a")))
+	})
+
+	It("relists when watching fails", func() {
+		clientset.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+			return true, nil, fmt.Errorf("watch not allowed")
+		})
+		createPod(pod("a", corev1.PodRunning, corev1.ConditionFalse))
+		updateLater(pod("a", corev1.PodRunning, corev1.ConditionTrue))
+
+		err := kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.StatusCondition("Ready", "True"), kube.WaitOptions{
+			Timeout:        5 * time.Second,
+			RelistInterval: 10 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = kube.WaitFor(ctx, kube.PodResourceClient(clientset, "default"), kube.Phase("Failed"), kube.WaitOptions{
+			Timeout:        100 * time.Millisecond,
+			RelistInterval: 10 * time.Millisecond,
+		})
+		Expect(err).To(MatchError(HaveSuffix("default/a: phase Running (last error: watch not allowed)")))
+	})
+
+	It("evaluates json paths of any resource", func() {
+		gvr := schema.GroupVersionResource{Group: "example.solo.io", Version: "v1", Resource: "widgets"}
+		widget := &unstructured.Unstructured{}
+		widget.SetAPIVersion("example.solo.io/v1")
+		widget.SetKind("Widget")
+		widget.SetNamespace("default")
+		widget.SetName("w")
+		Expect(unstructured.SetNestedField(widget.Object, "Pending", "status", "state")).To(Succeed())
+		dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{gvr: "WidgetList"}, widget)
+
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			updated := widget.DeepCopy()
+			Expect(unstructured.SetNestedField(updated.Object, "Ready", "status", "state")).To(Succeed())
+			_, err := dynamicClient.Resource(gvr).Namespace("default").Update(ctx, updated, metav1.UpdateOptions{})
+			Expect(err).NotTo(HaveOccurred())
+		}()
+
+		condition, err := kube.JSONPath(".status.state", "Ready")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(condition.String()).To(Equal("{.status.state}=Ready"))
+		err = kube.WaitFor(ctx, kube.DynamicResourceClient(dynamicClient, gvr, "default"), condition, kube.WaitOptions{
+			Name:    "w",
+			Timeout: 5 * time.Second,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		condition, err = kube.JSONPath(".status.state", "Gone")
+		Expect(err).NotTo(HaveOccurred())
+		err = kube.WaitFor(ctx, kube.DynamicResourceClient(dynamicClient, gvr, ""), condition, kube.WaitOptions{
+			Timeout: 100 * time.Millisecond,
+		})
+		Expect(err).To(MatchError(ContainSubstring(`default/w: {.status.state} is "Ready"`)))
+
+		_, err = kube.JSONPath("{.status[", "")
+		Expect(err).To(HaveOccurred())
+	})
+})